@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/generate"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+)
+
+// generateCommand writes the Grafana dashboard or the PrometheusRule generated
+// from the metrics catalog and the configured thresholds.
+func generateCommand(args []string) int {
+	generators := map[string]func(*generate.Config) ([]byte, error){
+		"dashboard": generate.MarshalDashboard,
+		"rules":     generate.MarshalRules,
+	}
+	if len(args) == 0 || generators[args[0]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: test-monitor generate dashboard|rules [-config file] [-metric-groups groups] [-o file]")
+		return 2
+	}
+
+	var configFile, metricGroups, output string
+	flags := flag.NewFlagSet("generate "+args[0], flag.ContinueOnError)
+	flags.StringVar(&configFile, "config", "", "The YAML file configuring the alert thresholds. The defaults are used if empty.")
+	flags.StringVar(&metricGroups, "metric-groups", "", "The --metric-groups the monitor runs with. Panels and alerts of disabled groups are left out.")
+	flags.StringVar(&output, "o", "", "The file to write to. Standard output if empty.")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if err := monitor.SetGroups(metricGroups); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	config := generate.DefaultConfig()
+	if len(configFile) > 0 {
+		var err error
+		if config, err = generate.LoadConfig(configFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	content, err := generators[args[0]](config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(output) == 0 {
+		_, err = os.Stdout.Write(append(content, '\n'))
+	} else {
+		err = os.WriteFile(output, append(content, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
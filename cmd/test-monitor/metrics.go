@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+)
+
+// commands are the subcommands of test-monitor by name. Without a subcommand
+// test-monitor runs the monitor.
+var commands = map[string]func(args []string) int{
+	"metrics":  metricsCommand,
+	"generate": generateCommand,
+	"report":   reportCommand,
+}
+
+// metricsCommand lists the metrics of the catalog.
+func metricsCommand(args []string) int {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "usage: test-monitor metrics list [-o table|json|markdown] [-group name]")
+		return 2
+	}
+
+	var format, group string
+	flags := flag.NewFlagSet("metrics list", flag.ContinueOnError)
+	flags.StringVar(&format, "o", monitor.FormatTable, "The output format, one of table, json or markdown.")
+	flags.StringVar(&group, "group", "", "Only list the metrics of this group.")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if len(group) > 0 && !knownGroup(group) {
+		fmt.Fprintf(os.Stderr, "unknown metric group %q\n", group)
+		return 2
+	}
+
+	if err := monitor.WriteCatalog(os.Stdout, format, group); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func knownGroup(name string) bool {
+	for _, group := range monitor.Groups {
+		if group.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/report"
+)
+
+// reportCommand prints pass/fail tables from the persisted state of a
+// monitor, e.g. a backup of its state volume, without a cluster connection.
+func reportCommand(args []string) int {
+	var dir, metricsFile, source, tables, format, sortBy string
+	var minRuns int
+	var descending bool
+	query := url.Values{}
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	flags.StringVar(&dir, "dir", "/context", "The state directory holding run_ledger.jsonl and test_contexts.json.")
+	flags.StringVar(&metricsFile, "metrics", "", "A metrics snapshot, either a JSON snapshot of the monitor or a file in the Prometheus text format.")
+	flags.StringVar(&source, "source", report.SourceLedger, "Whether the totals are taken from the run ledger (ledger) or the run counters of the metrics snapshot (metrics).")
+	flags.StringVar(&tables, "tables", "pool,portgroup,variant,network_type", "The comma separated tables to print, each grouped by one or more dimensions joined with +, e.g. pool,pool+variant.")
+	flags.StringVar(&format, "o", report.FormatText, "The output format, one of text, markdown, csv or json.")
+	flags.StringVar(&sortBy, "sort", report.SortName, "Sort the rows by name, runs, passes, fails, pass_rate, in_flight or one of the dimensions of the tables.")
+	flags.BoolVar(&descending, "desc", false, "Sort the rows in descending order.")
+	flags.IntVar(&minRuns, "min-runs", 0, "Leave out rows with fewer completed runs.")
+	for _, name := range []string{"test_name", "variant", "job_type", "pool", "network_type", "portgroup"} {
+		flags.Func(strings.ReplaceAll(name, "_", "-"), fmt.Sprintf("Only count runs with this %s.", strings.ReplaceAll(name, "_", " ")), func(value string) error {
+			query.Set(name, value)
+			return nil
+		})
+	}
+	flags.Func("result", "Only count passed or failed runs.", func(value string) error {
+		query.Set("result", value)
+		return nil
+	})
+	since := flags.String("since", "168h", "Only count runs completed since this RFC3339 time or duration ago. Ignored for the metrics source.")
+	until := flags.String("until", "", "Only count runs completed until this RFC3339 time or duration ago.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if source == report.SourceLedger {
+		query.Set("since", *since)
+		query.Set("until", *until)
+	} else if len(*until) > 0 {
+		fmt.Fprintln(os.Stderr, "-until cannot be used with the metrics source")
+		return 2
+	}
+
+	filter, err := api.ParseFilter(query)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	options := report.Options{
+		Source:     source,
+		Filter:     filter,
+		MinRuns:    minRuns,
+		SortBy:     sortBy,
+		Descending: descending,
+	}
+	for _, table := range strings.Split(tables, ",") {
+		dimensions := strings.Split(strings.TrimSpace(table), "+")
+		for _, dimension := range dimensions {
+			if _, err := ledger.DimensionValue(&data.RunRecord{}, dimension); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+		}
+		options.Tables = append(options.Tables, dimensions)
+	}
+
+	state, err := report.Load(dir, metricsFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	built, err := state.Build(options, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := built.Write(os.Stdout, format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -1,23 +1,123 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	"github.com/openshift-splat-team/test-monitor/pkg/cardinality"
+	"github.com/openshift-splat-team/test-monitor/pkg/changepoint"
 	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
 	"github.com/openshift-splat-team/test-monitor/pkg/controller"
+	"github.com/openshift-splat-team/test-monitor/pkg/dashboard"
+	"github.com/openshift-splat-team/test-monitor/pkg/events"
+	"github.com/openshift-splat-team/test-monitor/pkg/flake"
+	"github.com/openshift-splat-team/test-monitor/pkg/health"
+	"github.com/openshift-splat-team/test-monitor/pkg/incident"
+	"github.com/openshift-splat-team/test-monitor/pkg/junit"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/openshift-splat-team/test-monitor/pkg/notify"
+	"github.com/openshift-splat-team/test-monitor/pkg/observer"
+	"github.com/openshift-splat-team/test-monitor/pkg/probe"
+	"github.com/openshift-splat-team/test-monitor/pkg/push"
+	"github.com/openshift-splat-team/test-monitor/pkg/quarantine"
+	"github.com/openshift-splat-team/test-monitor/pkg/sippy"
+	"github.com/openshift-splat-team/test-monitor/pkg/trace"
+	"github.com/openshift-splat-team/test-monitor/pkg/webhook"
 	v1 "github.com/openshift-splat-team/vsphere-capacity-manager/pkg/apis/vspherecapacitymanager.splat.io/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2/textlogger"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, found := commands[os.Args[1]]; found {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
+	var apiBindAddress, notificationConfig, quarantineMode, probeNetworkType, otlpEndpoint, otlpHeaders string
+	var eventsURL, eventsMode, eventsFile, eventsSource string
+	var sippyExportDir, prowURL string
+	var prowJobKubeconfig, prowJobNamespace, prowJobCluster, prowJobSelector string
+	var junitArtifactDir, junitAllowList, prowWebhookSecretFile, cardinalityConfig, passRateWindows, metricGroups string
+	var pushURL, pushProtocol, pushHeaders, pushJob, pushFallbackDir string
+	var healthWindow, healthInterval, flakeWindow, incidentWindow, stuckRunAge, quarantineCoolDown time.Duration
+	var probeInterval, probeTimeout, sippyExportInterval, junitTimeout, pushInterval time.Duration
+	var incidentThreshold, quarantineCanaries, eventsFileMaxFiles, pushRetries, pushFallbackMaxFiles int
+	var eventsFileMaxSize int64
+	var quarantineDryRun, watchProwJobs, junitRecordPassed bool
+	flag.StringVar(&apiBindAddress, "api-bind-address", ":8090", "The address the JSON API binds to. Set to 0 to disable the API.")
+	flag.DurationVar(&healthWindow, "health-window", 72*time.Hour, "The rolling window of completed runs used to score pool and portgroup health.")
+	flag.DurationVar(&healthInterval, "health-interval", 5*time.Minute, "How often pool and portgroup health scores and flake rates are recomputed.")
+	flag.DurationVar(&flakeWindow, "flake-window", 7*24*time.Hour, "The rolling window of completed runs in which reruns of the same commit are detected as flakes.")
+	flag.DurationVar(&incidentWindow, "incident-window", 30*time.Minute, "How close together failures sharing the same topology must be to be correlated into an incident.")
+	flag.IntVar(&incidentThreshold, "incident-threshold", 3, "The number of correlated failed namespaces which raise an incident.")
+	flag.DurationVar(&stuckRunAge, "stuck-run-age", 8*time.Hour, "The age after which an in-flight test run is reported as stuck.")
+	flag.StringVar(&notificationConfig, "notification-config", "", "The YAML file configuring notification receivers. Notifications are disabled if empty.")
+	flag.StringVar(&quarantineMode, "quarantine-mode", quarantine.ModeOff, "Whether unhealthy pools are left alone (off), annotated with a quarantine recommendation (recommend) or also set to NoSchedule (enforce).")
+	flag.BoolVar(&quarantineDryRun, "quarantine-dry-run", false, "Record pool quarantine actions in the audit trail without changing the pools.")
+	flag.DurationVar(&quarantineCoolDown, "quarantine-cool-down", 6*time.Hour, "The minimum time a pool stays quarantined.")
+	flag.IntVar(&quarantineCanaries, "quarantine-canaries", 3, "The number of consecutive successful canaries on a quarantined pool which release it.")
+	flag.DurationVar(&probeInterval, "probe-interval", 0, "How often a canary lease is pinned to each pool. Set to 0 to disable probing.")
+	flag.DurationVar(&probeTimeout, "probe-timeout", 15*time.Minute, "How long a canary lease may take to be fulfilled.")
+	flag.StringVar(&probeNetworkType, "probe-network-type", string(v1.NetworkTypeSingleTenant), "The network type requested by canary leases.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "The base URL of an OTLP/HTTP collector, e.g. http://localhost:4318, completed runs are exported to as traces. Traces are disabled if empty.")
+	flag.StringVar(&otlpHeaders, "otlp-headers", "", "Comma separated name=value headers sent to the OTLP collector.")
+	flag.StringVar(&eventsURL, "cloudevents-url", "", "The URL run lifecycle CloudEvents are posted to. Disabled if empty.")
+	flag.StringVar(&eventsMode, "cloudevents-mode", events.ModeStructured, "Whether CloudEvents are posted in structured or binary content mode.")
+	flag.StringVar(&eventsFile, "cloudevents-file", "", "The file run lifecycle CloudEvents are appended to as JSON lines. Disabled if empty.")
+	flag.Int64Var(&eventsFileMaxSize, "cloudevents-file-max-size", 100*1024*1024, "The size in bytes after which the CloudEvents file is rotated.")
+	flag.IntVar(&eventsFileMaxFiles, "cloudevents-file-max-files", 5, "The number of rotated CloudEvents files which are kept.")
+	flag.StringVar(&eventsSource, "cloudevents-source", events.DefaultSource, "The source attribute of the emitted CloudEvents.")
+	flag.StringVar(&sippyExportDir, "sippy-export-dir", "", "The directory completed runs are periodically written to as Sippy job runs. Periodic export is disabled if empty.")
+	flag.DurationVar(&sippyExportInterval, "sippy-export-interval", time.Hour, "How often newly completed runs are written to the Sippy export directory.")
+	flag.StringVar(&prowURL, "prow-url", sippy.DefaultProwURL, "The base URL links to the artifacts of job runs are built from.")
+	flag.BoolVar(&watchProwJobs, "watch-prowjobs", false, "Take the outcome of test runs from the final state of their ProwJobs, falling back to failed pods if unknown.")
+	flag.StringVar(&prowJobKubeconfig, "prowjob-kubeconfig", "", "The kubeconfig of the cluster holding the ProwJobs. The build cluster is used if empty.")
+	flag.StringVar(&prowJobNamespace, "prowjob-namespace", controller.DefaultProwJobNamespace, "The namespace of the ProwJobs.")
+	flag.StringVar(&prowJobCluster, "prowjob-cluster", "", "Only watch ProwJobs scheduled to this build cluster. ProwJobs of all clusters are watched if empty.")
+	flag.StringVar(&prowJobSelector, "prowjob-selector", controller.DefaultProwJobSelector, "The label selector of the ProwJobs whose outcome is taken. All ProwJobs are considered if empty.")
+	flag.StringVar(&junitArtifactDir, "junit-artifact-dir", "", "The local mirror of the job artifact bucket JUnit results of completed runs are read from. JUnit ingestion is disabled if empty.")
+	flag.StringVar(&junitAllowList, "junit-allowlist", "", "The file listing regular expressions, one per line, of the test cases which are counted per pool and portgroup.")
+	flag.BoolVar(&junitRecordPassed, "junit-record-passed", false, "Also list passed and skipped test cases on the run records rather than only counting them.")
+	flag.DurationVar(&junitTimeout, "junit-timeout", 6*time.Hour, "How long after the completion of a run its JUnit results are looked for.")
+	flag.StringVar(&prowWebhookSecretFile, "prow-webhook-secret-file", "", "The file holding the HMAC secret notifications of finished prow jobs are signed with. The prow webhook receiver is disabled if empty.")
+	flag.StringVar(&cardinalityConfig, "cardinality-config", "", "The YAML file limiting the label values of the run and pod failure counters and the TTL of their series. They are unbounded if empty.")
+	flag.StringVar(&passRateWindows, "pass-rate-windows", "1h,24h,7d", "The comma separated rolling windows pool pass rates are exported over.")
+	flag.StringVar(&metricGroups, "metric-groups", "", "Comma separated group=true|false pairs enabling or disabling metric groups, e.g. junit=false. See test-monitor metrics list.")
+	flag.StringVar(&pushURL, "push-url", "", "The remote-write endpoint or Pushgateway the metrics are pushed to, for clusters where the monitor cannot be scraped. Pushing is disabled if empty.")
+	flag.StringVar(&pushProtocol, "push-protocol", push.ProtocolRemoteWrite, "Whether the metrics are pushed with the remote-write protocol (remote-write) or to a Pushgateway (pushgateway).")
+	flag.StringVar(&pushHeaders, "push-headers", "", "Comma separated name=value headers sent with every push, e.g. for authorization.")
+	flag.DurationVar(&pushInterval, "push-interval", time.Minute, "How often the metrics are pushed.")
+	flag.StringVar(&pushJob, "push-job", push.DefaultJob, "The job label of the pushed series.")
+	flag.IntVar(&pushRetries, "push-retries", 3, "How often a failed push is retried with exponential back-off.")
+	flag.StringVar(&pushFallbackDir, "push-fallback-dir", "", "The directory pushes which still fail are written to as OpenMetrics files. They are dropped if empty.")
+	flag.IntVar(&pushFallbackMaxFiles, "push-fallback-max-files", 100, "The number of failed pushes kept in the fallback directory.")
+	flag.Parse()
+
 	logger := textlogger.NewLogger(textlogger.NewConfig())
 	ctrl.SetLogger(logger)
 
-	mgr, err := manager.New(config.GetConfigOrDie(), manager.Options{})
+	if err := monitor.SetGroups(metricGroups); err != nil {
+		logger.Error(err, "invalid metric groups")
+		os.Exit(1)
+	}
+
+	mgr, err := manager.New(config.GetConfigOrDie(), manager.Options{
+		Metrics: metricsserver.Options{FilterProvider: testcontext.OpenMetricsFilter},
+	})
 	if err != nil {
 		logger.Error(err, "could not create manager")
 		os.Exit(1)
@@ -31,7 +131,67 @@ func main() {
 
 	leaseReconciler := &controller.LeaseReconciler{}
 	podReconciler := &controller.PodReconciler{}
-	testContext := &testcontext.TestContextService{}
+	observers := &observer.Registry{}
+	if err := observers.
+		SetupWithManager(mgr); err != nil {
+		logger.Error(err, "unable to create run observer registry")
+		os.Exit(1)
+	}
+	guard := &cardinality.Guard{}
+	if len(cardinalityConfig) > 0 {
+		if guard.Config, err = cardinality.LoadConfig(cardinalityConfig); err != nil {
+			logger.Error(err, "unable to load cardinality config")
+			os.Exit(1)
+		}
+	}
+	if err := guard.
+		SetupWithManager(mgr); err != nil {
+		logger.Error(err, "unable to create cardinality guard")
+		os.Exit(1)
+	}
+	testContext := &testcontext.TestContextService{StuckRunAge: stuckRunAge, Cardinality: guard, Observers: observers}
+	if len(otlpEndpoint) > 0 {
+		exporter := &trace.Exporter{Endpoint: otlpEndpoint, Headers: parseHeaders(otlpHeaders)}
+		if err := exporter.
+			SetupWithManager(mgr); err != nil {
+			logger.Error(err, "unable to create trace exporter")
+			os.Exit(1)
+		}
+		observers.Register("traces", exporter)
+	}
+	var eventSinks []events.Sink
+	if len(eventsURL) > 0 {
+		eventSinks = append(eventSinks, &events.HTTPSink{URL: eventsURL, Mode: eventsMode})
+	}
+	if len(eventsFile) > 0 {
+		eventSinks = append(eventSinks, &events.FileSink{Path: eventsFile, MaxBytes: eventsFileMaxSize, MaxFiles: eventsFileMaxFiles})
+	}
+	if len(eventSinks) > 0 {
+		emitter := &events.Emitter{Source: eventsSource, Sinks: eventSinks}
+		if err := emitter.
+			SetupWithManager(mgr); err != nil {
+			logger.Error(err, "unable to create event emitter")
+			os.Exit(1)
+		}
+		observers.Register("events", emitter)
+	}
+	if len(pushURL) > 0 {
+		pusher := &push.Pusher{
+			URL:              pushURL,
+			Protocol:         pushProtocol,
+			Headers:          parseHeaders(pushHeaders),
+			Interval:         pushInterval,
+			Job:              pushJob,
+			MaxRetries:       pushRetries,
+			FallbackDir:      pushFallbackDir,
+			FallbackMaxFiles: pushFallbackMaxFiles,
+		}
+		if err := pusher.
+			SetupWithManager(mgr); err != nil {
+			logger.Error(err, "unable to create metrics pusher")
+			os.Exit(1)
+		}
+	}
 	testContext.Initialize(logger)
 
 	if err := leaseReconciler.
@@ -45,14 +205,228 @@ func main() {
 		os.Exit(1)
 	}
 
+	if watchProwJobs {
+		var prowCluster cluster.Cluster
+		if len(prowJobKubeconfig) > 0 {
+			prowConfig, err := clientcmd.BuildConfigFromFlags("", prowJobKubeconfig)
+			if err != nil {
+				logger.Error(err, "could not load prow job kubeconfig")
+				os.Exit(1)
+			}
+			prowCluster, err = cluster.New(prowConfig, func(options *cluster.Options) {
+				options.Cache.DefaultNamespaces = map[string]cache.Config{prowJobNamespace: {}}
+			})
+			if err != nil {
+				logger.Error(err, "could not create prow job cluster")
+				os.Exit(1)
+			}
+			if err := mgr.Add(prowCluster); err != nil {
+				logger.Error(err, "could not add prow job cluster to manager")
+				os.Exit(1)
+			}
+		}
+		selector, err := labels.Parse(prowJobSelector)
+		if err != nil {
+			logger.Error(err, "invalid prow job selector")
+			os.Exit(1)
+		}
+		if err := (&controller.ProwJobReconciler{Namespace: prowJobNamespace, Cluster: prowJobCluster, Selector: selector}).
+			SetupWithManager(mgr, prowCluster, testContext); err != nil {
+			logger.Error(err, "unable to create prow job controller")
+			os.Exit(1)
+		}
+	}
+
 	if err := (&controller.NamespaceReconciler{}).
 		SetupWithManager(mgr, leaseReconciler, podReconciler, testContext); err != nil {
 		logger.Error(err, "unable to create namespace controller")
 		os.Exit(1)
 	}
 
+	healthScorer := &health.Scorer{Window: healthWindow, Interval: healthInterval}
+	if err := healthScorer.
+		SetupWithManager(mgr, testContext); err != nil {
+		logger.Error(err, "unable to create health scorer")
+		os.Exit(1)
+	}
+	windows, err := health.ParseWindows(passRateWindows)
+	if err != nil {
+		logger.Error(err, "invalid pass rate windows")
+		os.Exit(1)
+	}
+	passRates := &health.PassRates{Windows: windows}
+	if err := passRates.
+		SetupWithManager(mgr, testContext); err != nil {
+		logger.Error(err, "unable to create pass rates")
+		os.Exit(1)
+	}
+	observers.Register("pass-rates", passRates)
+
+	flakeAnalyzer := &flake.Analyzer{Window: flakeWindow, Interval: healthInterval}
+	if err := flakeAnalyzer.
+		SetupWithManager(mgr, testContext); err != nil {
+		logger.Error(err, "unable to create flake analyzer")
+		os.Exit(1)
+	}
+
+	changePointDetector := &changepoint.Detector{}
+	if err := changePointDetector.
+		SetupWithManager(mgr, testContext); err != nil {
+		logger.Error(err, "unable to create change point detector")
+		os.Exit(1)
+	}
+
+	incidentCorrelator := &incident.Correlator{Window: incidentWindow, Threshold: incidentThreshold}
+	if err := incidentCorrelator.
+		SetupWithManager(mgr, testContext); err != nil {
+		logger.Error(err, "unable to create incident correlator")
+		os.Exit(1)
+	}
+
+	sippyExporter := &sippy.Exporter{Directory: sippyExportDir, Interval: sippyExportInterval, ProwURL: prowURL}
+	if err := sippyExporter.
+		SetupWithManager(mgr, testContext); err != nil {
+		logger.Error(err, "unable to create sippy exporter")
+		os.Exit(1)
+	}
+
+	var ingester *junit.Ingester
+	if len(junitArtifactDir) > 0 {
+		ingester = &junit.Ingester{
+			Bucket:       &junit.DirectoryBucket{Root: junitArtifactDir},
+			Interval:     5 * time.Minute,
+			Timeout:      junitTimeout,
+			RecordPassed: junitRecordPassed,
+		}
+		if len(junitAllowList) > 0 {
+			if ingester.AllowList, err = junit.LoadAllowList(junitAllowList); err != nil {
+				logger.Error(err, "unable to load junit allow-list")
+				os.Exit(1)
+			}
+		}
+		if err := ingester.
+			SetupWithManager(mgr, testContext); err != nil {
+			logger.Error(err, "unable to create junit ingester")
+			os.Exit(1)
+		}
+		observers.Register("junit", ingester)
+	}
+
+	var prober *probe.Prober
+	if probeInterval > 0 {
+		prober = &probe.Prober{
+			Interval:    probeInterval,
+			Timeout:     probeTimeout,
+			NetworkType: v1.NetworkType(probeNetworkType),
+			Directory:   testContext.Directory,
+		}
+		if err := prober.
+			SetupWithManager(mgr); err != nil {
+			logger.Error(err, "unable to create pool prober")
+			os.Exit(1)
+		}
+	}
+
+	var quarantiner *quarantine.Quarantiner
+	if quarantineMode != quarantine.ModeOff {
+		quarantiner = &quarantine.Quarantiner{
+			Mode:     quarantineMode,
+			DryRun:   quarantineDryRun,
+			Interval: healthInterval,
+			Window:   healthWindow,
+			CoolDown: quarantineCoolDown,
+			Canaries: quarantineCanaries,
+		}
+		if prober != nil {
+			quarantiner.CanarySource = prober
+		}
+		if err := quarantiner.
+			SetupWithManager(mgr, testContext); err != nil {
+			logger.Error(err, "unable to create pool quarantiner")
+			os.Exit(1)
+		}
+	}
+
+	var dispatcher *notify.Dispatcher
+	if len(notificationConfig) > 0 {
+		notifyConfig, err := notify.LoadConfig(notificationConfig)
+		if err != nil {
+			logger.Error(err, "unable to load notification config")
+			os.Exit(1)
+		}
+		dispatcher = &notify.Dispatcher{
+			Config:    notifyConfig,
+			Directory: testContext.Directory,
+			Sources: []notify.Source{
+				notify.PoolHealthSource(healthScorer, notifyConfig.HealthScoreThreshold, notifyConfig.HealthMinRuns),
+				notify.LeakedLeaseSource(testContext),
+				notify.IncidentSource(incidentCorrelator),
+			},
+		}
+		if err := dispatcher.
+			SetupWithManager(mgr); err != nil {
+			logger.Error(err, "unable to create notification dispatcher")
+			os.Exit(1)
+		}
+	}
+
+	if apiBindAddress != "0" {
+		apiServer := &api.Server{BindAddress: apiBindAddress}
+		if err := apiServer.
+			SetupWithManager(mgr, testContext); err != nil {
+			logger.Error(err, "unable to create api server")
+			os.Exit(1)
+		}
+		if err := (&dashboard.Dashboard{}).
+			SetupWithServer(apiServer, testContext, logger); err != nil {
+			logger.Error(err, "unable to create dashboard")
+			os.Exit(1)
+		}
+		if len(prowWebhookSecretFile) > 0 {
+			secret, err := os.ReadFile(prowWebhookSecretFile)
+			if err != nil {
+				logger.Error(err, "unable to read prow webhook secret")
+				os.Exit(1)
+			}
+			if err := (&webhook.Receiver{Secret: bytes.TrimSpace(secret)}).
+				SetupWithServer(apiServer, testContext, logger); err != nil {
+				logger.Error(err, "unable to create prow webhook receiver")
+				os.Exit(1)
+			}
+		}
+		healthScorer.SetupWithServer(apiServer)
+		passRates.SetupWithServer(apiServer)
+		changePointDetector.SetupWithServer(apiServer)
+		flakeAnalyzer.SetupWithServer(apiServer)
+		incidentCorrelator.SetupWithServer(apiServer)
+		sippyExporter.SetupWithServer(apiServer)
+		if ingester != nil {
+			ingester.SetupWithServer(apiServer)
+		}
+		if dispatcher != nil {
+			dispatcher.SetupWithServer(apiServer)
+		}
+		if quarantiner != nil {
+			quarantiner.SetupWithServer(apiServer)
+		}
+		if prober != nil {
+			prober.SetupWithServer(apiServer)
+		}
+	}
+
 	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
 		logger.Error(err, "could not start manager")
 		os.Exit(1)
 	}
 }
+
+// parseHeaders parses comma separated name=value pairs.
+func parseHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if name, value, found := strings.Cut(pair, "="); found {
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+
+	defaultStatsWindow = 24 * time.Hour
+)
+
+var defaultStatsGroupBy = []string{ledger.DimensionPool, ledger.DimensionVariant}
+
+func (s *Server) listContexts(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	snapshot := s.testContext.GetTestContextSnapshot()
+	views := make([]ContextView, 0, len(snapshot))
+	for _, testContext := range snapshot {
+		// namespaces which are not test runs are tracked but not listed
+		if !testContext.IsTestRun() {
+			continue
+		}
+		views = append(views, newContextView(testContext))
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Namespace < views[j].Namespace
+	})
+
+	s.writeJSON(w, http.StatusOK, page(views, limit, offset))
+}
+
+func (s *Server) getContext(w http.ResponseWriter, r *http.Request) {
+	namespace := r.PathValue("namespace")
+	testContext, exists := s.testContext.GetTestContext(namespace)
+	if !exists {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("no test context for namespace %s", namespace))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, newContextView(testContext))
+}
+
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, offset, err := parsePage(query)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter, err := ParseFilter(query)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, page(s.testContext.QueryRuns(filter), limit, offset))
+}
+
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := ParseFilter(query)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	window := defaultStatsWindow
+	if value := query.Get("window"); len(value) > 0 {
+		window, err = time.ParseDuration(value)
+		if err != nil || window <= 0 {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid window %q", value))
+			return
+		}
+	}
+	if filter.Until.IsZero() {
+		filter.Until = time.Now()
+	}
+	if filter.Since.IsZero() {
+		filter.Since = filter.Until.Add(-window)
+	}
+
+	groupBy := defaultStatsGroupBy
+	if value := query.Get("group_by"); len(value) > 0 {
+		groupBy = strings.Split(value, ",")
+	}
+
+	summaries, err := ledger.Summarize(s.testContext.QueryRuns(filter), groupBy...)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, StatsResponse{
+		Since:     filter.Since,
+		Until:     filter.Until,
+		GroupBy:   groupBy,
+		Summaries: summaries,
+	})
+}
+
+func (s *Server) listLeases(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, offset, err := parsePage(query)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var leases []data.LeaseRecord
+	switch query.Get("leaked") {
+	case "":
+		leases = s.testContext.GetLeaseSnapshot()
+	case "true":
+		leases = s.testContext.GetLeakedLeases(testcontext.LeaseLeakGracePeriod)
+	default:
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid leaked %q, must be true", query.Get("leaked")))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, page(leases, limit, offset))
+}
+
+// parsePage reads the limit and offset query parameters.
+func parsePage(query url.Values) (int, int, error) {
+	limit, offset := defaultPageLimit, 0
+	if value := query.Get("limit"); len(value) > 0 {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit %q", value)
+		}
+		limit = min(limit, maxPageLimit)
+	}
+	if value := query.Get("offset"); len(value) > 0 {
+		var err error
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", value)
+		}
+	}
+	return limit, offset, nil
+}
+
+// ParseFilter builds a run ledger filter from the query parameters.
+func ParseFilter(query url.Values) (ledger.Filter, error) {
+	filter := ledger.Filter{
+		TestName:    query.Get("test_name"),
+		Variant:     query.Get("variant"),
+		JobType:     query.Get("job_type"),
+		Pool:        query.Get("pool"),
+		NetworkType: query.Get("network_type"),
+		Portgroup:   query.Get("portgroup"),
+		Result:      query.Get("result"),
+	}
+
+	if len(filter.Result) > 0 && filter.Result != "passed" && filter.Result != "failed" {
+		return filter, fmt.Errorf("invalid result %q, must be passed or failed", filter.Result)
+	}
+
+	var err error
+	if filter.Since, err = parseTime(query.Get("since")); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseTime(query.Get("until")); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseTime accepts either an RFC3339 timestamp or a duration relative to now.
+func parseTime(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	if timestamp, err := time.Parse(time.RFC3339, value); err == nil {
+		return timestamp, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, must be RFC3339 or a duration", value)
+}
+
+// page returns the requested page of items.
+func page[T any](items []T, limit, offset int) ListResponse {
+	response := ListResponse{
+		Total:  len(items),
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	start := min(offset, len(items))
+	end := min(start+limit, len(items))
+	pageItems := items[start:end]
+	if pageItems == nil {
+		pageItems = []T{}
+	}
+	response.Items = pageItems
+
+	if end < len(items) {
+		response.NextOffset = &end
+	}
+	return response
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// shutdownTimeout is how long in-flight requests are given to finish when the manager stops.
+	shutdownTimeout = 10 * time.Second
+)
+
+// Server serves the JSON API exposing live and historical test contexts.
+type Server struct {
+	// BindAddress is the address the API listens on.
+	BindAddress string
+
+	mux *http.ServeMux
+
+	testContext *testcontext.TestContextService
+
+	log logr.Logger
+}
+
+func (s *Server) SetupWithManager(mgr ctrl.Manager,
+	testContext *testcontext.TestContextService) error {
+	s.testContext = testContext
+	s.log = mgr.GetLogger().WithName("api")
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /api/v1/contexts", s.listContexts)
+	s.mux.HandleFunc("GET /api/v1/contexts/{namespace}", s.getContext)
+	s.mux.HandleFunc("GET /api/v1/runs", s.listRuns)
+	s.mux.HandleFunc("GET /api/v1/stats", s.getStats)
+	s.mux.HandleFunc("GET /api/v1/leases", s.listLeases)
+
+	if err := mgr.Add(s); err != nil {
+		return fmt.Errorf("error adding api server to manager: %w", err)
+	}
+	return nil
+}
+
+// Handle registers an additional handler on the API server.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start serves the API until the context is cancelled.
+func (s *Server) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.BindAddress,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.log.Info("starting api server", "address", s.BindAddress)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("error serving api: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down api server: %w", err)
+	}
+	return nil
+}
+
+// NeedLeaderElection allows every replica to serve the API.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// WriteJSON encodes the value as the JSON response body.
+func WriteJSON(w http.ResponseWriter, status int, value interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// WriteError responds with a JSON error message, the error shape of every
+// handler of the API.
+func WriteError(w http.ResponseWriter, status int, err error) error {
+	return WriteJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// writeJSON encodes the value as the JSON response body.
+func (s *Server) writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	if err := WriteJSON(w, status, value); err != nil {
+		s.log.Error(err, "error encoding response")
+	}
+}
+
+// writeError responds with a JSON error message.
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	if err := WriteError(w, status, err); err != nil {
+		s.log.Error(err, "error encoding response")
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"time"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+)
+
+// ContextView is the API representation of an in-flight test context.
+type ContextView struct {
+	Namespace    string            `json:"namespace"`
+	TestName     string            `json:"test_name"`
+	Variant      string            `json:"variant"`
+	JobType      string            `json:"job_type"`
+	Pool         string            `json:"pool"`
+	NetworkType  string            `json:"network_type"`
+	Portgroup    string            `json:"portgroup"`
+	Topology     data.Topology     `json:"topology"`
+	Failed       bool              `json:"failed"`
+	FailedPods   []data.PodFailure `json:"failed_pods,omitempty"`
+	Steps        []data.Step       `json:"steps,omitempty"`
+	Created      time.Time         `json:"created"`
+	LeaseCreated time.Time         `json:"lease_created,omitempty"`
+	Leased       time.Time         `json:"leased,omitempty"`
+
+	ConcurrencyAtLease   *data.Concurrency `json:"concurrency_at_lease,omitempty"`
+	ConcurrencyAtFailure *data.Concurrency `json:"concurrency_at_failure,omitempty"`
+	ProwJob              *data.ProwJob     `json:"prowjob,omitempty"`
+}
+
+func newContextView(testContext *data.TestContext) ContextView {
+	return ContextView{
+		Namespace:    testContext.Namespace.Name,
+		TestName:     testContext.TestName(),
+		Variant:      testContext.Variant(),
+		JobType:      testContext.JobType(),
+		Pool:         testContext.Pool,
+		NetworkType:  testContext.NetworkType,
+		Portgroup:    testContext.Portgroup,
+		Topology:     testContext.Topology,
+		Failed:       testContext.Failed,
+		FailedPods:   testContext.FailedPods,
+		Steps:        testContext.Steps,
+		Created:      testContext.Namespace.CreationTimestamp.Time,
+		LeaseCreated: testContext.LeaseCreated,
+		Leased:       testContext.LeasedAt,
+
+		ConcurrencyAtLease:   testContext.ConcurrencyAtLease,
+		ConcurrencyAtFailure: testContext.ConcurrencyAtFailure,
+		ProwJob:              testContext.ProwJob,
+	}
+}
+
+// ListResponse is a page of items returned by the list endpoints.
+type ListResponse struct {
+	Items      interface{} `json:"items"`
+	Total      int         `json:"total"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
+	NextOffset *int        `json:"next_offset,omitempty"`
+}
+
+// StatsResponse holds the pass/fail summaries over a time window.
+type StatsResponse struct {
+	Since     time.Time   `json:"since"`
+	Until     time.Time   `json:"until"`
+	GroupBy   []string    `json:"group_by"`
+	Summaries interface{} `json:"summaries"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
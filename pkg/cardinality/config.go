@@ -0,0 +1,72 @@
+package cardinality
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultInterval = time.Minute
+
+// Config bounds the values of the labels of the guarded metric families.
+type Config struct {
+	// TTL is how long a series is kept after it was last incremented. Series never expire if zero.
+	TTL metav1.Duration `json:"ttl,omitempty"`
+	// Interval is how often expired series are dropped and series are counted.
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// Labels limits the values of labels by label name, in every guarded family with the label.
+	Labels map[string]LabelConfig `json:"labels,omitempty"`
+}
+
+// LabelConfig limits the values of a label. Values which are not allowed, or
+// exceed the limit, are replaced with "other".
+type LabelConfig struct {
+	// MaxValues is the number of distinct values kept at a time. Unlimited if zero.
+	MaxValues int `json:"max_values,omitempty"`
+	// Allow lists the regular expressions values must match. All values are allowed if empty.
+	Allow []string `json:"allow,omitempty"`
+	// Deny lists the regular expressions of values which are never kept.
+	Deny []string `json:"deny,omitempty"`
+}
+
+// LoadConfig reads the cardinality config from a YAML file and applies the defaults.
+func LoadConfig(filename string) (*Config, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+	}
+
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, fmt.Errorf("failed to decode cardinality config %s: %w", filename, err)
+	}
+	for name, label := range config.Labels {
+		if label.MaxValues < 0 {
+			return nil, fmt.Errorf("label %q has a negative max_values", name)
+		}
+		if _, err := compile(label.Allow); err != nil {
+			return nil, fmt.Errorf("invalid allow list of label %q: %w", name, err)
+		}
+		if _, err := compile(label.Deny); err != nil {
+			return nil, fmt.Errorf("invalid deny list of label %q: %w", name, err)
+		}
+	}
+	return config, nil
+}
+
+// compile compiles expressions which match whole label values.
+func compile(expressions []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, expression := range expressions {
+		re, err := regexp.Compile("^(?:" + expression + ")$")
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
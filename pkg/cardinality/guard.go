@@ -0,0 +1,257 @@
+package cardinality
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Other replaces the label values which are not allowed or exceed the limit of their label.
+const Other = "other"
+
+// seriesSeparator joins the label values of a series into a key.
+const seriesSeparator = "\xff"
+
+// Vec is a metric vector whose series can be deleted, e.g. a *prometheus.CounterVec.
+type Vec interface {
+	DeleteLabelValues(labelValues ...string) bool
+}
+
+// Guard bounds the number of series of the metric families registered with
+// it. Label values are limited as configured, and series which were not
+// incremented within the TTL are deleted. The number of series of every
+// family in the registry is reported as metric_series.
+type Guard struct {
+	Config *Config
+
+	labels   map[string]*labelGuard
+	families []*Family
+
+	seriesGauge     *prometheus.GaugeVec
+	overflowCounter *prometheus.CounterVec
+
+	mutex sync.Mutex
+
+	log logr.Logger
+}
+
+// labelGuard tracks the values of a label in use by the series of all guarded families.
+type labelGuard struct {
+	maxValues int
+	allow     []*regexp.Regexp
+	deny      []*regexp.Regexp
+	// values counts the series using each value.
+	values map[string]int
+}
+
+// Family is a metric family guarded by a guard.
+type Family struct {
+	name       string
+	labelNames []string
+	vec        Vec
+	// touched is when each series was last incremented, by the key of its label values.
+	touched map[string]time.Time
+
+	guard *Guard
+}
+
+func (g *Guard) SetupWithManager(mgr ctrl.Manager) error {
+	g.log = mgr.GetLogger().WithName("cardinality")
+	if g.Config == nil {
+		g.Config = &Config{}
+	}
+	if g.Config.Interval.Duration <= 0 {
+		g.Config.Interval.Duration = defaultInterval
+	}
+
+	g.labels = make(map[string]*labelGuard)
+	for name, config := range g.Config.Labels {
+		allow, err := compile(config.Allow)
+		if err != nil {
+			return fmt.Errorf("invalid allow list of label %q: %w", name, err)
+		}
+		deny, err := compile(config.Deny)
+		if err != nil {
+			return fmt.Errorf("invalid deny list of label %q: %w", name, err)
+		}
+		g.labels[name] = &labelGuard{
+			maxValues: config.MaxValues,
+			allow:     allow,
+			deny:      deny,
+			values:    make(map[string]int),
+		}
+	}
+
+	g.seriesGauge = monitor.MetricSeries.NewGaugeVec()
+	g.overflowCounter = monitor.MetricLabelOverflows.NewCounterVec()
+	if err := monitor.MetricSeries.Register(g.seriesGauge); err != nil {
+		return fmt.Errorf("error registering metric series metric: %w", err)
+	}
+	if err := monitor.MetricLabelOverflows.Register(g.overflowCounter); err != nil {
+		return fmt.Errorf("error registering label overflow metric: %w", err)
+	}
+
+	if err := mgr.Add(g); err != nil {
+		return fmt.Errorf("error adding cardinality guard to manager: %w", err)
+	}
+	return nil
+}
+
+// Family guards the series of a metric family. The label names must be in
+// the order of the label values passed to Bound. A nil guard returns a nil
+// family, which leaves label values unchanged.
+func (g *Guard) Family(name string, vec Vec, labelNames []string) *Family {
+	if g == nil {
+		return nil
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	family := &Family{
+		name:       name,
+		labelNames: labelNames,
+		vec:        vec,
+		touched:    make(map[string]time.Time),
+		guard:      g,
+	}
+	g.families = append(g.families, family)
+	return family
+}
+
+// Bound returns the label values a series is incremented with, replacing
+// values which are not allowed or exceed the limit of their label with other,
+// and records that the series was incremented.
+func (f *Family) Bound(labelValues []string) []string {
+	if f == nil {
+		return labelValues
+	}
+	g := f.guard
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	bounded := make([]string, len(labelValues))
+	for i, value := range labelValues {
+		bounded[i] = value
+		if i >= len(f.labelNames) {
+			continue
+		}
+		if label, guarded := g.labels[f.labelNames[i]]; guarded && !label.admits(value) {
+			bounded[i] = Other
+			g.overflowCounter.WithLabelValues(f.name, f.labelNames[i]).Inc()
+		}
+	}
+
+	key := strings.Join(bounded, seriesSeparator)
+	if _, exists := f.touched[key]; !exists {
+		f.forEachGuarded(bounded, func(label *labelGuard, value string) {
+			label.values[value]++
+		})
+	}
+	f.touched[key] = time.Now()
+	return bounded
+}
+
+// admits returns true if a value may be used. Values already in use are
+// always admitted, new values only while the label is below its limit.
+func (l *labelGuard) admits(value string) bool {
+	if _, used := l.values[value]; used {
+		return true
+	}
+	if len(l.allow) > 0 && !matchesAny(l.allow, value) {
+		return false
+	}
+	if matchesAny(l.deny, value) {
+		return false
+	}
+	return l.maxValues == 0 || len(l.values) < l.maxValues
+}
+
+func matchesAny(expressions []*regexp.Regexp, value string) bool {
+	for _, expression := range expressions {
+		if expression.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachGuarded calls fn with the values of the guarded labels of a series.
+// The other bucket does not count towards the limit of a label.
+func (f *Family) forEachGuarded(labelValues []string, fn func(label *labelGuard, value string)) {
+	for i, value := range labelValues {
+		if i >= len(f.labelNames) || value == Other {
+			continue
+		}
+		if label, guarded := f.guard.labels[f.labelNames[i]]; guarded {
+			fn(label, value)
+		}
+	}
+}
+
+// Start drops expired series and counts the series of every family each
+// interval until the context is cancelled.
+func (g *Guard) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		g.expire(time.Now())
+		g.countSeries()
+	}, g.Config.Interval.Duration)
+	return nil
+}
+
+// NeedLeaderElection bounds the series of every replica.
+func (g *Guard) NeedLeaderElection() bool {
+	return false
+}
+
+// expire deletes the series which were not incremented within the TTL.
+func (g *Guard) expire(now time.Time) {
+	if g.Config.TTL.Duration <= 0 {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, family := range g.families {
+		expired := 0
+		for key, touched := range family.touched {
+			if now.Sub(touched) <= g.Config.TTL.Duration {
+				continue
+			}
+			labelValues := strings.Split(key, seriesSeparator)
+			family.vec.DeleteLabelValues(labelValues...)
+			family.forEachGuarded(labelValues, func(label *labelGuard, value string) {
+				if label.values[value]--; label.values[value] <= 0 {
+					delete(label.values, value)
+				}
+			})
+			delete(family.touched, key)
+			expired++
+		}
+		if expired > 0 {
+			g.log.V(1).Info("expired series", "family", family.name, "count", expired)
+		}
+	}
+}
+
+// countSeries reports the number of series of every family in the registry.
+func (g *Guard) countSeries() {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		// a partial result is still worth reporting
+		g.log.Error(err, "error gathering metrics")
+	}
+	g.seriesGauge.Reset()
+	for _, family := range families {
+		g.seriesGauge.WithLabelValues(family.GetName()).Set(float64(len(family.GetMetric())))
+	}
+}
@@ -0,0 +1,188 @@
+package changepoint
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// warmupRuns is the number of runs used to estimate the baseline failure
+	// rate of a series before shifts are looked for.
+	warmupRuns = 30
+
+	// oddsRatio is the shift in the odds of failure the CUSUM is tuned to detect,
+	// in either direction.
+	oddsRatio = 2.0
+
+	// threshold is the log-likelihood ratio at which a shift is declared.
+	threshold = 5.0
+
+	minRate = 0.01
+	maxRate = 0.99
+)
+
+// Direction of a shift in failure rate.
+const (
+	DirectionIncrease = "increase"
+	DirectionDecrease = "decrease"
+)
+
+type observation struct {
+	time   time.Time
+	failed bool
+}
+
+// shift is a change in failure rate found by a CUSUM.
+type shift struct {
+	direction string
+	changedAt time.Time
+	baseline  float64
+	shifted   float64
+	runs      int
+}
+
+// cusum is a two sided Bernoulli CUSUM over the outcomes of a series of runs.
+// After a shift is detected the baseline is re-estimated from the runs since
+// the change so that a sustained shift is only reported once.
+type cusum struct {
+	baseline     float64
+	warmedUp     bool
+	upper        float64
+	lower        float64
+	upperStart   int
+	lowerStart   int
+	observations []observation
+}
+
+// observe adds the outcome of a run and returns the shift it completes, if any.
+func (c *cusum) observe(completed time.Time, failed bool) *shift {
+	c.observations = append(c.observations, observation{time: completed, failed: failed})
+
+	if !c.warmedUp {
+		if len(c.observations) >= warmupRuns {
+			c.reset(smoothedFailureRate(c.observations))
+		}
+		return nil
+	}
+
+	idx := len(c.observations) - 1
+	if c.upper == 0 {
+		c.upperStart = idx
+	}
+	if c.lower == 0 {
+		c.lowerStart = idx
+	}
+	c.upper = math.Max(0, c.upper+logLikelihoodRatio(c.baseline, shiftRate(c.baseline, oddsRatio), failed))
+	c.lower = math.Max(0, c.lower+logLikelihoodRatio(c.baseline, shiftRate(c.baseline, 1/oddsRatio), failed))
+
+	switch {
+	case c.upper > threshold:
+		return c.detect(DirectionIncrease, c.upperStart)
+	case c.lower > threshold:
+		return c.detect(DirectionDecrease, c.lowerStart)
+	case c.upper == 0 && c.lower == 0:
+		// no excursion in progress, the runs so far can no longer start one
+		c.observations = c.observations[:0]
+	}
+	return nil
+}
+
+// detect reports the shift found by the excursion which began at start and
+// restarts the CUSUM from the change.
+func (c *cusum) detect(direction string, start int) *shift {
+	since := c.observations[start+c.changeOffset(direction, start):]
+	detected := &shift{
+		direction: direction,
+		changedAt: since[0].time,
+		baseline:  c.baseline,
+		shifted:   failureRate(since),
+		runs:      len(since),
+	}
+
+	c.observations = append([]observation(nil), since...)
+	if len(c.observations) >= warmupRuns {
+		c.reset(smoothedFailureRate(c.observations))
+	} else {
+		c.warmedUp = false
+	}
+	return detected
+}
+
+// changeOffset returns the most likely change within the excursion which
+// began at start: the run from which on the observed failure rate diverges
+// the most from the baseline, weighed by the number of runs since.
+func (c *cusum) changeOffset(direction string, start int) int {
+	excursion := c.observations[start:]
+
+	offset := 0
+	var best float64
+	failures := 0
+	for i := len(excursion) - 1; i >= 0; i-- {
+		if excursion[i].failed {
+			failures++
+		}
+		runs := len(excursion) - i
+		rate := float64(failures) / float64(runs)
+		if (direction == DirectionIncrease) != (rate > c.baseline) {
+			continue
+		}
+		if divergence := float64(runs) * klDivergence(rate, c.baseline); divergence > best {
+			best = divergence
+			offset = i
+		}
+	}
+	return offset
+}
+
+func (c *cusum) reset(baseline float64) {
+	c.baseline = math.Min(maxRate, math.Max(minRate, baseline))
+	c.warmedUp = true
+	c.upper, c.lower = 0, 0
+	c.observations = c.observations[:0]
+}
+
+// shiftRate applies an odds ratio to a failure rate.
+func shiftRate(rate, ratio float64) float64 {
+	odds := rate / (1 - rate) * ratio
+	return odds / (1 + odds)
+}
+
+// logLikelihoodRatio of an outcome under the shifted rate versus the baseline rate.
+func logLikelihoodRatio(baseline, shifted float64, failed bool) float64 {
+	if failed {
+		return math.Log(shifted / baseline)
+	}
+	return math.Log((1 - shifted) / (1 - baseline))
+}
+
+// klDivergence of a Bernoulli distribution with rate p from one with rate q.
+func klDivergence(p, q float64) float64 {
+	var divergence float64
+	if p > 0 {
+		divergence += p * math.Log(p/q)
+	}
+	if p < 1 {
+		divergence += (1 - p) * math.Log((1-p)/(1-q))
+	}
+	return divergence
+}
+
+// smoothedFailureRate estimates a failure rate with Laplace smoothing so that
+// a short streak of passes does not produce a baseline of zero.
+func smoothedFailureRate(observations []observation) float64 {
+	failures := failureRate(observations) * float64(len(observations))
+	return (failures + 1) / float64(len(observations)+2)
+}
+
+func failureRate(observations []observation) float64 {
+	if len(observations) == 0 {
+		return 0
+	}
+	failures := 0
+	for _, o := range observations {
+		if o.failed {
+			failures++
+		}
+	}
+	return float64(failures) / float64(len(observations))
+}
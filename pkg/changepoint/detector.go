@@ -0,0 +1,302 @@
+package changepoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/pools"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	changePointsFilename = "change_points.json"
+
+	defaultInterval = time.Minute
+
+	// changePointRetention matches the retention of the run ledger the change points are detected from.
+	changePointRetention = 30 * 24 * time.Hour
+)
+
+// ChangePoint is a detected shift in the failure rate of a pool or portgroup.
+type ChangePoint struct {
+	// Dimension is either ledger.DimensionPool or ledger.DimensionPortgroup.
+	Dimension string `json:"dimension"`
+	Name      string `json:"name"`
+	// Pool is the pool of the most recent run of the series.
+	Pool      string `json:"pool"`
+	Direction string `json:"direction"`
+	// ChangedAt is when the first run after the shift completed.
+	ChangedAt  time.Time `json:"changed_at"`
+	DetectedAt time.Time `json:"detected_at"`
+
+	BaselineFailureRate float64 `json:"baseline_failure_rate"`
+	ShiftedFailureRate  float64 `json:"shifted_failure_rate"`
+	// Runs is the number of runs since the shift that led to its detection.
+	Runs int `json:"runs"`
+}
+
+func (c *ChangePoint) key() string {
+	return fmt.Sprintf("%s/%s/%s/%d", c.Dimension, c.Name, c.Direction, c.ChangedAt.Unix())
+}
+
+// Detector feeds completed runs from the run ledger into a CUSUM per pool and
+// per portgroup and records the shifts they detect.
+type Detector struct {
+	client.Client
+	Recorder record.EventRecorder
+
+	// Interval is how often the run ledger is checked for newly completed runs.
+	Interval time.Duration
+
+	series       map[string]*cusum
+	changePoints []ChangePoint
+	known        map[string]bool
+
+	// revision is the revision of the run ledger processed last. Runs reach
+	// the ledger out of order of completion, so they are followed by revision.
+	revision uint64
+	// filename is where the change points are saved.
+	filename string
+
+	testContext *testcontext.TestContextService
+	mutex       sync.Mutex
+
+	log logr.Logger
+}
+
+func (d *Detector) SetupWithManager(mgr ctrl.Manager,
+	testContext *testcontext.TestContextService) error {
+	d.testContext = testContext
+	d.Client = mgr.GetClient()
+	d.Recorder = mgr.GetEventRecorderFor("change-point-detector")
+	d.log = mgr.GetLogger().WithName("changepoint")
+	if d.Interval <= 0 {
+		d.Interval = defaultInterval
+	}
+
+	d.series = make(map[string]*cusum)
+	d.known = make(map[string]bool)
+	d.filename = path.Join(testContext.Directory, changePointsFilename)
+	if err := d.Restore(d.filename); err != nil {
+		d.log.Error(err, "error restoring change points")
+	}
+
+	if err := mgr.Add(d); err != nil {
+		return fmt.Errorf("error adding change point detector to manager: %w", err)
+	}
+	return nil
+}
+
+// SetupWithServer lists the detected change points through the API.
+func (d *Detector) SetupWithServer(server *api.Server) {
+	server.Handle("GET /api/v1/changepoints", http.HandlerFunc(d.listChangePoints))
+}
+
+// Start processes newly completed runs every interval until the context is cancelled.
+func (d *Detector) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, d.update, d.Interval)
+	return nil
+}
+
+// ChangePoints returns the detected change points, most recent first.
+func (d *Detector) ChangePoints() []ChangePoint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	changePoints := append([]ChangePoint(nil), d.changePoints...)
+	sort.Slice(changePoints, func(i, j int) bool {
+		return changePoints[i].ChangedAt.After(changePoints[j].ChangedAt)
+	})
+	return changePoints
+}
+
+func (d *Detector) update(ctx context.Context) {
+	runs, revision := d.testContext.RunChanges(d.revision)
+
+	var detected []ChangePoint
+	for i := range runs {
+		run := &runs[i]
+		// runs updated after they were observed are not observed twice
+		if run.Sequence <= d.revision {
+			continue
+		}
+		for _, dimension := range []string{ledger.DimensionPool, ledger.DimensionPortgroup} {
+			if changePoint := d.observe(run, dimension); changePoint != nil {
+				detected = append(detected, *changePoint)
+			}
+		}
+	}
+	d.revision = revision
+
+	if len(detected) == 0 {
+		return
+	}
+	d.expire(time.Now())
+	if err := d.Save(d.filename); err != nil {
+		d.log.Error(err, "error saving change points")
+	}
+	for _, changePoint := range detected {
+		d.emit(ctx, changePoint)
+	}
+}
+
+// observe feeds the run into the series of the dimension and returns a newly detected change point.
+func (d *Detector) observe(run *data.RunRecord, dimension string) *ChangePoint {
+	name, err := ledger.DimensionValue(run, dimension)
+	if err != nil || len(name) == 0 {
+		return nil
+	}
+
+	key := dimension + "/" + name
+	series, exists := d.series[key]
+	if !exists {
+		series = &cusum{}
+		d.series[key] = series
+	}
+
+	detected := series.observe(run.Completed, run.Failed)
+	if detected == nil {
+		return nil
+	}
+
+	changePoint := ChangePoint{
+		Dimension:           dimension,
+		Name:                name,
+		Pool:                run.Pool,
+		Direction:           detected.direction,
+		ChangedAt:           detected.changedAt,
+		DetectedAt:          time.Now(),
+		BaselineFailureRate: detected.baseline,
+		ShiftedFailureRate:  detected.shifted,
+		Runs:                detected.runs,
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// change points replayed from the ledger after a restart were already reported
+	if d.known[changePoint.key()] {
+		return nil
+	}
+	d.known[changePoint.key()] = true
+	d.changePoints = append(d.changePoints, changePoint)
+	return &changePoint
+}
+
+// expire drops change points older than the run ledger retention.
+func (d *Detector) expire(now time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	changePoints := d.changePoints[:0]
+	for _, changePoint := range d.changePoints {
+		if now.Sub(changePoint.ChangedAt) > changePointRetention {
+			delete(d.known, changePoint.key())
+			continue
+		}
+		changePoints = append(changePoints, changePoint)
+	}
+	d.changePoints = changePoints
+}
+
+// emit records an Event on the pool the change point belongs to.
+func (d *Detector) emit(ctx context.Context, changePoint ChangePoint) {
+	d.log.Info("failure rate shift detected", "dimension", changePoint.Dimension, "name", changePoint.Name,
+		"direction", changePoint.Direction, "changedAt", changePoint.ChangedAt,
+		"baseline", changePoint.BaselineFailureRate, "shifted", changePoint.ShiftedFailureRate)
+
+	pool, err := pools.Get(ctx, d.Client, changePoint.Pool)
+	if err != nil {
+		d.log.Error(err, "unable to find pool for change point event", "pool", changePoint.Pool)
+		return
+	}
+
+	eventType, reason := corev1.EventTypeWarning, "FailureRateIncreased"
+	if changePoint.Direction == DirectionDecrease {
+		eventType, reason = corev1.EventTypeNormal, "FailureRateDecreased"
+	}
+	d.Recorder.Eventf(pool, eventType, reason, "failure rate of %s %s shifted from %.0f%% to %.0f%% at %s",
+		changePoint.Dimension, changePoint.Name, changePoint.BaselineFailureRate*100,
+		changePoint.ShiftedFailureRate*100, changePoint.ChangedAt.UTC().Format(time.RFC3339))
+}
+
+// Save saves the detected change points to a file
+func (d *Detector) Save(filename string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(d.changePoints); err != nil {
+		return fmt.Errorf("failed to encode change points: %w", err)
+	}
+	return nil
+}
+
+// Restore restores the detected change points from a file
+func (d *Detector) Restore(filename string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&d.changePoints); err != nil {
+		return fmt.Errorf("failed to decode change points: %w", err)
+	}
+	for _, changePoint := range d.changePoints {
+		d.known[changePoint.key()] = true
+	}
+
+	d.log.Info("Successfully restored change points", "filename", filename, "count", len(d.changePoints))
+	return nil
+}
+
+func (d *Detector) listChangePoints(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	dimension, name := query.Get("dimension"), query.Get("name")
+
+	changePoints := []ChangePoint{}
+	for _, changePoint := range d.ChangePoints() {
+		if len(dimension) > 0 && dimension != changePoint.Dimension {
+			continue
+		}
+		if len(name) > 0 && name != changePoint.Name {
+			continue
+		}
+		changePoints = append(changePoints, changePoint)
+	}
+
+	if err := api.WriteJSON(w, http.StatusOK, changePoints); err != nil {
+		d.log.Error(err, "error encoding response")
+	}
+}
@@ -0,0 +1,78 @@
+package context
+
+import (
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// metricsPath is the path the metrics server of controller-runtime serves the metrics on.
+const metricsPath = "/metrics"
+
+// runExemplar returns the exemplar linking a counter increment to the job run
+// of a test context. OpenMetrics limits the labels of an exemplar to 128
+// runes, which a job URL alone exceeds, so the exemplar holds the prow job ID
+// a dashboard builds the link to the job from. Labels are added in order of
+// importance while they fit.
+func runExemplar(testContext *data.TestContext) prometheus.Labels {
+	job := data.NewJob(testContext.Namespace)
+	prowJobID := job.ProwJobID
+	if testContext.ProwJob != nil && len(testContext.ProwJob.Name) > 0 {
+		prowJobID = testContext.ProwJob.Name
+	}
+
+	exemplar := prometheus.Labels{}
+	runes := 0
+	for _, label := range [][2]string{
+		{"prowjob_id", prowJobID},
+		{"build_id", job.BuildID},
+		{"namespace", testContext.Namespace.Name},
+	} {
+		if len(label[1]) == 0 {
+			continue
+		}
+		length := utf8.RuneCountInString(label[0]) + utf8.RuneCountInString(label[1])
+		if runes+length > prometheus.ExemplarMaxRunes {
+			continue
+		}
+		exemplar[label[0]] = label[1]
+		runes += length
+	}
+	return exemplar
+}
+
+// inc increments a counter, with an exemplar if it has any labels.
+func inc(counter prometheus.Counter, exemplar prometheus.Labels) {
+	if adder, ok := counter.(prometheus.ExemplarAdder); ok && len(exemplar) > 0 {
+		adder.AddWithExemplar(1, exemplar)
+		return
+	}
+	counter.Inc()
+}
+
+// OpenMetricsFilter is a filter provider of the metrics server which lets
+// /metrics negotiate the OpenMetrics format, which the handler of the metrics
+// server never serves. Exemplars are only exposed in the OpenMetrics format;
+// scrapers which do not accept it still get the text format.
+func OpenMetricsFilter(*rest.Config, *http.Client) (metricsserver.Filter, error) {
+	negotiating := promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{
+		ErrorHandling:     promhttp.HTTPErrorOnError,
+		EnableOpenMetrics: true,
+	})
+	return func(log logr.Logger, handler http.Handler) (http.Handler, error) {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != metricsPath {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			negotiating.ServeHTTP(w, r)
+		}), nil
+	}, nil
+}
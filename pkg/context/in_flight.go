@@ -0,0 +1,99 @@
+package context
+
+import (
+	"time"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// inFlightCollector derives gauges from the live test contexts and leases
+// each time it is scraped so that they always agree with the tracked state.
+type inFlightCollector struct {
+	service *TestContextService
+
+	running *prometheus.Desc
+	failed  *prometheus.Desc
+	stuck   *prometheus.Desc
+	oldest  *prometheus.Desc
+	leaked  *prometheus.Desc
+}
+
+func newInFlightCollector(service *TestContextService) *inFlightCollector {
+	return &inFlightCollector{
+		service: service,
+		running: monitor.RunsInFlight.NewDesc(),
+		failed:  monitor.RunsFailedInFlight.NewDesc(),
+		stuck:   monitor.RunsStuck.NewDesc(),
+		oldest:  monitor.OldestRunAge.NewDesc(),
+		leaked:  monitor.LeasesLeaked.NewDesc(),
+	}
+}
+
+func (c *inFlightCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.running
+	ch <- c.failed
+	ch <- c.stuck
+	ch <- c.oldest
+	ch <- c.leaked
+}
+
+func (c *inFlightCollector) Collect(ch chan<- prometheus.Metric) {
+	type counts struct {
+		running, failed, stuck int
+	}
+	now := time.Now()
+	groups := make(map[[3]string]*counts)
+	var oldest time.Duration
+
+	c.service.mutex.Lock()
+	for _, testContext := range c.service.testContexts {
+		if !testContext.IsTestRun() {
+			continue
+		}
+		key := [3]string{orUndefined(testContext.Pool), orUndefined(testContext.NetworkType), orUndefined(testContext.Portgroup)}
+		group, exists := groups[key]
+		if !exists {
+			group = &counts{}
+			groups[key] = group
+		}
+
+		group.running++
+		if testContext.Failed {
+			group.failed++
+		}
+
+		created := testContext.Namespace.CreationTimestamp
+		if created.IsZero() {
+			continue
+		}
+		age := now.Sub(created.Time)
+		oldest = max(oldest, age)
+		if c.service.StuckRunAge > 0 && age > c.service.StuckRunAge {
+			group.stuck++
+		}
+	}
+	c.service.mutex.Unlock()
+
+	for key, group := range groups {
+		ch <- prometheus.MustNewConstMetric(c.running, prometheus.GaugeValue, float64(group.running), key[:]...)
+		ch <- prometheus.MustNewConstMetric(c.failed, prometheus.GaugeValue, float64(group.failed), key[:]...)
+		ch <- prometheus.MustNewConstMetric(c.stuck, prometheus.GaugeValue, float64(group.stuck), key[:]...)
+	}
+	ch <- prometheus.MustNewConstMetric(c.oldest, prometheus.GaugeValue, oldest.Seconds())
+
+	leaked := make(map[string]int)
+	for _, lease := range c.service.GetLeakedLeases(LeaseLeakGracePeriod) {
+		leaked[orUndefined(lease.Pool)]++
+	}
+	for pool, count := range leaked {
+		ch <- prometheus.MustNewConstMetric(c.leaked, prometheus.GaugeValue, float64(count), pool)
+	}
+}
+
+func orUndefined(value string) string {
+	if len(value) == 0 {
+		return "undefined"
+	}
+	return value
+}
@@ -6,12 +6,12 @@ import (
 	"os"
 	"sync"
 
-	"github.com/openshift-splat-team/vsphere-capacity-manager/pkg/controller"
+	"github.com/openshift-splat-team/test-monitor/pkg/cardinality"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
-	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
@@ -19,45 +19,42 @@ import (
 type MetricsSnapshot struct {
 	PassCounters map[string]float64 `json:"pass_counters"`
 	FailCounters map[string]float64 `json:"fail_counters"`
+	CorrectionCounters map[string]float64 `json:"correction_counters,omitempty"`
 	PodCounters  map[string]float64 `json:"pod_counters"`
 }
 
 type MetricsContext struct {
+	// Guard bounds the series of the counters. They are unbounded if nil.
+	Guard *cardinality.Guard
+
 	passCounter *prometheus.CounterVec
 	failCounter *prometheus.CounterVec
+	correctionCounter *prometheus.CounterVec
 	podCounter *prometheus.CounterVec
+	passSeries  *cardinality.Family
+	failSeries  *cardinality.Family
+	correctionSeries *cardinality.Family
+	podSeries   *cardinality.Family
 	mutex       *sync.Mutex
 }
 
 func (t *MetricsContext) Initialize() {
-	t.passCounter = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "prow_ci_test_passes",
-			Help: "The total number of passes for a given prow variant.",
-		},
-		[]string{"test_name", "variant", "job_type", "pool", "network_type", "vlan"},
-	)
-	
-	t.failCounter = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "prow_ci_test_fails",
-			Help: "The total number of fails for a given prow variant.",
-		},
-		[]string{"test_name", "variant", "job_type", "pool", "network_type", "vlan"},
-	)
-
-	t.podCounter = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "prow_ci_pod_failures",
-			Help: "The total number of pod failures for a given prow variant.",
-		},
-		[]string{"test_name", "variant", "pod_name", "node_name"},
-	)
+	t.passCounter = monitor.RunPasses.NewCounterVec()
+	t.failCounter = monitor.RunFails.NewCounterVec()
+	t.correctionCounter = monitor.RunCorrections.NewCounterVec()
+	t.podCounter = monitor.PodFailures.NewCounterVec()
+
+	t.passSeries = t.Guard.Family(monitor.RunPasses.Name, t.passCounter, monitor.RunPasses.Labels)
+	t.failSeries = t.Guard.Family(monitor.RunFails.Name, t.failCounter, monitor.RunFails.Labels)
+	t.correctionSeries = t.Guard.Family(monitor.RunCorrections.Name, t.correctionCounter, monitor.RunCorrections.Labels)
+	t.podSeries = t.Guard.Family(monitor.PodFailures.Name, t.podCounter, monitor.PodFailures.Labels)
 
 	t.mutex = &sync.Mutex{}
 
-	metrics.Registry.MustRegister(t.passCounter, t.failCounter, t.podCounter)	
-	controller.InitMetrics()
+	monitor.RunPasses.MustRegister(t.passCounter)
+	monitor.RunFails.MustRegister(t.failCounter)
+	monitor.RunCorrections.MustRegister(t.correctionCounter)
+	monitor.PodFailures.MustRegister(t.podCounter)
 }
 
 // SaveMetrics saves the current metrics to a file
@@ -69,6 +66,7 @@ func (t *MetricsContext) SaveMetrics(filename string) error {
 	snapshot := MetricsSnapshot{
 		PassCounters: make(map[string]float64),
 		FailCounters: make(map[string]float64),
+		CorrectionCounters: make(map[string]float64),
 		PodCounters:  make(map[string]float64),
 	}
 
@@ -81,11 +79,13 @@ func (t *MetricsContext) SaveMetrics(filename string) error {
 	// Extract counter values
 	for _, mf := range metricFamilies {
 		switch mf.GetName() {
-		case "prow_ci_test_passes":
+		case monitor.RunPasses.Name:
 			snapshot.PassCounters = extractCounterValues(mf)
-		case "prow_ci_test_fails":
+		case monitor.RunFails.Name:
 			snapshot.FailCounters = extractCounterValues(mf)
-		case "prow_ci_pod_failures":
+		case monitor.RunCorrections.Name:
+			snapshot.CorrectionCounters = extractCounterValues(mf)
+		case monitor.PodFailures.Name:
 			snapshot.PodCounters = extractCounterValues(mf)
 		}
 	}
@@ -132,6 +132,9 @@ func (t *MetricsContext) RestoreMetrics(filename string) error {
 	if err := t.restoreCounterValues(t.failCounter, snapshot.FailCounters); err != nil {
 		return fmt.Errorf("failed to restore fail counters: %w", err)
 	}
+	if err := t.restoreCounterValues(t.correctionCounter, snapshot.CorrectionCounters); err != nil {
+		return fmt.Errorf("failed to restore correction counters: %w", err)
+	}
 	if err := t.restoreCounterValues(t.podCounter, snapshot.PodCounters); err != nil {
 		return fmt.Errorf("failed to restore pod counters: %w", err)
 	}
@@ -221,24 +224,35 @@ func (t *MetricsContext) SaveMetricsPrometheusFormat(filename string) error {
 }
 
 // PodFailed increments the pod failure counter for a given pod and test name.
-func (t *MetricsContext) PodFailed(pod corev1.Pod, testName string, variant string) {
+// The exemplar links the increment to the job run the pod belonged to.
+func (t *MetricsContext) PodFailed(failure data.PodFailure, testName string, variant string, exemplar prometheus.Labels) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()	
-	promLabels := []string{testName, variant, pod.Name, pod.Spec.NodeName}
-	t.podCounter.WithLabelValues(promLabels...).Add(1)
+	promLabels := t.podSeries.Bound([]string{testName, variant, failure.Name, failure.NodeName})
+	inc(t.podCounter.WithLabelValues(promLabels...), exemplar)
 }
 
 // Pass increments the pass counter for a given test name and variant.
-func (t *MetricsContext) Pass(promLabels []string) {
+func (t *MetricsContext) Pass(promLabels []string, exemplar prometheus.Labels) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()	
-	t.passCounter.WithLabelValues(promLabels...).Add(1)
+	inc(t.passCounter.WithLabelValues(t.passSeries.Bound(promLabels)...), exemplar)
+}
+
+// Fail increments the fail counter for a given test name and variant. The
+// exemplar links the increment to the failed job run.
+func (t *MetricsContext) Fail(promLabels []string, exemplar prometheus.Labels) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	inc(t.failCounter.WithLabelValues(t.failSeries.Bound(promLabels)...), exemplar)
 }
 
-// Fail increments the fail counter for a given test name and variant.
-func (t *MetricsContext) Fail(promLabels []string) {
+// Correct counts a completed run whose outcome was corrected to the given
+// outcome after it was counted as passed or failed.
+func (t *MetricsContext) Correct(promLabels []string, outcome string) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	t.failCounter.WithLabelValues(promLabels...).Add(1)
+	t.correctionCounter.WithLabelValues(t.correctionSeries.Bound(append(promLabels, outcome))...).Inc()
 }
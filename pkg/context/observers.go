@@ -0,0 +1,57 @@
+package context
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/observer"
+)
+
+// metricsObserver counts pod failures and completed runs.
+type metricsObserver struct {
+	observer.NopObserver
+	metricsContext *MetricsContext
+	log            logr.Logger
+}
+
+func (m *metricsObserver) OnPodFailed(testContext *data.TestContext, failure data.PodFailure) {
+	m.metricsContext.PodFailed(failure, testContext.TestName(), testContext.Variant(), runExemplar(testContext))
+}
+
+func (m *metricsObserver) OnRunCompleted(testContext *data.TestContext, run data.RunRecord) {
+	promLabels, err := promLabelValues(testContext)
+	if err != nil {
+		m.log.Error(err, "error getting prom labels", "namespace", run.Namespace)
+		return
+	}
+	exemplar := runExemplar(testContext)
+	if run.Failed {
+		m.metricsContext.Fail(promLabels, exemplar)
+	} else {
+		m.metricsContext.Pass(promLabels, exemplar)
+	}
+}
+
+// OnRunCorrected counts the correction rather than moving the run between
+// the pass and fail counters, which cannot be decremented.
+func (m *metricsObserver) OnRunCorrected(run data.RunRecord) {
+	promLabels, err := runLabelValues(&run)
+	if err != nil {
+		m.log.Error(err, "error getting prom labels", "namespace", run.Namespace)
+		return
+	}
+	m.metricsContext.Correct(promLabels, run.Result())
+}
+
+// ledgerObserver adds completed runs to the run ledger.
+type ledgerObserver struct {
+	observer.NopObserver
+	runLedger *ledger.Ledger
+	log       logr.Logger
+}
+
+func (l *ledgerObserver) OnRunCompleted(testContext *data.TestContext, run data.RunRecord) {
+	if err := l.runLedger.Record(run); err != nil {
+		l.log.Error(err, "error recording run", "namespace", run.Namespace)
+	}
+}
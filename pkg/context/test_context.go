@@ -5,19 +5,58 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/cardinality"
 	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/openshift-splat-team/test-monitor/pkg/observer"
 	v1 "github.com/openshift-splat-team/vsphere-capacity-manager/pkg/apis/vspherecapacitymanager.splat.io/v1"
 	corev1 "k8s.io/api/core/v1"
 )
 
-const testContextsFilename = "/context/test_contexts.json"
+const (
+	// DefaultDirectory is where the state of the monitor is kept across restarts.
+	DefaultDirectory     = "/context"
+	testContextsFilename = "test_contexts.json"
+	runLedgerFilename    = "run_ledger.jsonl"
+
+	// runLedgerRetention is how long completed runs are kept in the run ledger.
+	runLedgerRetention = 30 * 24 * time.Hour
+
+	// LeaseLeakGracePeriod is how long a lease may outlive its test namespace
+	// before it is considered leaked.
+	LeaseLeakGracePeriod = 15 * time.Minute
+
+	// prowJobRetention is how long the final state of a prow job is kept for
+	// the namespace of its test to complete.
+	prowJobRetention = 24 * time.Hour
+)
 
 type TestContextService struct {
+	// Directory keeps the test contexts and the run ledger across restarts. It defaults to /context.
+	Directory string
+	// StuckRunAge is the age after which an in-flight test context is reported as stuck.
+	StuckRunAge time.Duration
+	// Cardinality bounds the series of the run and pod failure counters. They are unbounded if nil.
+	Cardinality *cardinality.Guard
+	// Observers are notified of the lifecycle of test contexts once the lock of
+	// the service is released. The run metrics and the run ledger are
+	// registered by Initialize as synchronous observers, so their
+	// notifications are never dropped. A registry is created if nil.
+	Observers *observer.Registry
+
 	testContexts   map[string]*data.TestContext
+	leases         map[string]*data.LeaseRecord
+	prowJobs       map[string]*data.ProwJob
+	// jobs indexes the namespaces of the test contexts by their ProwJobKeys.
+	jobs           map[string]string
 	metricsContext *MetricsContext
+	runLedger      *ledger.Ledger
 	mutex          *sync.Mutex
 	log 			logr.Logger
 }
@@ -25,13 +64,33 @@ type TestContextService struct {
 func (t *TestContextService) Initialize(log logr.Logger) {
 	t.log = log
 	t.testContexts = make(map[string]*data.TestContext)
+	t.leases = make(map[string]*data.LeaseRecord)
+	t.prowJobs = make(map[string]*data.ProwJob)
+	t.jobs = make(map[string]string)
 	t.mutex = &sync.Mutex{}
-	err := t.Restore(testContextsFilename)
+	if len(t.Directory) == 0 {
+		t.Directory = DefaultDirectory
+	}
+	err := t.Restore(path.Join(t.Directory, testContextsFilename))
 	if err != nil {
 		log.Error(err, "error restoring test contexts")
 	}	
-	t.metricsContext = &MetricsContext{}
+	t.metricsContext = &MetricsContext{Guard: t.Cardinality}
 	t.metricsContext.Initialize()
+	monitor.RunsInFlight.MustRegister(newInFlightCollector(t))
+	t.runLedger = &ledger.Ledger{}
+	err = t.runLedger.Initialize(log, path.Join(t.Directory, runLedgerFilename), runLedgerRetention)
+	if err != nil {
+		log.Error(err, "error restoring run ledger")
+	}
+	if t.Observers == nil {
+		t.Observers = &observer.Registry{}
+		if err := t.Observers.Initialize(log.WithName("observer")); err != nil {
+			log.Error(err, "error initializing run observer registry")
+		}
+	}
+	t.Observers.RegisterSync("metrics", &metricsObserver{metricsContext: t.metricsContext, log: log})
+	t.Observers.RegisterSync("ledger", &ledgerObserver{runLedger: t.runLedger, log: log})
 }
 
 // SaveTestContexts saves all test contexts to a file
@@ -87,6 +146,9 @@ func (t *TestContextService) Restore(filename string) error {
 	if t.testContexts == nil {
 		t.testContexts = make(map[string]*data.TestContext)
 	}
+	for _, testContext := range t.testContexts {
+		t.indexJob(testContext)
+	}
 
 	t.log.Info("Successfully restored test contexts", "filename", filename, "count", len(t.testContexts))
 	return nil
@@ -107,20 +169,63 @@ func (t *TestContextService) GetTestContextSnapshot() map[string]*data.TestConte
 
 	snapshot := make(map[string]*data.TestContext, len(t.testContexts))
 	for key, value := range t.testContexts {
-		// Create a copy of the test context
-		snapshot[key] = &data.TestContext{
-			Namespace:   value.Namespace,
-			Failed:      value.Failed,
-			Pool:        value.Pool,
-			NetworkType: value.NetworkType,
-			Portgroup:   value.Portgroup,
-		}
+		snapshot[key] = value.Copy()
 	}
 	return snapshot
 }
 
+// GetTestContext returns a copy of the test context for a namespace, if one exists
+func (t *TestContextService) GetTestContext(namespace string) (*data.TestContext, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	testContext, exists := t.testContexts[namespace]
+	if !exists {
+		return nil, false
+	}
+	return testContext.Copy(), true
+}
+
+// QueryRuns returns the completed runs in the run ledger selected by the filter
+func (t *TestContextService) QueryRuns(filter ledger.Filter) []data.RunRecord {
+	return t.runLedger.Query(filter)
+}
+
+// RunChanges returns the runs recorded or updated in the run ledger after the
+// given revision, and the revision of the most recent change.
+func (t *TestContextService) RunChanges(after uint64) ([]data.RunRecord, uint64) {
+	return t.runLedger.Changes(after)
+}
+
+// UpdateRun applies update to a completed run in the run ledger. It returns
+// false if the run is not in the run ledger.
+func (t *TestContextService) UpdateRun(namespace string, completed time.Time, update func(run *data.RunRecord)) (bool, error) {
+	return t.runLedger.Update(namespace, completed, update)
+}
+
+// UpdateRuns applies the updates to completed runs in the run ledger at
+// once. It returns whether each update found its run in the run ledger.
+func (t *TestContextService) UpdateRuns(updates []ledger.RunUpdate) ([]bool, error) {
+	return t.runLedger.UpdateAll(updates)
+}
+
+// notifications are the notifications of the observers collected while the
+// lock of the service is held. They are delivered once it is released, so a
+// slow observer does not stall the reconcilers waiting for the lock.
+type notifications []func()
+
+func (n *notifications) add(notify func()) {
+	*n = append(*n, notify)
+}
+
+func (n *notifications) deliver() {
+	for _, notify := range *n {
+		notify()
+	}
+}
+
 // getTestContext gets(or creates) the test context for a given namespace
-func (t *TestContextService) getTestContext(namespace corev1.Namespace) *data.TestContext {
+func (t *TestContextService) getTestContext(namespace corev1.Namespace, pending *notifications) *data.TestContext {
 	var testContext *data.TestContext
 	var present bool
 
@@ -129,15 +234,22 @@ func (t *TestContextService) getTestContext(namespace corev1.Namespace) *data.Te
 			Namespace: namespace}
 
 		t.testContexts[namespace.Name] = testContext
+		t.indexJob(testContext)
+		if len(testContext.TestName()) > 0 {
+			created := testContext.Copy()
+			pending.add(func() { t.Observers.ContextCreated(created) })
+		}
 	}
 	return testContext
 }
 
 func (t *TestContextService) UpdateWithLease(namespace corev1.Namespace, lease v1.Lease) {
+	var pending notifications
+	defer pending.deliver()
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	testContext := t.getTestContext(namespace)
+	testContext := t.getTestContext(namespace, &pending)
 	testContext.Pool = lease.Status.Name
 	if len(lease.Spec.NetworkType) == 0 {
 		lease.Spec.NetworkType = "multi-tenant"
@@ -146,61 +258,309 @@ func (t *TestContextService) UpdateWithLease(namespace corev1.Namespace, lease v
 	if len(lease.Status.Topology.Networks) > 0 {
 		testContext.Portgroup = path.Base(lease.Status.Topology.Networks[0])
 	}
+	if len(lease.Status.Server) > 0 {
+		testContext.Topology = data.Topology{
+			VCenter:        lease.Status.Server,
+			Datacenter:     lease.Status.Topology.Datacenter,
+			ComputeCluster: lease.Status.Topology.ComputeCluster,
+			Datastore:      lease.Status.Topology.Datastore,
+		}
+	}
+	if testContext.LeaseCreated.IsZero() {
+		testContext.LeaseCreated = lease.CreationTimestamp.Time
+	}
+	if lease.Status.Phase == v1.PHASE_FULFILLED && testContext.LeasedAt.IsZero() {
+		testContext.LeasedAt = time.Now()
+		testContext.ConcurrencyAtLease = t.concurrency(testContext)
+		bound := testContext.Copy()
+		pending.add(func() { t.Observers.LeaseBound(bound, lease.Name) })
+	}
+	t.trackLease(namespace.Name, lease)
+}
+
+// concurrency counts the other in-flight test contexts sharing the pool and portgroup of a test context
+func (t *TestContextService) concurrency(testContext *data.TestContext) *data.Concurrency {
+	concurrency := &data.Concurrency{}
+	for _, other := range t.testContexts {
+		if other == testContext || other.LeasedAt.IsZero() {
+			continue
+		}
+		if len(testContext.Pool) > 0 && other.Pool == testContext.Pool {
+			concurrency.Pool++
+		}
+		if len(testContext.Portgroup) > 0 && other.Portgroup == testContext.Portgroup {
+			concurrency.Portgroup++
+		}
+	}
+	return concurrency
+}
+
+// OrphanLease tracks a lease whose test namespace no longer exists
+func (t *TestContextService) OrphanLease(namespace corev1.Namespace, lease v1.Lease) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	leaseRecord := t.trackLease(namespace.Name, lease)
+	if leaseRecord.OrphanedSince == nil {
+		now := time.Now()
+		leaseRecord.OrphanedSince = &now
+	}
+}
+
+// ForgetLease stops tracking a lease once it has been deleted
+func (t *TestContextService) ForgetLease(name string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.leases, name)
+}
+
+// IsLeaseOrphaned returns true if the lease is tracked and its test namespace no longer exists
+func (t *TestContextService) IsLeaseOrphaned(name string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	leaseRecord, exists := t.leases[name]
+	return exists && leaseRecord.OrphanedSince != nil
+}
+
+// GetLeaseSnapshot returns a copy of all tracked leases sorted by name
+func (t *TestContextService) GetLeaseSnapshot() []data.LeaseRecord {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	snapshot := make([]data.LeaseRecord, 0, len(t.leases))
+	for _, leaseRecord := range t.leases {
+		snapshot = append(snapshot, *leaseRecord)
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].Name < snapshot[j].Name
+	})
+	return snapshot
+}
+
+// GetLeakedLeases returns the leases which outlived their test namespace by more than the grace period
+func (t *TestContextService) GetLeakedLeases(grace time.Duration) []data.LeaseRecord {
+	now := time.Now()
+	var leaked []data.LeaseRecord
+	for _, leaseRecord := range t.GetLeaseSnapshot() {
+		if leaseRecord.IsLeaked(now, grace) {
+			leaked = append(leaked, leaseRecord)
+		}
+	}
+	return leaked
+}
+
+// trackLease gets(or creates) the lease record for a lease and refreshes it
+func (t *TestContextService) trackLease(namespace string, lease v1.Lease) *data.LeaseRecord {
+	leaseRecord, present := t.leases[lease.Name]
+	if !present {
+		leaseRecord = &data.LeaseRecord{Name: lease.Name}
+		t.leases[lease.Name] = leaseRecord
+	}
+	leaseRecord.Namespace = namespace
+	leaseRecord.Pool = lease.Status.Name
+	leaseRecord.Phase = string(lease.Status.Phase)
+	leaseRecord.Created = lease.CreationTimestamp.Time
+	if len(lease.Status.Topology.Networks) > 0 {
+		leaseRecord.Portgroup = path.Base(lease.Status.Topology.Networks[0])
+	}
+	return leaseRecord
 }
 
 func (t *TestContextService) UpdateWithPods(namespace corev1.Namespace, pod corev1.Pod) {
+	var pending notifications
+	defer pending.deliver()
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	testContext := t.getTestContext(namespace)
+	// pods are deleted along with their namespace after its test context was destroyed
+	if _, present := t.testContexts[namespace.Name]; !present && pod.DeletionTimestamp != nil {
+		return
+	}
+
+	testContext := t.getTestContext(namespace, &pending)
+	testContext.AddStep(data.NewStep(pod, time.Now()))
 	if pod.Status.Phase == corev1.PodFailed {
-		testContext.Failed = true
-		t.metricsContext.PodFailed(pod, testContext.Namespace.Labels["ci.openshift.io/metadata.target"], testContext.Namespace.Labels["ci.openshift.io/metadata.variant"])
+		if !testContext.Failed && !testContext.LeasedAt.IsZero() {
+			testContext.ConcurrencyAtFailure = t.concurrency(testContext)
+		}
+		// the final state of the prow job is authoritative once known
+		if testContext.ProwJob == nil {
+			testContext.Failed = true
+		}
+		failure := data.NewPodFailure(pod, time.Now())
+		if testContext.AddFailedPod(failure) {
+			failed := testContext.Copy()
+			pending.add(func() { t.Observers.PodFailed(failed, failure) })
+		}
 	}
 }
 
 func (t *TestContextService) UpdateWithNamespace(namespace corev1.Namespace) {
+	var pending notifications
+	defer pending.deliver()
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	testContext := t.getTestContext(namespace)
+	testContext := t.getTestContext(namespace, &pending)
+	labeled := len(testContext.TestName()) == 0 && len(namespace.Labels[data.TargetLabel]) > 0
+	t.unindexJob(testContext)
 	testContext.Namespace = namespace
+	t.indexJob(testContext)
+	// contexts created by a lease or pod of a namespace not yet labeled
+	if labeled {
+		created := testContext.Copy()
+		pending.add(func() { t.Observers.ContextCreated(created) })
+	}
+}
+
+// UpdateWithProwJob records the final state of a prow job and applies it to
+// the test context of the namespace the prow job created. Prow jobs usually
+// complete before their namespace is deleted, so the state is kept until then.
+// If the run already completed, the state is applied to its run record instead.
+// The state is kept before the run ledger is looked up, outside the lock, so
+// a run recorded meanwhile is either found in the ledger or finds the state
+// when it completes.
+func (t *TestContextService) UpdateWithProwJob(prowJob data.ProwJob) {
+	t.mutex.Lock()
+	now := time.Now()
+	for key, known := range t.prowJobs {
+		if now.Sub(known.Completed) > prowJobRetention {
+			delete(t.prowJobs, key)
+		}
+	}
+	if testContext := t.contextOfProwJob(&prowJob); testContext != nil {
+		testContext.SetProwJob(prowJob)
+		t.mutex.Unlock()
+		return
+	}
+	kept := &prowJob
+	t.prowJobs[prowJob.Key()] = kept
+	t.mutex.Unlock()
+
+	if !t.updateRunWithProwJob(prowJob) {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.prowJobs[prowJob.Key()] == kept {
+		delete(t.prowJobs, prowJob.Key())
+	}
+}
+
+// contextOfProwJob returns the test context of the namespace the prow job
+// created, or nil if there is none.
+func (t *TestContextService) contextOfProwJob(prowJob *data.ProwJob) *data.TestContext {
+	for _, key := range prowJob.Keys() {
+		namespace, indexed := t.jobs[key]
+		if !indexed {
+			continue
+		}
+		if testContext, present := t.testContexts[namespace]; present && prowJob.Matches(data.NewJob(testContext.Namespace)) {
+			return testContext
+		}
+	}
+	return nil
+}
+
+// updateRunWithProwJob applies the state of a prow job to its run in the run
+// ledger and notifies the observers if the outcome of the run changed. It
+// returns false if the run is not in the run ledger. It must not be called
+// with the lock held, as it may rewrite the run ledger.
+func (t *TestContextService) updateRunWithProwJob(prowJob data.ProwJob) bool {
+	known := false
+	var corrected *data.RunRecord
+	_, err := t.runLedger.UpdateJob(prowJob.Keys(), func(run *data.RunRecord) bool {
+		if !prowJob.Matches(run.Job) {
+			return false
+		}
+		known = true
+		return run.ProwJob == nil || run.ProwJob.State != prowJob.State
+	}, func(run *data.RunRecord) {
+		failed := run.Failed
+		run.SetProwJob(prowJob)
+		if run.Failed != failed {
+			record := *run
+			corrected = &record
+		}
+	})
+	if err != nil {
+		t.log.Error(err, "error applying prow job to run record", "prowjob", prowJob.Key())
+	}
+	if corrected != nil {
+		t.Observers.RunCorrected(*corrected)
+	}
+	return known
+}
+
+// indexJob indexes the test context by the keys of its prow job.
+func (t *TestContextService) indexJob(testContext *data.TestContext) {
+	job := data.NewJob(testContext.Namespace)
+	for _, key := range job.ProwJobKeys() {
+		t.jobs[key] = testContext.Namespace.Name
+	}
+}
+
+// unindexJob removes the test context from the index of prow jobs.
+func (t *TestContextService) unindexJob(testContext *data.TestContext) {
+	job := data.NewJob(testContext.Namespace)
+	for _, key := range job.ProwJobKeys() {
+		if t.jobs[key] == testContext.Namespace.Name {
+			delete(t.jobs, key)
+		}
+	}
 }
 
 func (t *TestContextService) DestroyContext(namespace corev1.Namespace) *data.TestContext {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	testContext := t.getTestContext(namespace)
-	outCtx := &data.TestContext{
-		Pool:        testContext.Pool,
-		Failed:      testContext.Failed,
-		Namespace:   testContext.Namespace,
-		NetworkType: testContext.NetworkType,
-		Portgroup:   testContext.Portgroup,
+	testContext, present := t.testContexts[namespace.Name]
+	if !present {
+		testContext = &data.TestContext{Namespace: namespace}
 	}
+	if testContext.ProwJob == nil {
+		job := data.NewJob(testContext.Namespace)
+		for key, prowJob := range t.prowJobs {
+			if prowJob.Matches(job) {
+				testContext.SetProwJob(*prowJob)
+				delete(t.prowJobs, key)
+				break
+			}
+		}
+	}
+	outCtx := testContext.Copy()
+	t.unindexJob(testContext)
 	delete(t.testContexts, namespace.Name)
 
 	return outCtx
 }
 
 func (t *TestContextService) IsContextFailed(namespace corev1.Namespace) bool {
+	var pending notifications
+	defer pending.deliver()
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	return t.getTestContext(namespace).Failed
+	return t.getTestContext(namespace, &pending).Failed
 }
 
 func (t *TestContextService) GetPromLabelValues(testContext *data.TestContext) ([]string, error) {
+	t.Save(path.Join(t.Directory, testContextsFilename))	
+
+	return promLabelValues(testContext)
+}
+
+// promLabelValues returns the values of the labels of the pass and fail counters for a test context
+func promLabelValues(testContext *data.TestContext) ([]string, error) {
 	var promLabels []string
 	var labelNames = []string{
-		"ci.openshift.io/metadata.target",
-		"ci.openshift.io/metadata.variant",
-		"ci.openshift.io/jobtype",
+		data.TargetLabel,
+		data.VariantLabel,
+		data.JobTypeLabel,
 	}
 
-	t.Save(testContextsFilename)	
-	
 	labels := testContext.Namespace.Labels
 
 	for _, labelName := range labelNames {
@@ -227,20 +587,53 @@ func (t *TestContextService) GetPromLabelValues(testContext *data.TestContext) (
 	return append(promLabels, pool, networkType, portGroup), nil
 }
 
-func (t *TestContextService) Pass(testContext *data.TestContext) {
-	promLabels, err := t.GetPromLabelValues(testContext)
-	if err != nil {
-		t.log.Error(err, "error getting prom labels")	
-		return
+// runLabelValues returns the values of the labels of the pass and fail
+// counters for a run in the run ledger, as promLabelValues does for its test context.
+func runLabelValues(run *data.RunRecord) ([]string, error) {
+	var promLabels []string
+	for _, value := range []string{run.TestName, run.Variant, run.JobType} {
+		if len(value) == 0 {
+			value = "undefined"
+		}
+		promLabels = append(promLabels, value)
+	}
+
+	networkType := "multi-tenant"
+	if len(run.NetworkType) > 0 {
+		networkType = run.NetworkType
+	}
+	if len(run.Pool) == 0 {
+		return nil, fmt.Errorf("pool is empty")
 	}
-	t.metricsContext.Pass(promLabels)
+	if len(run.Portgroup) == 0 {
+		return nil, fmt.Errorf("port group is empty")
+	}
+	return append(promLabels, run.Pool, networkType, run.Portgroup), nil
 }
 
-func (t *TestContextService) Fail(testContext *data.TestContext) {
-	promLabels, err := t.GetPromLabelValues(testContext)
-	if err != nil {
-		t.log.Error(err, "error getting prom labels")
-		return
+// CompleteRun notifies the observers of the outcome of a test context whose
+// namespace is being deleted, passed or failed alike.
+func (t *TestContextService) CompleteRun(testContext *data.TestContext) {
+	completed := time.Now()
+	if testContext.Namespace.DeletionTimestamp != nil {
+		completed = testContext.Namespace.DeletionTimestamp.Time
+	}
+	run := data.NewRunRecord(testContext, completed)
+	t.Observers.RunCompleted(testContext, run)
+
+	// a prow job which completed after the namespace was destroyed but
+	// before its run was recorded was kept for the namespace
+	var kept *data.ProwJob
+	t.mutex.Lock()
+	for key, prowJob := range t.prowJobs {
+		if prowJob.Matches(run.Job) {
+			delete(t.prowJobs, key)
+			kept = prowJob
+			break
+		}
+	}
+	t.mutex.Unlock()
+	if kept != nil {
+		t.updateRunWithProwJob(*kept)
 	}
-	t.metricsContext.Fail(promLabels)
 }
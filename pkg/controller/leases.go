@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
 	v1 "github.com/openshift-splat-team/vsphere-capacity-manager/pkg/apis/vspherecapacitymanager.splat.io/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -17,6 +19,11 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// orphanedLeaseRequeue is how often leases whose namespace is gone are re-evaluated.
+	orphanedLeaseRequeue = 10 * time.Minute
+)
+
 type LeaseReconciler struct {
 	client.Client
 	Scheme         *runtime.Scheme
@@ -92,6 +99,7 @@ func (l *LeaseReconciler) handleLease(lease v1.Lease) error {
 
 	if lease.DeletionTimestamp != nil {
 		l.log.Info("lease is being deleted", "lease", lease.Name)
+		l.testContext.ForgetLease(lease.Name)
 		return nil
 	}
 
@@ -108,11 +116,23 @@ func (l *LeaseReconciler) handleLease(lease v1.Lease) error {
 		return nil
 	}
 
-	l.testContext.UpdateWithLease(corev1.Namespace{
+	ns := corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: namespace,
 		},
-	}, lease)
+	}
+
+	// a lease which outlives its namespace must not recreate the test context
+	err := l.Client.Get(l.ctx, client.ObjectKeyFromObject(&ns), &ns)
+	if apierrors.IsNotFound(err) || (err == nil && ns.DeletionTimestamp != nil) {
+		l.log.Info("lease namespace no longer exists", "lease", lease.Name, "namespace", namespace)
+		l.testContext.OrphanLease(ns, lease)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error getting lease namespace: %w", err)
+	}
+
+	l.testContext.UpdateWithLease(ns, lease)
 
 	return nil
 }
@@ -121,7 +141,10 @@ func (l *LeaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	var err error
 	var lease v1.Lease
 	err = l.Client.Get(l.ctx, req.NamespacedName, &lease)
-	if err != nil {
+	if apierrors.IsNotFound(err) {
+		l.testContext.ForgetLease(req.Name)
+		return ctrl.Result{}, nil
+	} else if err != nil {
 		l.log.Error(err, "error getting lease")		
 		return ctrl.Result{}, nil
 	}
@@ -137,5 +160,9 @@ func (l *LeaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		l.log.Error(err, "error handling lease")
 		return ctrl.Result{}, nil	}
 
+	if l.testContext.IsLeaseOrphaned(lease.Name) {
+		return ctrl.Result{RequeueAfter: orphanedLeaseRequeue}, nil
+	}
+
 	return ctrl.Result{}, nil
 }
@@ -93,11 +93,7 @@ func (l *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		} else {
 			l.log.Info("namespace is being deleted", "namespace", namespace.Name, "failed", testContext.Failed, "prom labels", promLabels)
 		}		
-		if testContext.Failed {
-			l.testContextService.Fail(testContext)
-		} else {
-			l.testContextService.Pass(testContext)
-		}
+		l.testContextService.CompleteRun(testContext)
 		return ctrl.Result{}, nil
 	}
 	l.testContextService.UpdateWithNamespace(namespace)
@@ -77,7 +77,8 @@ func (l *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 
 	l.mutex.Lock()
 	defer l.mutex.Unlock()	
-	if pod.Status.Phase == corev1.PodFailed && strings.Contains(pod.Namespace, "ci-") {
+	completed := pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded
+	if completed && strings.Contains(pod.Namespace, "ci-") {
 		l.testContext.UpdateWithPods(corev1.Namespace{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: req.Namespace,
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// DefaultProwJobNamespace is the namespace prow creates ProwJobs in.
+	DefaultProwJobNamespace = "ci"
+	// DefaultProwJobSelector selects the ProwJobs of the vSphere jobs.
+	DefaultProwJobSelector = "ci-operator.openshift.io/cloud=vsphere"
+)
+
+// ProwJobGVK is the kind of the prow.k8s.io/v1 ProwJob resource. It is read
+// as unstructured so prow does not need to be vendored.
+var ProwJobGVK = schema.GroupVersionKind{Group: "prow.k8s.io", Version: "v1", Kind: "ProwJob"}
+
+// ProwJobReconciler feeds the final state of ProwJobs into the test contexts
+// of the namespaces they created.
+type ProwJobReconciler struct {
+	client.Client
+
+	// Namespace is the namespace of the ProwJobs. ProwJobs in other namespaces are ignored.
+	Namespace string
+	// Cluster is the build cluster whose ProwJobs are watched. ProwJobs of all clusters are watched if empty.
+	Cluster string
+	// Selector selects the ProwJobs by label. All ProwJobs are watched if nil.
+	Selector labels.Selector
+
+	testContext *testcontext.TestContextService
+
+	log logr.Logger
+}
+
+// SetupWithManager watches the ProwJobs of prowCluster, which is the cluster
+// of the manager if nil.
+func (l *ProwJobReconciler) SetupWithManager(mgr ctrl.Manager,
+	prowCluster cluster.Cluster,
+	testContext *testcontext.TestContextService) error {
+	if prowCluster == nil {
+		prowCluster = mgr
+	}
+	if len(l.Namespace) == 0 {
+		l.Namespace = DefaultProwJobNamespace
+	}
+
+	prowJob := &unstructured.Unstructured{}
+	prowJob.SetGroupVersionKind(ProwJobGVK)
+	// ProwJobs of other jobs or still running are dropped before they are queued
+	selected := predicate.NewTypedPredicateFuncs(l.selects)
+	if err := ctrl.NewControllerManagedBy(mgr).
+		Named("prowjob").
+		WatchesRawSource(source.Kind(prowCluster.GetCache(), prowJob,
+			&handler.TypedEnqueueRequestForObject[*unstructured.Unstructured]{}, selected)).
+		Complete(l); err != nil {
+		return fmt.Errorf("error setting up controller: %w", err)
+	}
+
+	l.testContext = testContext
+
+	l.Client = prowCluster.GetClient()
+	l.log = mgr.GetLogger().WithName("prowjob")
+
+	return nil
+}
+
+func (l *ProwJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	object := &unstructured.Unstructured{}
+	object.SetGroupVersionKind(ProwJobGVK)
+	if err := l.Client.Get(ctx, req.NamespacedName, object); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if !l.selects(object) {
+		return ctrl.Result{}, nil
+	}
+
+	prowJob, err := newProwJob(object)
+	if err != nil {
+		l.log.Error(err, "error reading prow job", "name", req.Name)
+		return ctrl.Result{}, nil
+	}
+	if prowJob.Completed.IsZero() {
+		prowJob.Completed = time.Now()
+	}
+	l.testContext.UpdateWithProwJob(prowJob)
+	return ctrl.Result{}, nil
+}
+
+// selects returns true if the ProwJob is in the watched namespace, cluster
+// and selector, and reached its final state.
+func (l *ProwJobReconciler) selects(object *unstructured.Unstructured) bool {
+	if object.GetNamespace() != l.Namespace {
+		return false
+	}
+	if l.Selector != nil && !l.Selector.Matches(labels.Set(object.GetLabels())) {
+		return false
+	}
+	if len(l.Cluster) > 0 {
+		if cluster, _, _ := unstructured.NestedString(object.Object, "spec", "cluster"); cluster != l.Cluster {
+			return false
+		}
+	}
+	state, _, _ := unstructured.NestedString(object.Object, "status", "state")
+	prowJob := data.ProwJob{State: state}
+	return prowJob.IsFinal()
+}
+
+// newProwJob reads the state of a ProwJob. The job name and build ID fall back
+// to the labels prow sets, which may be truncated.
+func newProwJob(object *unstructured.Unstructured) (data.ProwJob, error) {
+	prowJob := data.ProwJob{
+		Name:    object.GetName(),
+		JobName: object.GetLabels()[data.JobNameLabel],
+		BuildID: object.GetLabels()[data.BuildIDLabel],
+	}
+	if job, _, _ := unstructured.NestedString(object.Object, "spec", "job"); len(job) > 0 {
+		prowJob.JobName = job
+	}
+	if buildID, _, _ := unstructured.NestedString(object.Object, "status", "build_id"); len(buildID) > 0 {
+		prowJob.BuildID = buildID
+	}
+	prowJob.State, _, _ = unstructured.NestedString(object.Object, "status", "state")
+	prowJob.URL, _, _ = unstructured.NestedString(object.Object, "status", "url")
+
+	if completion, _, _ := unstructured.NestedString(object.Object, "status", "completionTime"); len(completion) > 0 {
+		completed, err := time.Parse(time.RFC3339, completion)
+		if err != nil {
+			return prowJob, fmt.Errorf("invalid completion time %q: %w", completion, err)
+		}
+		prowJob.Completed = completed
+	}
+	return prowJob, nil
+}
@@ -0,0 +1,224 @@
+package dashboard
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+)
+
+const (
+	defaultWindow = 24 * time.Hour
+
+	// recentFailureCount is the number of failed runs listed on the dashboard.
+	recentFailureCount = 25
+)
+
+//go:embed assets
+var assets embed.FS
+
+// Dashboard serves a self-contained HTML page summarizing pool health.
+type Dashboard struct {
+	// Window is how far back completed runs are considered. Defaults to 24 hours.
+	Window time.Duration
+
+	page *template.Template
+
+	testContext *testcontext.TestContextService
+
+	log logr.Logger
+}
+
+// heatmapRow holds the summaries of a pool for each variant shown on the heat map.
+type heatmapRow struct {
+	Pool  string
+	Cells []*ledger.Summary
+}
+
+// poolActivity counts the in-flight runs on a pool.
+type poolActivity struct {
+	Pool    string
+	Running int
+	Failed  int
+}
+
+type pageData struct {
+	Generated      time.Time
+	Window         time.Duration
+	Variants       []string
+	Heatmap        []heatmapRow
+	InFlight       []poolActivity
+	RecentFailures []data.RunRecord
+	LeakedLeases   []data.LeaseRecord
+}
+
+func (d *Dashboard) SetupWithServer(server *api.Server,
+	testContext *testcontext.TestContextService,
+	log logr.Logger) error {
+	d.testContext = testContext
+	d.log = log.WithName("dashboard")
+	if d.Window <= 0 {
+		d.Window = defaultWindow
+	}
+
+	var err error
+	d.page, err = template.New("index.html.tmpl").Funcs(template.FuncMap{
+		"passRateColor": passRateColor,
+		"percent":       percent,
+		"orNone":        orNone,
+		"formatTime":    formatTime,
+	}).ParseFS(assets, "assets/index.html.tmpl")
+	if err != nil {
+		return fmt.Errorf("error parsing dashboard template: %w", err)
+	}
+
+	static, err := fs.Sub(assets, "assets")
+	if err != nil {
+		return fmt.Errorf("error loading dashboard assets: %w", err)
+	}
+
+	server.Handle("GET /dashboard", http.HandlerFunc(d.render))
+	server.Handle("GET /dashboard/static/", http.StripPrefix("/dashboard/static/", http.FileServer(http.FS(static))))
+	return nil
+}
+
+func (d *Dashboard) render(w http.ResponseWriter, r *http.Request) {
+	window := d.Window
+	if value := r.URL.Query().Get("window"); len(value) > 0 {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			d.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid window %q", value))
+			return
+		}
+		window = parsed
+	}
+
+	pageData, err := d.gather(window)
+	if err != nil {
+		d.log.Error(err, "error gathering dashboard data")
+		d.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := d.page.Execute(w, pageData); err != nil {
+		d.log.Error(err, "error rendering dashboard")
+	}
+}
+
+// writeError responds with the JSON error of the API.
+func (d *Dashboard) writeError(w http.ResponseWriter, status int, err error) {
+	if err := api.WriteError(w, status, err); err != nil {
+		d.log.Error(err, "error encoding response")
+	}
+}
+
+// gather collects everything shown on the dashboard.
+func (d *Dashboard) gather(window time.Duration) (*pageData, error) {
+	now := time.Now()
+	pageData := &pageData{
+		Generated:    now,
+		Window:       window,
+		LeakedLeases: d.testContext.GetLeakedLeases(testcontext.LeaseLeakGracePeriod),
+	}
+
+	runs := d.testContext.QueryRuns(ledger.Filter{Since: now.Add(-window)})
+	summaries, err := ledger.Summarize(runs, ledger.DimensionPool, ledger.DimensionVariant)
+	if err != nil {
+		return nil, err
+	}
+	pageData.Variants, pageData.Heatmap = heatmap(summaries)
+
+	for _, run := range runs {
+		if len(pageData.RecentFailures) == recentFailureCount {
+			break
+		}
+		if run.Failed {
+			pageData.RecentFailures = append(pageData.RecentFailures, run)
+		}
+	}
+
+	activity := make(map[string]*poolActivity)
+	for _, testContext := range d.testContext.GetTestContextSnapshot() {
+		if !testContext.IsTestRun() {
+			continue
+		}
+		pool, exists := activity[testContext.Pool]
+		if !exists {
+			pool = &poolActivity{Pool: testContext.Pool}
+			activity[testContext.Pool] = pool
+		}
+		pool.Running++
+		if testContext.Failed {
+			pool.Failed++
+		}
+	}
+	for _, pool := range activity {
+		pageData.InFlight = append(pageData.InFlight, *pool)
+	}
+	sort.Slice(pageData.InFlight, func(i, j int) bool {
+		return pageData.InFlight[i].Pool < pageData.InFlight[j].Pool
+	})
+
+	return pageData, nil
+}
+
+// heatmap arranges pool/variant summaries as rows of pools and columns of variants.
+func heatmap(summaries []ledger.Summary) ([]string, []heatmapRow) {
+	variantIndex := make(map[string]int)
+	var variants []string
+	for _, summary := range summaries {
+		variant := summary.Labels[ledger.DimensionVariant]
+		if _, exists := variantIndex[variant]; !exists {
+			variantIndex[variant] = len(variants)
+			variants = append(variants, variant)
+		}
+	}
+	sort.Strings(variants)
+	for i, variant := range variants {
+		variantIndex[variant] = i
+	}
+
+	var rows []heatmapRow
+	for i := range summaries {
+		summary := &summaries[i]
+		pool := summary.Labels[ledger.DimensionPool]
+		if len(rows) == 0 || rows[len(rows)-1].Pool != pool {
+			rows = append(rows, heatmapRow{Pool: pool, Cells: make([]*ledger.Summary, len(variants))})
+		}
+		rows[len(rows)-1].Cells[variantIndex[summary.Labels[ledger.DimensionVariant]]] = summary
+	}
+	return variants, rows
+}
+
+// passRateColor shades a pass rate from red (0%) to green (100%).
+func passRateColor(passRate float64) template.CSS {
+	return template.CSS(fmt.Sprintf("hsl(%d, 65%%, 42%%)", int(passRate*120)))
+}
+
+func percent(value float64) string {
+	return fmt.Sprintf("%.0f%%", value*100)
+}
+
+func orNone(value string) string {
+	if len(value) == 0 {
+		return "(none)"
+	}
+	return value
+}
+
+func formatTime(value time.Time) string {
+	if value.IsZero() {
+		return "-"
+	}
+	return value.UTC().Format("2006-01-02 15:04 MST")
+}
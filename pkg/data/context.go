@@ -1,9 +1,18 @@
 package data
 
 import (
+	"fmt"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 )
 
+const (
+	TargetLabel  = "ci.openshift.io/metadata.target"
+	VariantLabel = "ci.openshift.io/metadata.variant"
+	JobTypeLabel = "ci.openshift.io/jobtype"
+)
+
 type TestContext struct {
 	Namespace corev1.Namespace
 	Failed    bool
@@ -11,4 +20,210 @@ type TestContext struct {
 	Pool        string
 	NetworkType string
 	Portgroup   string
+	Topology    Topology
+
+	FailedPods []PodFailure
+	Steps      []Step
+
+	LeaseCreated         time.Time
+	LeasedAt             time.Time
+	ConcurrencyAtLease   *Concurrency
+	ConcurrencyAtFailure *Concurrency
+
+	// ProwJob is the final state of the prow job of the test once known. It
+	// decides whether the test failed, regardless of its failed pods.
+	ProwJob *ProwJob
+}
+
+// Topology is the vSphere infrastructure a lease placed a test on.
+type Topology struct {
+	VCenter        string `json:"vcenter,omitempty"`
+	Datacenter     string `json:"datacenter,omitempty"`
+	ComputeCluster string `json:"compute_cluster,omitempty"`
+	Datastore      string `json:"datastore,omitempty"`
+}
+
+// Concurrency counts the other runs which were in flight on the same pool and
+// portgroup at a given moment.
+type Concurrency struct {
+	Pool      int `json:"pool"`
+	Portgroup int `json:"portgroup"`
+}
+
+// PodFailure describes a pod of a test which reached the failed phase.
+type PodFailure struct {
+	Name     string    `json:"name"`
+	NodeName string    `json:"node_name"`
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Step is a pod of a test which ran to completion. ci-operator runs every
+// step of a test in its own pod.
+type Step struct {
+	Name     string    `json:"name"`
+	NodeName string    `json:"node_name"`
+	Phase    string    `json:"phase"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// NewStep describes a completed pod. The pod is considered finished when its
+// last container terminated, or at the given time if none reported it.
+func NewStep(pod corev1.Pod, now time.Time) Step {
+	step := Step{
+		Name:     pod.Name,
+		NodeName: pod.Spec.NodeName,
+		Phase:    string(pod.Status.Phase),
+		Started:  pod.CreationTimestamp.Time,
+	}
+	if pod.Status.StartTime != nil {
+		step.Started = pod.Status.StartTime.Time
+	}
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		if terminated := status.State.Terminated; terminated != nil && terminated.FinishedAt.Time.After(step.Finished) {
+			step.Finished = terminated.FinishedAt.Time
+		}
+	}
+	if step.Finished.IsZero() {
+		step.Finished = now
+	}
+	return step
+}
+
+// NewPodFailure describes why a failed pod failed. The pod status reason is
+// preferred, otherwise the first container which terminated unsuccessfully is used.
+func NewPodFailure(pod corev1.Pod, now time.Time) PodFailure {
+	failure := PodFailure{
+		Name:     pod.Name,
+		NodeName: pod.Spec.NodeName,
+		Reason:   pod.Status.Reason,
+		Message:  pod.Status.Message,
+		Time:     now,
+	}
+	if len(failure.Reason) > 0 {
+		return failure
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		terminated := status.State.Terminated
+		if terminated == nil || terminated.ExitCode == 0 {
+			continue
+		}
+		failure.Reason = fmt.Sprintf("%s: %s (exit code %d)", status.Name, terminated.Reason, terminated.ExitCode)
+		failure.Message = terminated.Message
+		if !terminated.FinishedAt.IsZero() {
+			failure.Time = terminated.FinishedAt.Time
+		}
+		return failure
+	}
+
+	failure.Reason = "Unknown"
+	return failure
+}
+
+// IsTestRun returns true if the namespace belongs to a ci-operator test or
+// holds a lease. Every namespace of the cluster has a test context, most of
+// them are not test runs.
+func (t *TestContext) IsTestRun() bool {
+	return len(t.TestName()) > 0 || len(t.Pool) > 0
+}
+
+// TestName returns the ci-operator target of the test running in the namespace.
+func (t *TestContext) TestName() string {
+	return t.Namespace.Labels[TargetLabel]
+}
+
+// Variant returns the ci-operator variant of the test running in the namespace.
+func (t *TestContext) Variant() string {
+	return t.Namespace.Labels[VariantLabel]
+}
+
+// JobType returns the prow job type of the test running in the namespace.
+func (t *TestContext) JobType() string {
+	return t.Namespace.Labels[JobTypeLabel]
+}
+
+// Copy returns a copy of the test context which is safe to hand out
+// without holding the test context service lock.
+func (t *TestContext) Copy() *TestContext {
+	return &TestContext{
+		Namespace:   *t.Namespace.DeepCopy(),
+		Failed:      t.Failed,
+		Pool:        t.Pool,
+		NetworkType: t.NetworkType,
+		Portgroup:   t.Portgroup,
+		Topology:    t.Topology,
+		FailedPods:  append([]PodFailure(nil), t.FailedPods...),
+		Steps:       append([]Step(nil), t.Steps...),
+
+		LeaseCreated:         t.LeaseCreated,
+		LeasedAt:             t.LeasedAt,
+		ConcurrencyAtLease:   copyConcurrency(t.ConcurrencyAtLease),
+		ConcurrencyAtFailure: copyConcurrency(t.ConcurrencyAtFailure),
+		ProwJob:              copyProwJob(t.ProwJob),
+	}
+}
+
+func copyProwJob(prowJob *ProwJob) *ProwJob {
+	if prowJob == nil {
+		return nil
+	}
+	out := *prowJob
+	return &out
+}
+
+func copyConcurrency(concurrency *Concurrency) *Concurrency {
+	if concurrency == nil {
+		return nil
+	}
+	out := *concurrency
+	return &out
+}
+
+// FirstFailure returns when the first pod of the test failed.
+func (t *TestContext) FirstFailure() time.Time {
+	return firstFailure(t.FailedPods)
+}
+
+func firstFailure(failedPods []PodFailure) time.Time {
+	var first time.Time
+	for _, failedPod := range failedPods {
+		if first.IsZero() || failedPod.Time.Before(first) {
+			first = failedPod.Time
+		}
+	}
+	return first
+}
+
+// SetProwJob records the final state of the prow job of the test, which
+// overrides the outcome inferred from its pods.
+func (t *TestContext) SetProwJob(prowJob ProwJob) {
+	t.ProwJob = &prowJob
+	t.Failed = prowJob.State != ProwJobSuccess
+}
+
+// AddFailedPod records a failed pod unless it was already recorded and
+// returns true if it was added.
+func (t *TestContext) AddFailedPod(failure PodFailure) bool {
+	for _, failedPod := range t.FailedPods {
+		if failedPod.Name == failure.Name {
+			return false
+		}
+	}
+	t.FailedPods = append(t.FailedPods, failure)
+	return true
+}
+
+// AddStep records a completed pod, replacing an earlier record of the same pod.
+func (t *TestContext) AddStep(step Step) {
+	for i := range t.Steps {
+		if t.Steps[i].Name == step.Name {
+			t.Steps[i] = step
+			return
+		}
+	}
+	t.Steps = append(t.Steps, step)
 }
@@ -0,0 +1,134 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// JobSpecAnnotation holds the prow job spec ci-operator was started with.
+	JobSpecAnnotation = "ci.openshift.io/job-spec"
+
+	OrgLabel     = "ci.openshift.io/metadata.org"
+	RepoLabel    = "ci.openshift.io/metadata.repo"
+	BranchLabel  = "ci.openshift.io/metadata.branch"
+	JobNameLabel = "prow.k8s.io/job"
+	BuildIDLabel = "prow.k8s.io/build-id"
+	PullLabel    = "prow.k8s.io/refs.pull"
+)
+
+// JobSpec is the subset of the prow job spec ci-operator records on its namespace.
+type JobSpec struct {
+	Type      string `json:"type"`
+	Job       string `json:"job"`
+	BuildID   string `json:"buildid"`
+	ProwJobID string `json:"prowjobid"`
+	Refs      *Refs  `json:"refs,omitempty"`
+}
+
+// Refs describes the git references a job was started for.
+type Refs struct {
+	Org     string `json:"org"`
+	Repo    string `json:"repo"`
+	BaseRef string `json:"base_ref"`
+	BaseSHA string `json:"base_sha"`
+	Pulls   []Pull `json:"pulls,omitempty"`
+}
+
+// Pull is a pull request tested by a job.
+type Pull struct {
+	Number int    `json:"number"`
+	Author string `json:"author"`
+	SHA    string `json:"sha"`
+}
+
+// Job identifies the prow job a test namespace belongs to. Reruns of the same
+// job for the same commit share everything but the build and prow job IDs.
+type Job struct {
+	Org     string `json:"org,omitempty"`
+	Repo    string `json:"repo,omitempty"`
+	Branch  string `json:"branch,omitempty"`
+	Pull    int    `json:"pull,omitempty"`
+	Name    string `json:"job_name,omitempty"`
+	BuildID string `json:"build_id,omitempty"`
+	Commit  string `json:"commit,omitempty"`
+	// ProwJobID is the name of the ProwJob resource, only known from the job spec.
+	ProwJobID string `json:"prowjob_id,omitempty"`
+}
+
+// NewJob reads the job identity from the job spec annotation of a namespace,
+// falling back to its labels.
+func NewJob(namespace corev1.Namespace) Job {
+	labels := namespace.Labels
+	job := Job{
+		Org:     labels[OrgLabel],
+		Repo:    labels[RepoLabel],
+		Branch:  labels[BranchLabel],
+		Name:    labels[JobNameLabel],
+		BuildID: labels[BuildIDLabel],
+	}
+	if pull, err := strconv.Atoi(labels[PullLabel]); err == nil {
+		job.Pull = pull
+	}
+
+	var spec JobSpec
+	if err := json.Unmarshal([]byte(namespace.Annotations[JobSpecAnnotation]), &spec); err != nil {
+		return job
+	}
+	if len(spec.Job) > 0 {
+		job.Name = spec.Job
+	}
+	if len(spec.BuildID) > 0 {
+		job.BuildID = spec.BuildID
+	}
+	job.ProwJobID = spec.ProwJobID
+	if refs := spec.Refs; refs != nil {
+		job.Org, job.Repo, job.Branch = refs.Org, refs.Repo, refs.BaseRef
+		job.Commit = refs.BaseSHA
+		if len(refs.Pulls) > 0 {
+			job.Pull = refs.Pulls[0].Number
+			job.Commit = refs.Pulls[0].SHA
+		}
+	}
+	return job
+}
+
+// ProwJobKeys returns the keys of ProwJob.Keys the prow job which created the
+// namespace of the job is looked up by.
+func (j *Job) ProwJobKeys() []string {
+	var keys []string
+	if len(j.ProwJobID) > 0 {
+		keys = append(keys, j.ProwJobID)
+	}
+	if len(j.Name) > 0 && len(j.BuildID) > 0 {
+		keys = append(keys, j.Name+"/"+j.BuildID)
+	}
+	return keys
+}
+
+// RerunKey groups runs of the same job for the same commit. It is empty when
+// the job or commit are unknown.
+func (j *Job) RerunKey() string {
+	if len(j.Name) == 0 || len(j.Commit) == 0 {
+		return ""
+	}
+	return j.Org + "/" + j.Repo + "/" + strconv.Itoa(j.Pull) + "/" + j.Name + "/" + j.Commit
+}
+
+// URL returns the URL of the artifacts of the job run below prowURL, e.g.
+// https://prow.ci.openshift.org/view/gs/test-platform-results. Presubmits are
+// kept under pr-logs and all other jobs under logs.
+func (j *Job) URL(prowURL string) string {
+	if len(prowURL) == 0 {
+		return ""
+	}
+	prowURL = strings.TrimSuffix(prowURL, "/")
+	if j.Pull > 0 && len(j.Org) > 0 && len(j.Repo) > 0 {
+		return fmt.Sprintf("%s/pr-logs/pull/%s_%s/%d/%s/%s", prowURL, j.Org, j.Repo, j.Pull, j.Name, j.BuildID)
+	}
+	return fmt.Sprintf("%s/logs/%s/%s", prowURL, j.Name, j.BuildID)
+}
@@ -0,0 +1,22 @@
+package data
+
+import (
+	"time"
+)
+
+// LeaseRecord tracks a capacity manager lease held on behalf of a test namespace.
+type LeaseRecord struct {
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace"`
+	Pool      string    `json:"pool"`
+	Portgroup string    `json:"portgroup"`
+	Phase     string    `json:"phase"`
+	Created   time.Time `json:"created"`
+	// OrphanedSince is when the lease was first seen without its test namespace.
+	OrphanedSince *time.Time `json:"orphaned_since,omitempty"`
+}
+
+// IsLeaked returns true if the lease outlived its test namespace by more than the grace period.
+func (l *LeaseRecord) IsLeaked(now time.Time, grace time.Duration) bool {
+	return l.OrphanedSince != nil && now.Sub(*l.OrphanedSince) > grace
+}
@@ -0,0 +1,65 @@
+package data
+
+import (
+	"time"
+)
+
+// Final states of a prow job.
+const (
+	ProwJobSuccess = "success"
+	ProwJobFailure = "failure"
+	ProwJobAborted = "aborted"
+	ProwJobError   = "error"
+)
+
+// ProwJob is the final state of a prow job, the authoritative outcome of the
+// test run in the namespace it created.
+type ProwJob struct {
+	// Name is the name of the ProwJob resource, which ci-operator records as the prowjobid of its job spec.
+	Name      string    `json:"name"`
+	JobName   string    `json:"job_name"`
+	BuildID   string    `json:"build_id"`
+	State     string    `json:"state"`
+	URL       string    `json:"url,omitempty"`
+	Completed time.Time `json:"completed"`
+}
+
+// Key identifies the prow job by its name, falling back to the job name and
+// build ID if the name is not known.
+func (p *ProwJob) Key() string {
+	if len(p.Name) > 0 {
+		return p.Name
+	}
+	return p.JobName + "/" + p.BuildID
+}
+
+// Keys returns the keys the prow job may be indexed by, its name and its job
+// name and build ID, in the order Matches prefers them.
+func (p *ProwJob) Keys() []string {
+	var keys []string
+	if len(p.Name) > 0 {
+		keys = append(keys, p.Name)
+	}
+	if len(p.JobName) > 0 && len(p.BuildID) > 0 {
+		keys = append(keys, p.JobName+"/"+p.BuildID)
+	}
+	return keys
+}
+
+// IsFinal returns true if the prow job is in one of its final states.
+func (p *ProwJob) IsFinal() bool {
+	switch p.State {
+	case ProwJobSuccess, ProwJobFailure, ProwJobAborted, ProwJobError:
+		return true
+	}
+	return false
+}
+
+// Matches returns true if the prow job created the namespace of the job. The
+// prow job ID is preferred, falling back to the job name and build ID.
+func (p *ProwJob) Matches(job Job) bool {
+	if len(job.ProwJobID) > 0 && len(p.Name) > 0 {
+		return job.ProwJobID == p.Name
+	}
+	return len(job.Name) > 0 && len(job.BuildID) > 0 && job.Name == p.JobName && job.BuildID == p.BuildID
+}
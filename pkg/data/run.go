@@ -0,0 +1,84 @@
+package data
+
+import (
+	"time"
+)
+
+// RunRecord is the outcome of a completed test run as kept in the run ledger.
+type RunRecord struct {
+	Job
+	Namespace   string       `json:"namespace"`
+	TestName    string       `json:"test_name"`
+	Variant     string       `json:"variant"`
+	JobType     string       `json:"job_type"`
+	Pool        string       `json:"pool"`
+	NetworkType string       `json:"network_type"`
+	Portgroup   string       `json:"portgroup"`
+	Topology    Topology     `json:"topology"`
+	Failed      bool         `json:"failed"`
+	FailedPods  []PodFailure `json:"failed_pods,omitempty"`
+	Started     time.Time    `json:"started"`
+	Leased      time.Time    `json:"leased,omitempty"`
+	Completed   time.Time    `json:"completed"`
+
+	ConcurrencyAtLease   *Concurrency `json:"concurrency_at_lease,omitempty"`
+	ConcurrencyAtFailure *Concurrency `json:"concurrency_at_failure,omitempty"`
+
+	// ProwJob is set if the outcome was taken from the prow job rather than inferred from failed pods.
+	ProwJob *ProwJob `json:"prowjob,omitempty"`
+	// TestCases are set once the JUnit results of the run were ingested.
+	TestCases *TestCaseResults `json:"test_cases,omitempty"`
+
+	// Sequence is the revision of the run ledger which recorded the run, and
+	// Revision the one which last changed it. Revisions only increase, unlike
+	// completion times, which arrive out of order.
+	Sequence uint64 `json:"sequence,omitempty"`
+	Revision uint64 `json:"revision,omitempty"`
+}
+
+// NewRunRecord builds the run record for a test context that completed at the given time.
+func NewRunRecord(testContext *TestContext, completed time.Time) RunRecord {
+	return RunRecord{
+		Job:         NewJob(testContext.Namespace),
+		Namespace:   testContext.Namespace.Name,
+		TestName:    testContext.TestName(),
+		Variant:     testContext.Variant(),
+		JobType:     testContext.JobType(),
+		Pool:        testContext.Pool,
+		NetworkType: testContext.NetworkType,
+		Portgroup:   testContext.Portgroup,
+		Topology:    testContext.Topology,
+		Failed:      testContext.Failed,
+		FailedPods:  testContext.FailedPods,
+		Started:     testContext.Namespace.CreationTimestamp.Time,
+		Leased:      testContext.LeasedAt,
+		Completed:   completed,
+
+		ConcurrencyAtLease:   testContext.ConcurrencyAtLease,
+		ConcurrencyAtFailure: testContext.ConcurrencyAtFailure,
+		ProwJob:              testContext.ProwJob,
+	}
+}
+
+// SetProwJob takes the outcome of the run from the final state of its prow job.
+func (r *RunRecord) SetProwJob(prowJob ProwJob) {
+	r.ProwJob = &prowJob
+	r.Failed = prowJob.State != ProwJobSuccess
+}
+
+// Result returns "failed" or "passed" depending on the outcome of the run.
+func (r *RunRecord) Result() string {
+	if r.Failed {
+		return "failed"
+	}
+	return "passed"
+}
+
+// FirstFailure returns when the first pod of a failed run failed, falling
+// back to the completion of the run if no failed pod was recorded.
+func (r *RunRecord) FirstFailure() time.Time {
+	if first := firstFailure(r.FailedPods); !first.IsZero() {
+		return first
+	}
+	return r.Completed
+}
@@ -0,0 +1,31 @@
+package data
+
+// Results of a test case.
+const (
+	TestCasePassed  = "passed"
+	TestCaseFailed  = "failed"
+	TestCaseFlaked  = "flaked"
+	TestCaseSkipped = "skipped"
+)
+
+// TestCase is the outcome of a test case of a run as reported by its JUnit
+// results. A test case which both failed and passed in the same run flaked.
+type TestCase struct {
+	Name   string `json:"name"`
+	Suite  string `json:"suite,omitempty"`
+	Result string `json:"result"`
+	// Duration is how long the test case took in seconds.
+	Duration float64 `json:"duration,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+// TestCaseResults are the test case outcomes of a run. Passed test cases are
+// counted but only listed if recording them was enabled, to keep the run
+// ledger small.
+type TestCaseResults struct {
+	Passed  int        `json:"passed"`
+	Failed  int        `json:"failed"`
+	Flaked  int        `json:"flaked"`
+	Skipped int        `json:"skipped"`
+	Cases   []TestCase `json:"cases,omitempty"`
+}
@@ -0,0 +1,191 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	defaultQueueSize  = 1000
+	defaultMaxRetries = 5
+	initialBackoff    = time.Second
+	maxBackoff        = time.Minute
+)
+
+// Emitter queues events for its sinks and delivers them in the background.
+// Every sink has its own bounded queue so a slow sink does not hold up the
+// others, and events are dropped rather than blocking the caller. As a run
+// observer it emits an event for every hook of the run lifecycle.
+type Emitter struct {
+	Sinks []Sink
+	// Source is the source of the emitted events.
+	Source string
+	// QueueSize is the number of events which may wait for each sink.
+	QueueSize int
+	// MaxRetries is how often a failed delivery is retried with exponential back-off.
+	MaxRetries int
+
+	queues map[string]chan Event
+
+	deliveredCounter *prometheus.CounterVec
+	droppedCounter   *prometheus.CounterVec
+	queueGauge       *prometheus.GaugeVec
+
+	log logr.Logger
+}
+
+func (e *Emitter) SetupWithManager(mgr ctrl.Manager) error {
+	e.log = mgr.GetLogger().WithName("events")
+	if len(e.Source) == 0 {
+		e.Source = DefaultSource
+	}
+	if e.QueueSize <= 0 {
+		e.QueueSize = defaultQueueSize
+	}
+	if e.MaxRetries <= 0 {
+		e.MaxRetries = defaultMaxRetries
+	}
+
+	e.queues = make(map[string]chan Event, len(e.Sinks))
+	for _, sink := range e.Sinks {
+		if _, exists := e.queues[sink.Name()]; exists {
+			return fmt.Errorf("duplicate event sink %s", sink.Name())
+		}
+		if httpSink, ok := sink.(*HTTPSink); ok && httpSink.Mode != ModeStructured && httpSink.Mode != ModeBinary {
+			return fmt.Errorf("invalid CloudEvents mode %q, must be %s or %s", httpSink.Mode, ModeStructured, ModeBinary)
+		}
+		e.queues[sink.Name()] = make(chan Event, e.QueueSize)
+	}
+
+	e.deliveredCounter = monitor.CloudEventsDelivered.NewCounterVec()
+	e.droppedCounter = monitor.CloudEventsDropped.NewCounterVec()
+	e.queueGauge = monitor.CloudEventsQueued.NewGaugeVec()
+	for metric, collector := range map[*monitor.Metric]prometheus.Collector{
+		&monitor.CloudEventsDelivered: e.deliveredCounter,
+		&monitor.CloudEventsDropped:   e.droppedCounter,
+		&monitor.CloudEventsQueued:    e.queueGauge,
+	} {
+		if err := metric.Register(collector); err != nil {
+			return fmt.Errorf("error registering event metric: %w", err)
+		}
+	}
+
+	if err := mgr.Add(e); err != nil {
+		return fmt.Errorf("error adding event emitter to manager: %w", err)
+	}
+	return nil
+}
+
+// Emit queues an event about a namespace for every sink without blocking.
+func (e *Emitter) Emit(eventType, namespace string, payload interface{}) {
+	event, err := NewEvent(e.Source, eventType, namespace, payload)
+	if err != nil {
+		e.log.Error(err, "error creating event", "type", eventType, "namespace", namespace)
+		return
+	}
+	for name, queue := range e.queues {
+		select {
+		case queue <- event:
+			e.queueGauge.WithLabelValues(name).Set(float64(len(queue)))
+		default:
+			e.droppedCounter.WithLabelValues(name, "queue_full").Inc()
+		}
+	}
+}
+
+func (e *Emitter) OnContextCreated(testContext *data.TestContext) {
+	e.Emit(TypeContextCreated, testContext.Namespace.Name, NewContextCreated(testContext))
+}
+
+func (e *Emitter) OnLeaseBound(testContext *data.TestContext, lease string) {
+	e.Emit(TypeLeaseBound, testContext.Namespace.Name, NewLeaseBound(testContext, lease))
+}
+
+func (e *Emitter) OnPodFailed(testContext *data.TestContext, failure data.PodFailure) {
+	e.Emit(TypePodFailed, testContext.Namespace.Name, NewPodFailed(testContext, failure))
+}
+
+func (e *Emitter) OnRunCompleted(testContext *data.TestContext, run data.RunRecord) {
+	if run.Failed {
+		e.Emit(TypeRunFailed, run.Namespace, run)
+	} else {
+		e.Emit(TypeRunPassed, run.Namespace, run)
+	}
+}
+
+func (e *Emitter) OnRunCorrected(run data.RunRecord) {
+	e.Emit(TypeRunCorrected, run.Namespace, run)
+}
+
+// Start delivers the queued events until the context is cancelled.
+func (e *Emitter) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, sink := range e.Sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.deliver(ctx, sink, e.queues[sink.Name()])
+		}()
+	}
+	wg.Wait()
+
+	for _, sink := range e.Sinks {
+		if fileSink, ok := sink.(*FileSink); ok {
+			if err := fileSink.Close(); err != nil {
+				e.log.Error(err, "error closing event file")
+			}
+		}
+	}
+	return nil
+}
+
+// NeedLeaderElection lets every replica deliver the events it emitted.
+func (e *Emitter) NeedLeaderElection() bool {
+	return false
+}
+
+func (e *Emitter) deliver(ctx context.Context, sink Sink, queue chan Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-queue:
+			e.queueGauge.WithLabelValues(sink.Name()).Set(float64(len(queue)))
+			if err := e.send(ctx, sink, event); err != nil {
+				e.log.Error(err, "dropping event", "sink", sink.Name(), "type", event.Type, "id", event.ID)
+				e.droppedCounter.WithLabelValues(sink.Name(), "delivery_failed").Inc()
+				continue
+			}
+			e.deliveredCounter.WithLabelValues(sink.Name(), event.Type).Inc()
+		}
+	}
+}
+
+// send delivers an event, retrying with exponential back-off and jitter.
+func (e *Emitter) send(ctx context.Context, sink Sink, event Event) error {
+	backoff := initialBackoff
+	for attempt := 0; ; attempt++ {
+		err := sink.Send(ctx, event)
+		if err == nil || IsPermanent(err) || attempt >= e.MaxRetries {
+			return err
+		}
+		e.log.V(1).Info("retrying event delivery", "sink", sink.Name(), "id", event.ID, "attempt", attempt+1, "error", err.Error())
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
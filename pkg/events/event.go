@@ -0,0 +1,128 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+)
+
+// Types of the emitted events.
+const (
+	TypeContextCreated = "io.splat.test-monitor.context.created"
+	TypeLeaseBound     = "io.splat.test-monitor.lease.bound"
+	TypePodFailed      = "io.splat.test-monitor.pod.failed"
+	TypeRunPassed      = "io.splat.test-monitor.run.passed"
+	TypeRunFailed      = "io.splat.test-monitor.run.failed"
+	TypeRunCorrected   = "io.splat.test-monitor.run.corrected"
+
+	// DefaultSource is the source of the emitted events unless configured otherwise.
+	DefaultSource = "/test-monitor"
+
+	specVersion     = "1.0"
+	dataContentType = "application/json"
+)
+
+// Event is a CloudEvent in its structured JSON encoding.
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// NewEvent creates an event of the given type about a namespace.
+func NewEvent(source, eventType, namespace string, payload interface{}) (Event, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		SpecVersion:     specVersion,
+		ID:              uuid.NewString(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         namespace,
+		Time:            time.Now().UTC(),
+		DataContentType: dataContentType,
+		Data:            encoded,
+	}, nil
+}
+
+// ContextCreated is the data of a context created event.
+type ContextCreated struct {
+	data.Job
+	Namespace string    `json:"namespace"`
+	TestName  string    `json:"test_name"`
+	Variant   string    `json:"variant"`
+	JobType   string    `json:"job_type"`
+	Created   time.Time `json:"created"`
+}
+
+// NewContextCreated describes a newly seen test context.
+func NewContextCreated(testContext *data.TestContext) ContextCreated {
+	return ContextCreated{
+		Job:       data.NewJob(testContext.Namespace),
+		Namespace: testContext.Namespace.Name,
+		TestName:  testContext.TestName(),
+		Variant:   testContext.Variant(),
+		JobType:   testContext.JobType(),
+		Created:   testContext.Namespace.CreationTimestamp.Time,
+	}
+}
+
+// LeaseBound is the data of a lease bound event.
+type LeaseBound struct {
+	Namespace    string        `json:"namespace"`
+	Lease        string        `json:"lease"`
+	Pool         string        `json:"pool"`
+	NetworkType  string        `json:"network_type"`
+	Portgroup    string        `json:"portgroup"`
+	Topology     data.Topology `json:"topology"`
+	LeaseCreated time.Time     `json:"lease_created"`
+	Leased       time.Time     `json:"leased"`
+
+	Concurrency *data.Concurrency `json:"concurrency,omitempty"`
+}
+
+// NewLeaseBound describes the lease which was fulfilled for a test context.
+func NewLeaseBound(testContext *data.TestContext, lease string) LeaseBound {
+	return LeaseBound{
+		Namespace:    testContext.Namespace.Name,
+		Lease:        lease,
+		Pool:         testContext.Pool,
+		NetworkType:  testContext.NetworkType,
+		Portgroup:    testContext.Portgroup,
+		Topology:     testContext.Topology,
+		LeaseCreated: testContext.LeaseCreated,
+		Leased:       testContext.LeasedAt,
+		Concurrency:  testContext.ConcurrencyAtLease,
+	}
+}
+
+// PodFailed is the data of a pod failed event.
+type PodFailed struct {
+	data.PodFailure
+	Namespace string `json:"namespace"`
+	TestName  string `json:"test_name"`
+	Variant   string `json:"variant"`
+	Pool      string `json:"pool"`
+	Portgroup string `json:"portgroup"`
+}
+
+// NewPodFailed describes a pod failure of a test context.
+func NewPodFailed(testContext *data.TestContext, failure data.PodFailure) PodFailed {
+	return PodFailed{
+		PodFailure: failure,
+		Namespace:  testContext.Namespace.Name,
+		TestName:   testContext.TestName(),
+		Variant:    testContext.Variant(),
+		Pool:       testContext.Pool,
+		Portgroup:  testContext.Portgroup,
+	}
+}
@@ -0,0 +1,209 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP content modes of CloudEvents.
+const (
+	// ModeStructured posts the whole event as the JSON body.
+	ModeStructured = "structured"
+	// ModeBinary posts the data as the body and the attributes as ce- headers.
+	ModeBinary = "binary"
+
+	structuredContentType = "application/cloudevents+json"
+
+	requestTimeout = 30 * time.Second
+)
+
+// Sink delivers events to a destination.
+type Sink interface {
+	// Name identifies the sink in logs and metrics.
+	Name() string
+	// Send delivers an event. Errors for which IsPermanent is true are not retried.
+	Send(ctx context.Context, event Event) error
+}
+
+// permanentError marks a delivery error which a retry will not fix.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// IsPermanent returns true if retrying the delivery cannot succeed.
+func IsPermanent(err error) bool {
+	return errors.As(err, &permanentError{})
+}
+
+// HTTPSink posts events to an HTTP endpoint.
+type HTTPSink struct {
+	URL string
+	// Mode is either ModeStructured or ModeBinary.
+	Mode string
+	// Client is used to post the events. A default client is used if nil.
+	Client *http.Client
+}
+
+func (s *HTTPSink) Name() string {
+	return "http"
+}
+
+func (s *HTTPSink) Send(ctx context.Context, event Event) error {
+	var body []byte
+	header := http.Header{}
+	switch s.Mode {
+	case ModeBinary:
+		body = event.Data
+		header.Set("Content-Type", event.DataContentType)
+		header.Set("ce-specversion", event.SpecVersion)
+		header.Set("ce-id", event.ID)
+		header.Set("ce-source", event.Source)
+		header.Set("ce-type", event.Type)
+		header.Set("ce-time", event.Time.Format(time.RFC3339Nano))
+		if len(event.Subject) > 0 {
+			header.Set("ce-subject", event.Subject)
+		}
+	default:
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			return permanentError{fmt.Errorf("error encoding event: %w", err)}
+		}
+		body = encoded
+		header.Set("Content-Type", structuredContentType)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{fmt.Errorf("error creating request: %w", err)}
+	}
+	req.Header = header
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting event to %s: %w", s.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s responded with %s: %s", s.URL, resp.Status, strings.TrimSpace(string(message)))
+	// client errors other than throttling will fail again
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout {
+		return permanentError{err}
+	}
+	return err
+}
+
+// FileSink appends events as JSON lines to a file which is rotated once it
+// grows beyond MaxBytes. Rotated files are suffixed with the rotation time
+// and only the most recent MaxFiles are kept.
+type FileSink struct {
+	Path     string
+	MaxBytes int64
+	MaxFiles int
+
+	file  *os.File
+	size  int64
+	mutex sync.Mutex
+}
+
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+func (s *FileSink) Send(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return permanentError{fmt.Errorf("error encoding event: %w", err)}
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file != nil && s.MaxBytes > 0 && s.size+int64(len(line)) > s.MaxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if s.file == nil {
+		file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open file %s: %w", s.Path, err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to stat file %s: %w", s.Path, err)
+		}
+		s.file, s.size = file, info.Size()
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", s.Path, err)
+	}
+	return nil
+}
+
+// rotate renames the current file and removes the oldest rotated files.
+func (s *FileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	rotated := fmt.Sprintf("%s.%s", s.Path, time.Now().UTC().Format("20060102T150405.000"))
+	if err := os.Rename(s.Path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate file %s: %w", s.Path, err)
+	}
+	if s.MaxFiles <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(s.Path + ".*")
+	if err != nil {
+		return fmt.Errorf("failed to list rotated files of %s: %w", s.Path, err)
+	}
+	// the rotation time suffix sorts chronologically
+	sort.Strings(matches)
+	for len(matches) > s.MaxFiles {
+		if err := os.Remove(matches[0]); err != nil {
+			return fmt.Errorf("failed to remove rotated file %s: %w", matches[0], err)
+		}
+		matches = matches[1:]
+	}
+	return nil
+}
+
+// Close closes the current file.
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,150 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	defaultWindow   = 7 * 24 * time.Hour
+	defaultInterval = 5 * time.Minute
+)
+
+// RatesResponse holds the latest flake rates returned by the API.
+type RatesResponse struct {
+	Window string `json:"window"`
+	Rates  []Rate `json:"rates"`
+}
+
+// Analyzer periodically computes flake rates over the runs completed within a
+// rolling window.
+type Analyzer struct {
+	// Window is how far back completed runs are grouped into reruns.
+	Window time.Duration
+	// Interval is how often flake rates are recomputed.
+	Interval time.Duration
+
+	poolRates      []Rate
+	portgroupRates []Rate
+
+	poolGauge      *prometheus.GaugeVec
+	portgroupGauge *prometheus.GaugeVec
+
+	testContext *testcontext.TestContextService
+	mutex       sync.Mutex
+
+	log logr.Logger
+}
+
+func (a *Analyzer) SetupWithManager(mgr ctrl.Manager,
+	testContext *testcontext.TestContextService) error {
+	a.testContext = testContext
+	a.log = mgr.GetLogger().WithName("flake")
+	if a.Window <= 0 {
+		a.Window = defaultWindow
+	}
+	if a.Interval <= 0 {
+		a.Interval = defaultInterval
+	}
+
+	a.poolGauge = monitor.PoolFlakeRate.NewGaugeVec()
+	a.portgroupGauge = monitor.PortgroupFlakeRate.NewGaugeVec()
+	if err := monitor.PoolFlakeRate.Register(a.poolGauge); err != nil {
+		return fmt.Errorf("error registering pool flake metric: %w", err)
+	}
+	if err := monitor.PortgroupFlakeRate.Register(a.portgroupGauge); err != nil {
+		return fmt.Errorf("error registering portgroup flake metric: %w", err)
+	}
+
+	if err := mgr.Add(a); err != nil {
+		return fmt.Errorf("error adding flake analyzer to manager: %w", err)
+	}
+	return nil
+}
+
+// SetupWithServer exposes the latest flake rates through the API.
+func (a *Analyzer) SetupWithServer(server *api.Server) {
+	server.Handle("GET /api/v1/flakes/pools", a.ratesHandler(func() []Rate { return a.PoolRates() }))
+	server.Handle("GET /api/v1/flakes/portgroups", a.ratesHandler(func() []Rate { return a.PortgroupRates() }))
+}
+
+// Start recomputes the flake rates every interval until the context is cancelled.
+func (a *Analyzer) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, a.update, a.Interval)
+	return nil
+}
+
+// NeedLeaderElection allows every replica to compute flake rates for its API.
+func (a *Analyzer) NeedLeaderElection() bool {
+	return false
+}
+
+// PoolRates returns the latest pool flake rates.
+func (a *Analyzer) PoolRates() []Rate {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]Rate(nil), a.poolRates...)
+}
+
+// PortgroupRates returns the latest portgroup flake rates.
+func (a *Analyzer) PortgroupRates() []Rate {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]Rate(nil), a.portgroupRates...)
+}
+
+func (a *Analyzer) update(ctx context.Context) {
+	runs := a.testContext.QueryRuns(ledger.Filter{Since: time.Now().Add(-a.Window)})
+
+	poolRates, err := Rates(runs, ledger.DimensionPool)
+	if err != nil {
+		a.log.Error(err, "error computing pool flake rates")
+		return
+	}
+	portgroupRates, err := Rates(runs, ledger.DimensionPortgroup)
+	if err != nil {
+		a.log.Error(err, "error computing portgroup flake rates")
+		return
+	}
+
+	a.mutex.Lock()
+	a.poolRates = poolRates
+	a.portgroupRates = portgroupRates
+	a.mutex.Unlock()
+
+	setRateGauge(a.poolGauge, poolRates)
+	setRateGauge(a.portgroupGauge, portgroupRates)
+	a.log.V(1).Info("updated flake rates", "runs", len(runs), "pools", len(poolRates), "portgroups", len(portgroupRates))
+}
+
+// setRateGauge replaces the gauge series with the given rates so that pools
+// which dropped out of the window are no longer exported.
+func setRateGauge(gauge *prometheus.GaugeVec, rates []Rate) {
+	gauge.Reset()
+	for _, rate := range rates {
+		gauge.WithLabelValues(rate.Name).Set(rate.FlakeRate)
+	}
+}
+
+func (a *Analyzer) ratesHandler(rates func() []Rate) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := api.WriteJSON(w, http.StatusOK, RatesResponse{
+			Window: a.Window.String(),
+			Rates:  rates(),
+		}); err != nil {
+			a.log.Error(err, "error encoding response")
+		}
+	})
+}
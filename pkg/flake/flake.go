@@ -0,0 +1,101 @@
+package flake
+
+import (
+	"sort"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+)
+
+// Rate is the share of the runs of a pool or portgroup which failed and then
+// passed when rerun for the same commit.
+type Rate struct {
+	// Dimension is either ledger.DimensionPool or ledger.DimensionPortgroup.
+	Dimension string `json:"dimension"`
+	Name      string `json:"name"`
+	Runs      int    `json:"runs"`
+	Failures  int    `json:"failures"`
+	Flakes    int    `json:"flakes"`
+	// FlakeRate is the share of runs which were flakes.
+	FlakeRate float64 `json:"flake_rate"`
+	// FlakeShare is the share of failures which were flakes.
+	FlakeShare float64 `json:"flake_share"`
+}
+
+// Classify returns the namespaces of the failed runs which were followed by a
+// passing rerun of the same job for the same commit.
+func Classify(runs []data.RunRecord) map[string]bool {
+	reruns := make(map[string][]*data.RunRecord)
+	for i := range runs {
+		if key := runs[i].RerunKey(); len(key) > 0 {
+			reruns[key] = append(reruns[key], &runs[i])
+		}
+	}
+
+	flakes := make(map[string]bool)
+	for _, group := range reruns {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].Completed.Before(group[j].Completed)
+		})
+
+		// every failure before the last pass of the commit was retested away
+		lastPass := -1
+		for i, run := range group {
+			if !run.Failed {
+				lastPass = i
+			}
+		}
+		for _, run := range group[:max(lastPass, 0)] {
+			if run.Failed {
+				flakes[run.Namespace] = true
+			}
+		}
+	}
+	return flakes
+}
+
+// Rates computes the flake rate of every value of the dimension found in the runs.
+func Rates(runs []data.RunRecord, dimension string) ([]Rate, error) {
+	flakes := Classify(runs)
+
+	rates := make(map[string]*Rate)
+	for i := range runs {
+		run := &runs[i]
+		name, err := ledger.DimensionValue(run, dimension)
+		if err != nil {
+			return nil, err
+		}
+		if len(name) == 0 {
+			continue
+		}
+
+		rate, exists := rates[name]
+		if !exists {
+			rate = &Rate{Dimension: dimension, Name: name}
+			rates[name] = rate
+		}
+		rate.Runs++
+		if run.Failed {
+			rate.Failures++
+		}
+		if flakes[run.Namespace] {
+			rate.Flakes++
+		}
+	}
+
+	result := make([]Rate, 0, len(rates))
+	for _, rate := range rates {
+		rate.FlakeRate = float64(rate.Flakes) / float64(rate.Runs)
+		if rate.Failures > 0 {
+			rate.FlakeShare = float64(rate.Flakes) / float64(rate.Failures)
+		}
+		result = append(result, *rate)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
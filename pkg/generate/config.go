@@ -0,0 +1,132 @@
+package generate
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Severities of the generated alerts.
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+const (
+	defaultRuleName             = "test-monitor"
+	defaultFailureRateThreshold = 0.5
+	defaultFailureRateWindow    = 6 * time.Hour
+	defaultFailureRateMinRuns   = 5
+	defaultHealthScoreThreshold = 3
+)
+
+// Config configures the generated dashboard and alerting rules.
+type Config struct {
+	// Selector restricts every query to the series of this monitor, e.g. job="test-monitor".
+	Selector string `json:"selector,omitempty"`
+
+	// Name and Namespace of the PrometheusRule.
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Labels of the PrometheusRule, e.g. to match the rule selector of the Prometheus.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	PoolFailureRate FailureRateAlert `json:"pool_failure_rate,omitempty"`
+	PoolHealthScore Alert            `json:"pool_health_score,omitempty"`
+	LeakedLeases    Alert            `json:"leaked_leases,omitempty"`
+	StuckRuns       Alert            `json:"stuck_runs,omitempty"`
+}
+
+// Alert configures an alert which fires while a metric is above its threshold.
+type Alert struct {
+	// Disabled leaves the alert out of the rules.
+	Disabled  bool    `json:"disabled,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+	// For is how long the threshold must be exceeded before the alert fires.
+	For      metav1.Duration `json:"for,omitempty"`
+	Severity string          `json:"severity,omitempty"`
+}
+
+// FailureRateAlert configures the alert on the failure rate of the runs on a pool.
+type FailureRateAlert struct {
+	Alert `json:",inline"`
+	// Window is the range the failure rate is computed over.
+	Window metav1.Duration `json:"window,omitempty"`
+	// MinRuns is the number of runs a pool needs in the window before the alert can fire.
+	MinRuns int `json:"min_runs,omitempty"`
+}
+
+// DefaultConfig returns the config used without a config file.
+func DefaultConfig() *Config {
+	config := &Config{}
+	config.applyDefaults()
+	return config
+}
+
+// LoadConfig reads the generator config from a YAML file and applies the defaults.
+func LoadConfig(filename string) (*Config, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+	}
+
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, fmt.Errorf("failed to decode generator config %s: %w", filename, err)
+	}
+	config.applyDefaults()
+
+	for name, alert := range map[string]*Alert{
+		"pool_failure_rate": &config.PoolFailureRate.Alert,
+		"pool_health_score": &config.PoolHealthScore,
+		"leaked_leases":     &config.LeakedLeases,
+		"stuck_runs":        &config.StuckRuns,
+	} {
+		if alert.Threshold < 0 {
+			return nil, fmt.Errorf("alert %s has a negative threshold", name)
+		}
+		if alert.Severity != SeverityWarning && alert.Severity != SeverityCritical {
+			return nil, fmt.Errorf("alert %s has an invalid severity %q, must be %s or %s", name, alert.Severity, SeverityWarning, SeverityCritical)
+		}
+	}
+	if config.PoolFailureRate.Threshold > 1 {
+		return nil, fmt.Errorf("the pool_failure_rate threshold is a share of runs and must not exceed 1")
+	}
+	return config, nil
+}
+
+func (c *Config) applyDefaults() {
+	if len(c.Name) == 0 {
+		c.Name = defaultRuleName
+	}
+	if c.PoolFailureRate.Threshold == 0 {
+		c.PoolFailureRate.Threshold = defaultFailureRateThreshold
+	}
+	if c.PoolFailureRate.Window.Duration <= 0 {
+		c.PoolFailureRate.Window.Duration = defaultFailureRateWindow
+	}
+	if c.PoolFailureRate.MinRuns <= 0 {
+		c.PoolFailureRate.MinRuns = defaultFailureRateMinRuns
+	}
+	if c.PoolHealthScore.Threshold == 0 {
+		c.PoolHealthScore.Threshold = defaultHealthScoreThreshold
+	}
+
+	// leaked leases and stuck runs fire on the first one, i.e. above a threshold of 0
+	for alert, wait := range map[*Alert]time.Duration{
+		&c.PoolFailureRate.Alert: 30 * time.Minute,
+		&c.PoolHealthScore:       time.Hour,
+		&c.LeakedLeases:          15 * time.Minute,
+		&c.StuckRuns:             30 * time.Minute,
+	} {
+		if alert.For.Duration <= 0 {
+			alert.For.Duration = wait
+		}
+		if len(alert.Severity) == 0 {
+			alert.Severity = SeverityWarning
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+)
+
+const (
+	dashboardUID = "test-monitor"
+	// schemaVersion is the version of the Grafana dashboard schema the dashboard is written in.
+	schemaVersion = 39
+	// datasourceVariable is the template variable selecting the Prometheus datasource.
+	datasourceVariable = "datasource"
+
+	panelWidth  = 12
+	panelHeight = 8
+	gridWidth   = 24
+)
+
+// Dashboard is a Grafana dashboard.
+type Dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	Editable      bool       `json:"editable"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Time          TimeRange  `json:"time"`
+	Refresh       string     `json:"refresh"`
+	Templating    Templating `json:"templating"`
+	Panels        []Panel    `json:"panels"`
+}
+
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+type Variable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type Datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type GridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Panel is a row or a time series panel.
+type Panel struct {
+	ID          int          `json:"id"`
+	Type        string       `json:"type"`
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	GridPos     GridPos      `json:"gridPos"`
+	Datasource  *Datasource  `json:"datasource,omitempty"`
+	Targets     []Target     `json:"targets,omitempty"`
+	FieldConfig *FieldConfig `json:"fieldConfig,omitempty"`
+	Collapsed   *bool        `json:"collapsed,omitempty"`
+}
+
+type Target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+type FieldConfig struct {
+	Defaults FieldDefaults `json:"defaults"`
+}
+
+type FieldDefaults struct {
+	Unit       string      `json:"unit,omitempty"`
+	Custom     *Custom     `json:"custom,omitempty"`
+	Thresholds *Thresholds `json:"thresholds,omitempty"`
+}
+
+type Custom struct {
+	ThresholdsStyle ThresholdsStyle `json:"thresholdsStyle"`
+}
+
+type ThresholdsStyle struct {
+	Mode string `json:"mode"`
+}
+
+type Thresholds struct {
+	Mode  string      `json:"mode"`
+	Steps []Threshold `json:"steps"`
+}
+
+// Threshold is a step of the thresholds. The value of the base step is null.
+type Threshold struct {
+	Color string   `json:"color"`
+	Value *float64 `json:"value"`
+}
+
+// dashboardBuilder lays out panels in rows of two.
+type dashboardBuilder struct {
+	config *Config
+	panels []Panel
+	nextID int
+	x, y   int
+}
+
+// NewDashboard returns a dashboard with a row of the alerts followed by a row
+// for every enabled metric group, holding a panel for each of its metrics.
+func NewDashboard(config *Config) *Dashboard {
+	builder := &dashboardBuilder{config: config}
+
+	if rules := config.alertRules(); len(rules) > 0 {
+		builder.row("Alerts")
+		for _, rule := range rules {
+			builder.panel(rule.title, rule.description, rule.unit, rule.config.Threshold, Target{
+				RefID:        "A",
+				Expr:         rule.query,
+				LegendFormat: "{{pool}}",
+			})
+		}
+	}
+
+	for _, group := range monitor.Groups {
+		if !monitor.Enabled(group.Name) {
+			continue
+		}
+		var metrics []*monitor.Metric
+		for _, metric := range monitor.Catalog {
+			if metric.Group == group.Name {
+				metrics = append(metrics, metric)
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		builder.row(strings.TrimSuffix(group.Description, "."))
+		for _, metric := range metrics {
+			builder.panel(metric.Name, metric.Help, unit(metric), 0, builder.target(metric))
+		}
+	}
+
+	return &Dashboard{
+		UID:           dashboardUID,
+		Title:         "test-monitor",
+		Tags:          []string{"test-monitor"},
+		Editable:      true,
+		SchemaVersion: schemaVersion,
+		Time:          TimeRange{From: "now-24h", To: "now"},
+		Refresh:       "1m",
+		Templating: Templating{List: []Variable{{
+			Name:  datasourceVariable,
+			Label: "Data source",
+			Type:  "datasource",
+			Query: "prometheus",
+		}}},
+		Panels: builder.panels,
+	}
+}
+
+// MarshalDashboard returns the dashboard as JSON.
+func MarshalDashboard(config *Config) ([]byte, error) {
+	return json.MarshalIndent(NewDashboard(config), "", "  ")
+}
+
+func (b *dashboardBuilder) row(title string) {
+	if b.x > 0 {
+		b.x, b.y = 0, b.y+panelHeight
+	}
+	collapsed := false
+	b.nextID++
+	b.panels = append(b.panels, Panel{
+		ID:        b.nextID,
+		Type:      "row",
+		Title:     title,
+		GridPos:   GridPos{X: 0, Y: b.y, W: gridWidth, H: 1},
+		Collapsed: &collapsed,
+	})
+	b.y++
+}
+
+// panel adds a time series panel, with a threshold line if threshold is not 0.
+func (b *dashboardBuilder) panel(title, description, unit string, threshold float64, target Target) {
+	defaults := FieldDefaults{Unit: unit}
+	if threshold != 0 {
+		defaults.Custom = &Custom{ThresholdsStyle: ThresholdsStyle{Mode: "line"}}
+		defaults.Thresholds = &Thresholds{
+			Mode: "absolute",
+			Steps: []Threshold{
+				{Color: "green"},
+				{Color: "red", Value: &threshold},
+			},
+		}
+	}
+
+	b.nextID++
+	b.panels = append(b.panels, Panel{
+		ID:          b.nextID,
+		Type:        "timeseries",
+		Title:       title,
+		Description: description,
+		GridPos:     GridPos{X: b.x, Y: b.y, W: panelWidth, H: panelHeight},
+		Datasource:  &Datasource{Type: "prometheus", UID: "${" + datasourceVariable + "}"},
+		Targets:     []Target{target},
+		FieldConfig: &FieldConfig{Defaults: defaults},
+	})
+	if b.x += panelWidth; b.x >= gridWidth {
+		b.x, b.y = 0, b.y+panelHeight
+	}
+}
+
+// target returns the query of the panel of a metric: the per second rate of
+// counters, the 90th percentile of histograms, the age of timestamps and
+// other gauges as they are.
+func (b *dashboardBuilder) target(metric *monitor.Metric) Target {
+	target := Target{RefID: "A", LegendFormat: legend(metric.Labels)}
+	switch metric.Type {
+	case monitor.TypeCounter:
+		target.Expr = fmt.Sprintf("rate(%s[$__rate_interval])", b.config.series(metric))
+	case monitor.TypeHistogram:
+		by := strings.Join(append([]string{"le"}, metric.Labels...), ", ")
+		target.Expr = fmt.Sprintf("histogram_quantile(0.9, sum by (%s) (rate(%s[$__rate_interval])))", by, b.config.seriesOf(metric.Name+"_bucket"))
+	default:
+		target.Expr = b.config.series(metric)
+		if strings.HasSuffix(metric.Name, "_timestamp_seconds") {
+			target.Expr = "time() - " + target.Expr
+		}
+	}
+	if len(metric.Labels) == 0 {
+		target.LegendFormat = metric.Name
+	}
+	return target
+}
+
+func legend(labels []string) string {
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		parts[i] = "{{" + label + "}}"
+	}
+	return strings.Join(parts, " ")
+}
+
+// unit returns the Grafana unit of a metric from the suffix of its name.
+func unit(metric *monitor.Metric) string {
+	switch {
+	case strings.HasSuffix(metric.Name, "_seconds"):
+		return "s"
+	case strings.HasSuffix(metric.Name, "_rate") || strings.Contains(metric.Name, "_rate_"):
+		return "percentunit"
+	case metric.Type == monitor.TypeCounter:
+		return "ops"
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/health"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Names of the generated alerts. The health score and leaked lease alerts
+// share their names with the alerts test-monitor notifies about itself.
+const (
+	AlertPoolFailureRate = "PoolFailureRateHigh"
+	AlertPoolDegraded    = "PoolDegraded"
+	AlertLeaseLeaked     = "LeaseLeaked"
+	AlertRunsStuck       = "RunsStuck"
+)
+
+// ruleGroup is the name of the group of the generated rules.
+const ruleGroup = "test-monitor"
+
+// PrometheusRule is the manifest of the alerting rules for the prometheus operator.
+type PrometheusRule struct {
+	metav1.TypeMeta `json:",inline"`
+	Metadata        RuleMetadata `json:"metadata"`
+	Spec            RuleSpec     `json:"spec"`
+}
+
+type RuleMetadata struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type RuleSpec struct {
+	Groups []RuleGroup `json:"groups"`
+}
+
+type RuleGroup struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules"`
+}
+
+type Rule struct {
+	Alert       string            `json:"alert"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// alertRule is an alert on a query exceeding a threshold, shared by the
+// rules and the dashboard panels showing what the alerts watch.
+type alertRule struct {
+	name   string
+	config Alert
+	// metrics are the metrics the query reads, the alert is left out when any of their groups is disabled.
+	metrics []*monitor.Metric
+	// query is the value compared with the threshold.
+	query string
+	// condition limits when the alert may fire, e.g. to pools with enough runs.
+	condition   string
+	title       string
+	unit        string
+	summary     string
+	description string
+}
+
+// alertRules returns the configured alerts whose metrics are exposed.
+func (c *Config) alertRules() []alertRule {
+	failureRate := c.PoolFailureRate
+	window := health.FormatWindow(failureRate.Window.Duration)
+	fails := fmt.Sprintf("sum by (pool) (increase(%s[%s]))", c.series(&monitor.RunFails), window)
+	passes := fmt.Sprintf("sum by (pool) (increase(%s[%s]))", c.series(&monitor.RunPasses), window)
+	// pools without any pass in the window have no passes series, count them as zero
+	runs := fmt.Sprintf("(%s + (%s or 0 * %s))", fails, passes, fails)
+
+	candidates := []alertRule{
+		{
+			name:        AlertPoolFailureRate,
+			config:      failureRate.Alert,
+			metrics:     []*monitor.Metric{&monitor.RunFails, &monitor.RunPasses},
+			query:       fmt.Sprintf("%s / %s", fails, runs),
+			condition:   fmt.Sprintf("%s >= %d", runs, failureRate.MinRuns),
+			title:       fmt.Sprintf("Pool failure rate over %s", window),
+			unit:        "percentunit",
+			summary:     fmt.Sprintf("pool {{ $labels.pool }} failed {{ $value | humanizePercentage }} of its runs over the last %s", window),
+			description: fmt.Sprintf("More than %.0f%% of the runs on the pool failed over the last %s.", 100*failureRate.Threshold, window),
+		},
+		{
+			name:        AlertPoolDegraded,
+			config:      c.PoolHealthScore,
+			metrics:     []*monitor.Metric{&monitor.PoolHealthScore},
+			query:       c.series(&monitor.PoolHealthScore),
+			title:       "Pool health score",
+			summary:     "pool {{ $labels.pool }} fails more often than its tests explain (health score {{ $value | printf \"%.1f\" }})",
+			description: "The failures of the pool lie more standard deviations above the failures expected from the global rate of the same tests and variants than the threshold.",
+		},
+		{
+			name:        AlertLeaseLeaked,
+			config:      c.LeakedLeases,
+			metrics:     []*monitor.Metric{&monitor.LeasesLeaked},
+			query:       fmt.Sprintf("sum by (pool) (%s)", c.series(&monitor.LeasesLeaked)),
+			title:       "Leaked leases",
+			summary:     "{{ $value }} leases on pool {{ $labels.pool }} outlived their namespace",
+			description: "The namespaces of the leases are gone while the leases still hold capacity. GET /api/v1/leases?leaked=true lists them.",
+		},
+		{
+			name:        AlertRunsStuck,
+			config:      c.StuckRuns,
+			metrics:     []*monitor.Metric{&monitor.RunsStuck},
+			query:       fmt.Sprintf("sum by (pool) (%s)", c.series(&monitor.RunsStuck)),
+			title:       "Stuck runs",
+			summary:     "{{ $value }} runs on pool {{ $labels.pool }} are in flight for longer than expected",
+			description: "The runs are in flight for longer than --stuck-run-age. GET /api/v1/contexts lists the runs in flight.",
+		},
+	}
+
+	var rules []alertRule
+	for _, rule := range candidates {
+		if !rule.config.Disabled && exposed(rule.metrics) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// expr is the expression firing the alert.
+func (r *alertRule) expr() string {
+	expr := fmt.Sprintf("%s > %g", r.query, r.config.Threshold)
+	if len(r.condition) > 0 {
+		expr = fmt.Sprintf("(%s)\nand\n%s", expr, r.condition)
+	}
+	return expr
+}
+
+// Rules returns the PrometheusRule alerting on the configured thresholds.
+func Rules(config *Config) *PrometheusRule {
+	group := RuleGroup{Name: ruleGroup, Rules: []Rule{}}
+	for _, rule := range config.alertRules() {
+		group.Rules = append(group.Rules, Rule{
+			Alert: rule.name,
+			Expr:  rule.expr(),
+			For:   health.FormatWindow(rule.config.For.Duration),
+			Labels: map[string]string{
+				"severity": rule.config.Severity,
+			},
+			Annotations: map[string]string{
+				"summary":     rule.summary,
+				"description": rule.description,
+			},
+		})
+	}
+
+	return &PrometheusRule{
+		TypeMeta: metav1.TypeMeta{APIVersion: "monitoring.coreos.com/v1", Kind: "PrometheusRule"},
+		Metadata: RuleMetadata{
+			Name:      config.Name,
+			Namespace: config.Namespace,
+			Labels:    config.Labels,
+		},
+		Spec: RuleSpec{Groups: []RuleGroup{group}},
+	}
+}
+
+// MarshalRules returns the PrometheusRule manifest as YAML.
+func MarshalRules(config *Config) ([]byte, error) {
+	return yaml.Marshal(Rules(config))
+}
+
+// series returns the selector of the series of a metric.
+func (c *Config) series(metric *monitor.Metric) string {
+	return c.seriesOf(metric.Name)
+}
+
+func (c *Config) seriesOf(name string) string {
+	if len(strings.TrimSpace(c.Selector)) == 0 {
+		return name
+	}
+	return name + "{" + c.Selector + "}"
+}
+
+// exposed returns true if the groups of all metrics are enabled.
+func exposed(metrics []*monitor.Metric) bool {
+	for _, metric := range metrics {
+		if !monitor.Enabled(metric.Group) {
+			return false
+		}
+	}
+	return true
+}
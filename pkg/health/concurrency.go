@@ -0,0 +1,126 @@
+package health
+
+import (
+	"sort"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+)
+
+// concurrencyBuckets are the upper bounds of the concurrency levels runs are
+// bucketed into. Runs above the last bound fall into an open ended bucket.
+var concurrencyBuckets = []struct {
+	max  int
+	name string
+}{
+	{0, "0"},
+	{1, "1"},
+	{3, "2-3"},
+	{7, "4-7"},
+	{15, "8-15"},
+}
+
+const overflowConcurrencyBucket = "16+"
+
+// Phases of a run at which its concurrency is recorded.
+const (
+	PhaseLease   = "lease"
+	PhaseFailure = "failure"
+)
+
+// ConcurrencyRate is the failure rate of the runs on a pool or portgroup
+// during which a similar number of other runs were in flight on the same pool
+// or portgroup. In the failure phase only failed runs have a concurrency, so
+// its rates count where failures happened rather than how often runs failed.
+type ConcurrencyRate struct {
+	Pool string `json:"pool"`
+	// Portgroup is empty for the rates of the pool, which are bucketed by the
+	// concurrency on the pool rather than on the portgroup.
+	Portgroup   string  `json:"portgroup,omitempty"`
+	Phase       string  `json:"phase"`
+	Concurrency string  `json:"concurrency"`
+	Runs        int     `json:"runs"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
+// ConcurrencyBucket returns the bucket a number of concurrent runs falls into.
+func ConcurrencyBucket(concurrent int) string {
+	for _, bucket := range concurrencyBuckets {
+		if concurrent <= bucket.max {
+			return bucket.name
+		}
+	}
+	return overflowConcurrencyBucket
+}
+
+// ConcurrencyRates buckets the runs of each pool by the number of other runs
+// in flight on the pool, and the runs of each portgroup by the number of other
+// runs in flight on the portgroup, when they were leased and when they first
+// failed. Runs whose concurrency was not recorded are skipped.
+func ConcurrencyRates(runs []data.RunRecord) []ConcurrencyRate {
+	type rateKey struct {
+		pool, portgroup, phase, concurrency string
+	}
+	rates := make(map[rateKey]*ConcurrencyRate)
+	count := func(key rateKey, failed bool) {
+		rate, exists := rates[key]
+		if !exists {
+			rate = &ConcurrencyRate{Pool: key.pool, Portgroup: key.portgroup, Phase: key.phase, Concurrency: key.concurrency}
+			rates[key] = rate
+		}
+		rate.Runs++
+		if failed {
+			rate.Failures++
+		}
+	}
+	for i := range runs {
+		run := &runs[i]
+		if len(run.Pool) == 0 {
+			continue
+		}
+		for _, phase := range []struct {
+			name        string
+			concurrency *data.Concurrency
+		}{
+			{PhaseLease, run.ConcurrencyAtLease},
+			{PhaseFailure, run.ConcurrencyAtFailure},
+		} {
+			if phase.concurrency == nil {
+				continue
+			}
+			count(rateKey{run.Pool, "", phase.name, ConcurrencyBucket(phase.concurrency.Pool)}, run.Failed)
+			if len(run.Portgroup) > 0 {
+				count(rateKey{run.Pool, run.Portgroup, phase.name, ConcurrencyBucket(phase.concurrency.Portgroup)}, run.Failed)
+			}
+		}
+	}
+
+	result := make([]ConcurrencyRate, 0, len(rates))
+	for _, rate := range rates {
+		rate.FailureRate = float64(rate.Failures) / float64(rate.Runs)
+		result = append(result, *rate)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Pool != result[j].Pool {
+			return result[i].Pool < result[j].Pool
+		}
+		if result[i].Portgroup != result[j].Portgroup {
+			return result[i].Portgroup < result[j].Portgroup
+		}
+		if result[i].Phase != result[j].Phase {
+			// lease before failure
+			return result[i].Phase == PhaseLease
+		}
+		return bucketIndex(result[i].Concurrency) < bucketIndex(result[j].Concurrency)
+	})
+	return result
+}
+
+func bucketIndex(name string) int {
+	for i, bucket := range concurrencyBuckets {
+		if bucket.name == name {
+			return i
+		}
+	}
+	return len(concurrencyBuckets)
+}
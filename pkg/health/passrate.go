@@ -0,0 +1,319 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/openshift-splat-team/test-monitor/pkg/observer"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const defaultPassRateInterval = time.Minute
+
+// DefaultPassRateWindows are the windows pass rates are computed over by default.
+var DefaultPassRateWindows = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+
+// PassRate is the share of runs on a pool, portgroup and variant which
+// passed within a window.
+type PassRate struct {
+	Window    string  `json:"window"`
+	Pool      string  `json:"pool"`
+	Portgroup string  `json:"portgroup"`
+	Variant   string  `json:"variant"`
+	Runs      int     `json:"runs"`
+	Passed    int     `json:"passed"`
+	PassRate  float64 `json:"pass_rate"`
+}
+
+type passRateKey struct {
+	pool      string
+	portgroup string
+	variant   string
+}
+
+// outcome is a run which completed within the longest window.
+type outcome struct {
+	key       passRateKey
+	namespace string
+	completed time.Time
+	failed    bool
+}
+
+// PassRates keeps the outcomes of the runs completed within rolling windows
+// in memory and exports the pass rate over each window as gauges, so
+// consumers need no increase() queries and restarts do not reset the rates.
+// The windows are seeded from the run ledger and then follow completed and
+// corrected runs.
+type PassRates struct {
+	observer.NopObserver
+
+	// Windows are the windows pass rates are computed over.
+	Windows []time.Duration
+	// Interval is how often the windows slide.
+	Interval time.Duration
+
+	// outcomes are ordered by completion.
+	outcomes []outcome
+	rates    []PassRate
+
+	mutex sync.Mutex
+
+	log logr.Logger
+}
+
+func (p *PassRates) SetupWithManager(mgr ctrl.Manager,
+	testContext *testcontext.TestContextService) error {
+	p.log = mgr.GetLogger().WithName("passrate")
+	if len(p.Windows) == 0 {
+		p.Windows = DefaultPassRateWindows
+	}
+	if p.Interval <= 0 {
+		p.Interval = defaultPassRateInterval
+	}
+
+	if err := monitor.PoolPassRate.Register(newPassRateCollector(p)); err != nil {
+		return fmt.Errorf("error registering pool pass rate metrics: %w", err)
+	}
+
+	// seed the windows before any run completes
+	longest := p.longestWindow()
+	for _, run := range testContext.QueryRuns(ledger.Filter{Since: time.Now().Add(-longest)}) {
+		p.add(&run)
+	}
+	p.log.Info("Successfully seeded pass rate windows from the run ledger", "runs", len(p.outcomes))
+
+	if err := mgr.Add(p); err != nil {
+		return fmt.Errorf("error adding pass rates to manager: %w", err)
+	}
+	return nil
+}
+
+// SetupWithServer exposes the latest pass rates through the API.
+func (p *PassRates) SetupWithServer(server *api.Server) {
+	server.Handle("GET /api/v1/health/pass-rates", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := api.WriteJSON(w, http.StatusOK, p.PassRates()); err != nil {
+			p.log.Error(err, "error encoding response")
+		}
+	}))
+}
+
+// OnRunCompleted adds a completed run to the windows.
+func (p *PassRates) OnRunCompleted(testContext *data.TestContext, run data.RunRecord) {
+	p.add(&run)
+	p.update(time.Now())
+}
+
+// OnRunCorrected applies the corrected outcome of a run to the windows.
+func (p *PassRates) OnRunCorrected(run data.RunRecord) {
+	if p.correct(&run) {
+		p.update(time.Now())
+	}
+}
+
+// Start slides the windows every interval until the context is cancelled.
+func (p *PassRates) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		p.update(time.Now())
+	}, p.Interval)
+	return nil
+}
+
+// NeedLeaderElection allows every replica to export pass rates.
+func (p *PassRates) NeedLeaderElection() bool {
+	return false
+}
+
+// PassRates returns the latest pass rates.
+func (p *PassRates) PassRates() []PassRate {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]PassRate(nil), p.rates...)
+}
+
+// add inserts the outcome of a run in order of completion. Runs usually
+// complete in order, so it is appended in the common case.
+func (p *PassRates) add(run *data.RunRecord) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	added := outcome{
+		key:       passRateKey{pool: run.Pool, portgroup: run.Portgroup, variant: run.Variant},
+		namespace: run.Namespace,
+		completed: run.Completed,
+		failed:    run.Failed,
+	}
+	i := sort.Search(len(p.outcomes), func(i int) bool {
+		return p.outcomes[i].completed.After(added.completed)
+	})
+	p.outcomes = append(p.outcomes, outcome{})
+	copy(p.outcomes[i+1:], p.outcomes[i:])
+	p.outcomes[i] = added
+}
+
+// correct changes the outcome of a run within the longest window and returns
+// false if the run already left it.
+func (p *PassRates) correct(run *data.RunRecord) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	i := sort.Search(len(p.outcomes), func(i int) bool {
+		return !p.outcomes[i].completed.Before(run.Completed)
+	})
+	for ; i < len(p.outcomes) && p.outcomes[i].completed.Equal(run.Completed); i++ {
+		if p.outcomes[i].namespace == run.Namespace {
+			p.outcomes[i].failed = run.Failed
+			return true
+		}
+	}
+	return false
+}
+
+// update drops the outcomes which left the longest window and recomputes the
+// pass rates of every window.
+func (p *PassRates) update(now time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	expired := sort.Search(len(p.outcomes), func(i int) bool {
+		return now.Sub(p.outcomes[i].completed) <= p.longestWindow()
+	})
+	p.outcomes = append([]outcome(nil), p.outcomes[expired:]...)
+
+	var rates []PassRate
+	for _, window := range p.Windows {
+		type counts struct{ runs, passed int }
+		byKey := make(map[passRateKey]*counts)
+		// outcomes are ordered, so only the tail is within shorter windows
+		for i := len(p.outcomes) - 1; i >= 0 && now.Sub(p.outcomes[i].completed) <= window; i-- {
+			key := p.outcomes[i].key
+			if byKey[key] == nil {
+				byKey[key] = &counts{}
+			}
+			byKey[key].runs++
+			if !p.outcomes[i].failed {
+				byKey[key].passed++
+			}
+		}
+		for key, count := range byKey {
+			rates = append(rates, PassRate{
+				Window:    FormatWindow(window),
+				Pool:      key.pool,
+				Portgroup: key.portgroup,
+				Variant:   key.variant,
+				Runs:      count.runs,
+				Passed:    count.passed,
+				PassRate:  float64(count.passed) / float64(count.runs),
+			})
+		}
+	}
+	// keep the order of the windows for each pool
+	sort.SliceStable(rates, func(a, b int) bool {
+		if rates[a].Pool != rates[b].Pool {
+			return rates[a].Pool < rates[b].Pool
+		}
+		if rates[a].Portgroup != rates[b].Portgroup {
+			return rates[a].Portgroup < rates[b].Portgroup
+		}
+		return rates[a].Variant < rates[b].Variant
+	})
+	p.rates = rates
+}
+
+// passRateCollector exports the latest pass rates each time it is scraped, so
+// pools which dropped out of a window disappear without resetting gauges a
+// scrape could observe empty.
+type passRateCollector struct {
+	passRates *PassRates
+
+	passRate *prometheus.Desc
+	runs     *prometheus.Desc
+}
+
+func newPassRateCollector(passRates *PassRates) *passRateCollector {
+	return &passRateCollector{
+		passRates: passRates,
+		passRate:  monitor.PoolPassRate.NewDesc(),
+		runs:      monitor.PoolRunsWindow.NewDesc(),
+	}
+}
+
+func (c *passRateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.passRate
+	ch <- c.runs
+}
+
+func (c *passRateCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, rate := range c.passRates.PassRates() {
+		labels := []string{rate.Pool, rate.Portgroup, rate.Variant, rate.Window}
+		ch <- prometheus.MustNewConstMetric(c.passRate, prometheus.GaugeValue, rate.PassRate, labels...)
+		ch <- prometheus.MustNewConstMetric(c.runs, prometheus.GaugeValue, float64(rate.Runs), labels...)
+	}
+}
+
+func (p *PassRates) longestWindow() time.Duration {
+	longest := time.Duration(0)
+	for _, window := range p.Windows {
+		if window > longest {
+			longest = window
+		}
+	}
+	return longest
+}
+
+// ParseWindows parses a comma separated list of windows. Windows are Go
+// durations, or a number of days such as 7d.
+func ParseWindows(value string) ([]time.Duration, error) {
+	var windows []time.Duration
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+		var window time.Duration
+		if days, found := strings.CutSuffix(field, "d"); found {
+			count, err := strconv.Atoi(days)
+			if err != nil {
+				return nil, fmt.Errorf("invalid window %q: %w", field, err)
+			}
+			window = time.Duration(count) * 24 * time.Hour
+		} else {
+			var err error
+			if window, err = time.ParseDuration(field); err != nil {
+				return nil, fmt.Errorf("invalid window %q: %w", field, err)
+			}
+		}
+		if window <= 0 {
+			return nil, fmt.Errorf("window %q is not positive", field)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// FormatWindow formats a window as the value of the window label, e.g. 1h,
+// 24h or 7d.
+func FormatWindow(window time.Duration) string {
+	switch {
+	case window > 24*time.Hour && window%(24*time.Hour) == 0:
+		return strconv.Itoa(int(window/(24*time.Hour))) + "d"
+	case window%time.Hour == 0:
+		return strconv.Itoa(int(window/time.Hour)) + "h"
+	case window%time.Minute == 0:
+		return strconv.Itoa(int(window/time.Minute)) + "m"
+	}
+	return window.String()
+}
@@ -0,0 +1,124 @@
+package health
+
+import (
+	"math"
+	"sort"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+)
+
+// wilsonZ is the standard normal quantile used for the 95% Wilson intervals.
+const wilsonZ = 1.96
+
+// Score compares the failure rate of a pool or portgroup with the failure
+// rate all pools achieve for the same tests and variants.
+type Score struct {
+	// Dimension is either ledger.DimensionPool or ledger.DimensionPortgroup.
+	Dimension string `json:"dimension"`
+	Name      string `json:"name"`
+	Runs      int    `json:"runs"`
+	Failures  int    `json:"failures"`
+
+	FailureRate      float64 `json:"failure_rate"`
+	FailureRateLower float64 `json:"failure_rate_lower"`
+	FailureRateUpper float64 `json:"failure_rate_upper"`
+
+	// ExpectedFailureRate is the failure rate the pool would have if each of
+	// its runs failed as often as the same test and variant fails globally.
+	ExpectedFailureRate float64 `json:"expected_failure_rate"`
+
+	// ZScore is how many standard deviations the observed failures lie above
+	// the expected failures. Positive scores mean the pool fails more often
+	// than its mix of tests explains.
+	ZScore float64 `json:"z_score"`
+}
+
+// WilsonInterval returns the Wilson score interval of a binomial proportion.
+func WilsonInterval(successes, total int, z float64) (float64, float64) {
+	if total == 0 {
+		return 0, 1
+	}
+	n := float64(total)
+	p := float64(successes) / n
+	z2 := z * z
+
+	center := p + z2/(2*n)
+	margin := z * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+	denominator := 1 + z2/n
+
+	return math.Max(0, (center-margin)/denominator), math.Min(1, (center+margin)/denominator)
+}
+
+// stratum totals the runs of a single test and variant.
+type stratum struct {
+	runs     int
+	failures int
+}
+
+// ScoreRuns scores every value of the dimension found in the runs. Runs are
+// stratified by test name and variant so a pool running harder tests is not
+// penalized for it.
+func ScoreRuns(runs []data.RunRecord, dimension string) ([]Score, error) {
+	global := make(map[string]*stratum)
+	groups := make(map[string]map[string]*stratum)
+
+	for i := range runs {
+		run := &runs[i]
+		name, err := ledger.DimensionValue(run, dimension)
+		if err != nil {
+			return nil, err
+		}
+		if len(name) == 0 {
+			continue
+		}
+
+		key := run.TestName + "/" + run.Variant
+		for _, strata := range []map[string]*stratum{global, groupStrata(groups, name)} {
+			s, exists := strata[key]
+			if !exists {
+				s = &stratum{}
+				strata[key] = s
+			}
+			s.runs++
+			if run.Failed {
+				s.failures++
+			}
+		}
+	}
+
+	scores := make([]Score, 0, len(groups))
+	for name, strata := range groups {
+		score := Score{Dimension: dimension, Name: name}
+		var expected, variance float64
+		for key, s := range strata {
+			globalRate := float64(global[key].failures) / float64(global[key].runs)
+			score.Runs += s.runs
+			score.Failures += s.failures
+			expected += float64(s.runs) * globalRate
+			variance += float64(s.runs) * globalRate * (1 - globalRate)
+		}
+
+		score.FailureRate = float64(score.Failures) / float64(score.Runs)
+		score.FailureRateLower, score.FailureRateUpper = WilsonInterval(score.Failures, score.Runs, wilsonZ)
+		score.ExpectedFailureRate = expected / float64(score.Runs)
+		if variance > 0 {
+			score.ZScore = (float64(score.Failures) - expected) / math.Sqrt(variance)
+		}
+		scores = append(scores, score)
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].Name < scores[j].Name
+	})
+	return scores, nil
+}
+
+func groupStrata(groups map[string]map[string]*stratum, name string) map[string]*stratum {
+	strata, exists := groups[name]
+	if !exists {
+		strata = make(map[string]*stratum)
+		groups[name] = strata
+	}
+	return strata
+}
@@ -0,0 +1,195 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	defaultWindow   = 72 * time.Hour
+	defaultInterval = 5 * time.Minute
+)
+
+// ScoresResponse holds the latest scores returned by the API.
+type ScoresResponse struct {
+	Window string  `json:"window"`
+	Scores []Score `json:"scores"`
+}
+
+// ConcurrencyResponse holds the latest failure rates by concurrency returned by the API.
+type ConcurrencyResponse struct {
+	Window string            `json:"window"`
+	Rates  []ConcurrencyRate `json:"rates"`
+}
+
+// Scorer periodically scores pools and portgroups over the runs completed
+// within a rolling window.
+type Scorer struct {
+	// Window is how far back completed runs are scored.
+	Window time.Duration
+	// Interval is how often scores are recomputed.
+	Interval time.Duration
+
+	poolScores       []Score
+	portgroupScores  []Score
+	concurrencyRates []ConcurrencyRate
+
+	poolGauge               *prometheus.GaugeVec
+	portgroupGauge          *prometheus.GaugeVec
+	concurrencyFailureGauge *prometheus.GaugeVec
+	concurrencyRunsGauge    *prometheus.GaugeVec
+
+	testContext *testcontext.TestContextService
+	mutex       sync.Mutex
+
+	log logr.Logger
+}
+
+func (s *Scorer) SetupWithManager(mgr ctrl.Manager,
+	testContext *testcontext.TestContextService) error {
+	s.testContext = testContext
+	s.log = mgr.GetLogger().WithName("health")
+	if s.Window <= 0 {
+		s.Window = defaultWindow
+	}
+	if s.Interval <= 0 {
+		s.Interval = defaultInterval
+	}
+
+	s.poolGauge = monitor.PoolHealthScore.NewGaugeVec()
+	s.portgroupGauge = monitor.PortgroupHealthScore.NewGaugeVec()
+	s.concurrencyFailureGauge = monitor.PoolFailureRateByConcurrency.NewGaugeVec()
+	s.concurrencyRunsGauge = monitor.PoolRunsByConcurrency.NewGaugeVec()
+	if err := monitor.PoolHealthScore.Register(s.poolGauge); err != nil {
+		return fmt.Errorf("error registering pool health metric: %w", err)
+	}
+	if err := monitor.PortgroupHealthScore.Register(s.portgroupGauge); err != nil {
+		return fmt.Errorf("error registering portgroup health metric: %w", err)
+	}
+	if err := monitor.PoolFailureRateByConcurrency.Register(s.concurrencyFailureGauge); err != nil {
+		return fmt.Errorf("error registering concurrency failure rate metric: %w", err)
+	}
+	if err := monitor.PoolRunsByConcurrency.Register(s.concurrencyRunsGauge); err != nil {
+		return fmt.Errorf("error registering concurrency runs metric: %w", err)
+	}
+
+	if err := mgr.Add(s); err != nil {
+		return fmt.Errorf("error adding health scorer to manager: %w", err)
+	}
+	return nil
+}
+
+// SetupWithServer exposes the latest scores through the API.
+func (s *Scorer) SetupWithServer(server *api.Server) {
+	server.Handle("GET /api/v1/health/pools", s.scoresHandler(func() []Score { return s.PoolScores() }))
+	server.Handle("GET /api/v1/health/portgroups", s.scoresHandler(func() []Score { return s.PortgroupScores() }))
+	server.Handle("GET /api/v1/health/concurrency", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := api.WriteJSON(w, http.StatusOK, ConcurrencyResponse{
+			Window: s.Window.String(),
+			Rates:  s.ConcurrencyRates(),
+		}); err != nil {
+			s.log.Error(err, "error encoding response")
+		}
+	}))
+}
+
+// Start recomputes the scores every interval until the context is cancelled.
+func (s *Scorer) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, s.update, s.Interval)
+	return nil
+}
+
+// NeedLeaderElection allows every replica to compute scores for its API.
+func (s *Scorer) NeedLeaderElection() bool {
+	return false
+}
+
+// PoolScores returns the latest pool scores.
+func (s *Scorer) PoolScores() []Score {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Score(nil), s.poolScores...)
+}
+
+// PortgroupScores returns the latest portgroup scores.
+func (s *Scorer) PortgroupScores() []Score {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Score(nil), s.portgroupScores...)
+}
+
+// ConcurrencyRates returns the latest failure rates bucketed by concurrency.
+func (s *Scorer) ConcurrencyRates() []ConcurrencyRate {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]ConcurrencyRate(nil), s.concurrencyRates...)
+}
+
+func (s *Scorer) update(ctx context.Context) {
+	runs := s.testContext.QueryRuns(ledger.Filter{Since: time.Now().Add(-s.Window)})
+
+	poolScores, err := ScoreRuns(runs, ledger.DimensionPool)
+	if err != nil {
+		s.log.Error(err, "error scoring pools")
+		return
+	}
+	portgroupScores, err := ScoreRuns(runs, ledger.DimensionPortgroup)
+	if err != nil {
+		s.log.Error(err, "error scoring portgroups")
+		return
+	}
+
+	concurrencyRates := ConcurrencyRates(runs)
+
+	s.mutex.Lock()
+	s.poolScores = poolScores
+	s.portgroupScores = portgroupScores
+	s.concurrencyRates = concurrencyRates
+	s.mutex.Unlock()
+
+	setScoreGauge(s.poolGauge, poolScores)
+	setScoreGauge(s.portgroupGauge, portgroupScores)
+	s.concurrencyFailureGauge.Reset()
+	s.concurrencyRunsGauge.Reset()
+	for _, rate := range concurrencyRates {
+		s.concurrencyRunsGauge.WithLabelValues(rate.Pool, rate.Portgroup, rate.Phase, rate.Concurrency).Set(float64(rate.Runs))
+		// only failed runs have a concurrency at failure, so only the
+		// concurrency at lease time has a failure rate
+		if rate.Phase == PhaseLease {
+			s.concurrencyFailureGauge.WithLabelValues(rate.Pool, rate.Portgroup, rate.Concurrency).Set(rate.FailureRate)
+		}
+	}
+	s.log.V(1).Info("updated health scores", "runs", len(runs), "pools", len(poolScores), "portgroups", len(portgroupScores))
+}
+
+// setScoreGauge replaces the gauge series with the given scores so that
+// pools which dropped out of the window are no longer exported.
+func setScoreGauge(gauge *prometheus.GaugeVec, scores []Score) {
+	gauge.Reset()
+	for _, score := range scores {
+		gauge.WithLabelValues(score.Name).Set(score.ZScore)
+	}
+}
+
+func (s *Scorer) scoresHandler(scores func() []Score) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := api.WriteJSON(w, http.StatusOK, ScoresResponse{
+			Window: s.Window.String(),
+			Scores: scores(),
+		}); err != nil {
+			s.log.Error(err, "error encoding response")
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package incident
+
+import (
+	"sort"
+	"time"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+)
+
+// DimensionBuildNode groups failures by the build cluster node their failed pods ran on.
+const DimensionBuildNode = "build_node"
+
+// dimensions are the pieces of shared topology failures are correlated by,
+// from the broadest to the narrowest.
+var dimensions = []string{
+	ledger.DimensionVCenter,
+	ledger.DimensionComputeCluster,
+	ledger.DimensionDatastore,
+	ledger.DimensionPool,
+	ledger.DimensionPortgroup,
+	DimensionBuildNode,
+}
+
+// narrowness ranks a dimension by its position in dimensions.
+func narrowness(dimension string) int {
+	for i, d := range dimensions {
+		if d == dimension {
+			return i
+		}
+	}
+	return -1
+}
+
+// failure is a failed run, completed or still in flight.
+type failure struct {
+	namespace string
+	time      time.Time
+	// topology holds the value of each dimension the failure shares with others.
+	topology map[string][]string
+}
+
+func newFailure(run *data.RunRecord, failedAt time.Time) failure {
+	f := failure{
+		namespace: run.Namespace,
+		time:      failedAt,
+		topology:  make(map[string][]string, len(dimensions)),
+	}
+	for _, dimension := range dimensions {
+		if dimension == DimensionBuildNode {
+			for _, failedPod := range run.FailedPods {
+				if len(failedPod.NodeName) > 0 {
+					f.topology[dimension] = append(f.topology[dimension], failedPod.NodeName)
+				}
+			}
+			continue
+		}
+		if value, _ := ledger.DimensionValue(run, dimension); len(value) > 0 {
+			f.topology[dimension] = []string{value}
+		}
+	}
+	return f
+}
+
+// cluster is a set of failures sharing the same value of a dimension.
+type cluster struct {
+	dimension string
+	value     string
+	failures  []failure
+}
+
+// holds returns true if every namespace is one of the failed namespaces of the cluster.
+func (c *cluster) holds(namespaces []string) bool {
+	failed := make(map[string]bool, len(c.failures))
+	for _, f := range c.failures {
+		failed[f.namespace] = true
+	}
+	for _, namespace := range namespaces {
+		if !failed[namespace] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cluster) namespaces() []string {
+	namespaces := make([]string, 0, len(c.failures))
+	for _, f := range c.failures {
+		namespaces = append(namespaces, f.namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// correlate groups the failures by every dimension and returns the groups in
+// which at least threshold distinct namespaces failed within window of each
+// other. A burst on one piece of topology fails the same namespaces on every
+// piece of topology it belongs to, so groups of the same namespaces, or of
+// namespaces nested in another group, are merged into the other group. Of
+// the groups of the same namespaces, the narrowest piece of topology is kept
+// as the cause.
+func correlate(failures []failure, window time.Duration, threshold int) []cluster {
+	groups := make(map[[2]string][]failure)
+	for _, f := range failures {
+		for dimension, values := range f.topology {
+			seen := make(map[string]bool, len(values))
+			for _, value := range values {
+				if seen[value] {
+					continue
+				}
+				seen[value] = true
+				key := [2]string{dimension, value}
+				groups[key] = append(groups[key], f)
+			}
+		}
+	}
+
+	var clusters []cluster
+	for key, group := range groups {
+		if len(group) < threshold {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].time.Before(group[j].time)
+		})
+
+		// slide a window over the failures looking for the densest burst
+		var best []failure
+		start := 0
+		for end := range group {
+			for group[end].time.Sub(group[start].time) > window {
+				start++
+			}
+			if end-start+1 > len(best) {
+				best = group[start : end+1]
+			}
+		}
+		if len(best) >= threshold {
+			clusters = append(clusters, cluster{dimension: key[0], value: key[1], failures: best})
+		}
+	}
+
+	// the largest clusters first, so nested clusters find the cluster they
+	// are merged into, and of the same size the narrowest first
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].failures) != len(clusters[j].failures) {
+			return len(clusters[i].failures) > len(clusters[j].failures)
+		}
+		if clusters[i].dimension != clusters[j].dimension {
+			return narrowness(clusters[i].dimension) > narrowness(clusters[j].dimension)
+		}
+		return clusters[i].value < clusters[j].value
+	})
+	var merged []cluster
+	for _, c := range clusters {
+		nested := false
+		for i := range merged {
+			if merged[i].holds(c.namespaces()) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			merged = append(merged, c)
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].dimension != merged[j].dimension {
+			return merged[i].dimension < merged[j].dimension
+		}
+		return merged[i].value < merged[j].value
+	})
+	return merged
+}
@@ -0,0 +1,341 @@
+package incident
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	incidentsFilename = "incidents.json"
+
+	defaultInterval  = time.Minute
+	defaultWindow    = 30 * time.Minute
+	defaultThreshold = 3
+
+	// incidentRetention is how long resolved incidents are kept.
+	incidentRetention = 30 * 24 * time.Hour
+)
+
+// Incident is a burst of failures sharing the same piece of topology.
+type Incident struct {
+	ID string `json:"id"`
+	// Dimension is the kind of topology the failures share, e.g. pool or datastore.
+	Dimension    string     `json:"dimension"`
+	Value        string     `json:"value"`
+	Namespaces   []string   `json:"namespaces"`
+	FirstFailure time.Time  `json:"first_failure"`
+	LastFailure  time.Time  `json:"last_failure"`
+	Detected     time.Time  `json:"detected"`
+	Resolved     *time.Time `json:"resolved,omitempty"`
+}
+
+// Active returns true until no further failures were correlated for a window.
+func (i *Incident) Active() bool {
+	return i.Resolved == nil
+}
+
+// Correlator groups recent failures by shared topology and raises an incident
+// when enough of them fail within a short window.
+type Correlator struct {
+	// Interval is how often recent failures are correlated.
+	Interval time.Duration
+	// Window is how close together failures must be to be correlated.
+	Window time.Duration
+	// Threshold is the number of distinct failed namespaces which raise an incident.
+	Threshold int
+
+	incidents []*Incident
+	// filename is where the incidents are saved.
+	filename string
+
+	gauge *prometheus.GaugeVec
+
+	testContext *testcontext.TestContextService
+	mutex       sync.Mutex
+
+	log logr.Logger
+}
+
+func (c *Correlator) SetupWithManager(mgr ctrl.Manager,
+	testContext *testcontext.TestContextService) error {
+	c.testContext = testContext
+	c.log = mgr.GetLogger().WithName("incident")
+	if c.Interval <= 0 {
+		c.Interval = defaultInterval
+	}
+	if c.Window <= 0 {
+		c.Window = defaultWindow
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = defaultThreshold
+	}
+
+	c.gauge = monitor.IncidentAffectedNamespaces.NewGaugeVec()
+	if err := monitor.IncidentAffectedNamespaces.Register(c.gauge); err != nil {
+		return fmt.Errorf("error registering incident metric: %w", err)
+	}
+
+	c.filename = path.Join(testContext.Directory, incidentsFilename)
+	if err := c.Restore(c.filename); err != nil {
+		c.log.Error(err, "error restoring incidents")
+	}
+
+	if err := mgr.Add(c); err != nil {
+		return fmt.Errorf("error adding incident correlator to manager: %w", err)
+	}
+	return nil
+}
+
+// SetupWithServer lists incidents through the API.
+func (c *Correlator) SetupWithServer(server *api.Server) {
+	server.Handle("GET /api/v1/incidents", http.HandlerFunc(c.listIncidents))
+}
+
+// Start correlates recent failures every interval until the context is cancelled.
+func (c *Correlator) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, c.update, c.Interval)
+	return nil
+}
+
+// Incidents returns a copy of all incidents, most recently detected first.
+func (c *Correlator) Incidents() []Incident {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	incidents := make([]Incident, 0, len(c.incidents))
+	for _, incident := range c.incidents {
+		out := *incident
+		out.Namespaces = append([]string(nil), incident.Namespaces...)
+		incidents = append(incidents, out)
+	}
+	sort.Slice(incidents, func(i, j int) bool {
+		return incidents[i].Detected.After(incidents[j].Detected)
+	})
+	return incidents
+}
+
+func (c *Correlator) update(ctx context.Context) {
+	now := time.Now()
+	clusters := correlate(c.recentFailures(now), c.Window, c.Threshold)
+
+	c.mutex.Lock()
+	changed := false
+	for _, cluster := range clusters {
+		if c.merge(cluster, now) {
+			changed = true
+		}
+	}
+	for _, incident := range c.incidents {
+		if incident.Active() && now.Sub(incident.LastFailure) > c.Window {
+			resolved := now
+			incident.Resolved = &resolved
+			changed = true
+			c.log.Info("failure incident resolved", "id", incident.ID, "namespaces", len(incident.Namespaces))
+		}
+	}
+	c.expire(now)
+
+	c.gauge.Reset()
+	for _, incident := range c.incidents {
+		if incident.Active() {
+			c.gauge.WithLabelValues(incident.Dimension, incident.Value).Set(float64(len(incident.Namespaces)))
+		}
+	}
+	c.mutex.Unlock()
+
+	if changed {
+		if err := c.Save(c.filename); err != nil {
+			c.log.Error(err, "error saving incidents")
+		}
+	}
+}
+
+// recentFailures returns the failures of completed and in-flight runs within the window.
+func (c *Correlator) recentFailures(now time.Time) []failure {
+	since := now.Add(-c.Window)
+	seen := make(map[string]bool)
+	var failures []failure
+
+	for _, run := range c.testContext.QueryRuns(ledger.Filter{Result: "failed", Since: since}) {
+		if failedAt := run.FirstFailure(); !failedAt.Before(since) {
+			seen[run.Namespace] = true
+			failures = append(failures, newFailure(&run, failedAt))
+		}
+	}
+	for _, testContext := range c.testContext.GetTestContextSnapshot() {
+		if !testContext.Failed || seen[testContext.Namespace.Name] {
+			continue
+		}
+		if failedAt := testContext.FirstFailure(); !failedAt.Before(since) {
+			run := data.NewRunRecord(testContext, time.Time{})
+			failures = append(failures, newFailure(&run, failedAt))
+		}
+	}
+	return failures
+}
+
+// merge folds a cluster of failures into the active incident for its
+// topology, or for the same or nested namespaces, or raises a new incident.
+// It returns true if the incidents changed.
+func (c *Correlator) merge(cluster cluster, now time.Time) bool {
+	var incident *Incident
+	for _, existing := range c.incidents {
+		if existing.Active() && existing.Dimension == cluster.dimension && existing.Value == cluster.value {
+			incident = existing
+			break
+		}
+	}
+	changed := false
+	if incident == nil {
+		namespaces := cluster.namespaces()
+		for _, existing := range c.incidents {
+			if !existing.Active() {
+				continue
+			}
+			if cluster.holds(existing.Namespaces) {
+				// further failures only share a broader piece of topology
+				if len(namespaces) > len(existing.Namespaces) {
+					c.log.Info("failure incident widened", "id", existing.ID, "dimension", cluster.dimension, "value", cluster.value)
+					existing.Dimension, existing.Value = cluster.dimension, cluster.value
+					changed = true
+				}
+				incident = existing
+				break
+			}
+			if holds(existing.Namespaces, namespaces) {
+				incident = existing
+				break
+			}
+		}
+	}
+	if incident == nil {
+		incident = &Incident{
+			ID:           fmt.Sprintf("%s/%s/%d", cluster.dimension, cluster.value, cluster.failures[0].time.Unix()),
+			Dimension:    cluster.dimension,
+			Value:        cluster.value,
+			FirstFailure: cluster.failures[0].time,
+			Detected:     now,
+		}
+		c.incidents = append(c.incidents, incident)
+		c.log.Info("failure incident detected", "id", incident.ID, "namespaces", len(cluster.failures))
+	}
+
+	for _, f := range cluster.failures {
+		if f.time.After(incident.LastFailure) {
+			incident.LastFailure = f.time
+			changed = true
+		}
+		idx := sort.SearchStrings(incident.Namespaces, f.namespace)
+		if idx < len(incident.Namespaces) && incident.Namespaces[idx] == f.namespace {
+			continue
+		}
+		incident.Namespaces = append(incident.Namespaces, "")
+		copy(incident.Namespaces[idx+1:], incident.Namespaces[idx:])
+		incident.Namespaces[idx] = f.namespace
+		changed = true
+	}
+	return changed
+}
+
+// holds returns true if the sorted namespaces hold every one of the others.
+func holds(namespaces, others []string) bool {
+	for _, other := range others {
+		idx := sort.SearchStrings(namespaces, other)
+		if idx == len(namespaces) || namespaces[idx] != other {
+			return false
+		}
+	}
+	return true
+}
+
+// expire drops resolved incidents older than the retention.
+func (c *Correlator) expire(now time.Time) {
+	incidents := c.incidents[:0]
+	for _, incident := range c.incidents {
+		if incident.Active() || now.Sub(*incident.Resolved) <= incidentRetention {
+			incidents = append(incidents, incident)
+		}
+	}
+	c.incidents = incidents
+}
+
+// Save saves the incidents to a file
+func (c *Correlator) Save(filename string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(c.incidents); err != nil {
+		return fmt.Errorf("failed to encode incidents: %w", err)
+	}
+	return nil
+}
+
+// Restore restores the incidents from a file
+func (c *Correlator) Restore(filename string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&c.incidents); err != nil {
+		return fmt.Errorf("failed to decode incidents: %w", err)
+	}
+
+	c.log.Info("Successfully restored incidents", "filename", filename, "count", len(c.incidents))
+	return nil
+}
+
+func (c *Correlator) listIncidents(w http.ResponseWriter, r *http.Request) {
+	active := r.URL.Query().Get("active")
+	if len(active) > 0 && active != "true" && active != "false" {
+		if err := api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid active %q, must be true or false", active)); err != nil {
+			c.log.Error(err, "error encoding response")
+		}
+		return
+	}
+
+	incidents := []Incident{}
+	for _, incident := range c.Incidents() {
+		if len(active) > 0 && (active == "true") != incident.Active() {
+			continue
+		}
+		incidents = append(incidents, incident)
+	}
+
+	if err := api.WriteJSON(w, http.StatusOK, incidents); err != nil {
+		c.log.Error(err, "error encoding response")
+	}
+}
@@ -0,0 +1,81 @@
+package junit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+)
+
+// Bucket is a store of job artifacts addressed by GCS-style object names,
+// e.g. logs/<job>/<build id>/artifacts/junit_e2e.xml.
+type Bucket interface {
+	// List returns the names of all objects beginning with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Open opens an object for reading.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// ArtifactPrefix returns the prefix of the artifacts of a job run. Presubmits
+// are kept under pr-logs and all other jobs under logs.
+func ArtifactPrefix(job data.Job) string {
+	if job.Pull > 0 && len(job.Org) > 0 && len(job.Repo) > 0 {
+		return path.Join("pr-logs", "pull", job.Org+"_"+job.Repo, strconv.Itoa(job.Pull), job.Name, job.BuildID) + "/"
+	}
+	return path.Join("logs", job.Name, job.BuildID) + "/"
+}
+
+// DirectoryBucket is a bucket mirrored to a local directory, with object
+// names as paths relative to Root.
+type DirectoryBucket struct {
+	Root string
+}
+
+func (b *DirectoryBucket) List(ctx context.Context, prefix string) ([]string, error) {
+	// walk the deepest directory of the prefix rather than the whole bucket
+	dir := path.Dir(prefix + "x")
+	root := filepath.Join(b.Root, filepath.FromSlash(dir))
+
+	var names []string
+	err := filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		relative, err := filepath.Rel(b.Root, file)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(relative); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list %s: %w", root, err)
+	}
+	return names, nil
+}
+
+func (b *DirectoryBucket) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if !fs.ValidPath(name) {
+		return nil, fmt.Errorf("invalid object name %q", name)
+	}
+	file, err := os.Open(filepath.Join(b.Root, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object %s: %w", name, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,430 @@
+package junit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/openshift-splat-team/test-monitor/pkg/observer"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	pendingFilename = "junit_pending.json"
+
+	defaultInterval = 5 * time.Minute
+	defaultTimeout  = 6 * time.Hour
+)
+
+// Outcomes of ingesting the JUnit results of a run.
+const (
+	outcomeIngested = "ingested"
+	outcomeMissing  = "missing"
+	outcomeFailed   = "failed"
+)
+
+// pendingRun is a completed run whose JUnit results were not ingested yet.
+type pendingRun struct {
+	Namespace string    `json:"namespace"`
+	Completed time.Time `json:"completed"`
+	Job       data.Job  `json:"job"`
+	Pool      string    `json:"pool,omitempty"`
+	Portgroup string    `json:"portgroup,omitempty"`
+}
+
+func (p *pendingRun) key() string {
+	return p.Namespace + "/" + p.Completed.String()
+}
+
+// Ingester reads the JUnit results of completed runs from their artifacts
+// and records the test case outcomes on the runs in the run ledger. Artifacts
+// are usually uploaded shortly after a run completes, so runs are retried
+// every interval until their results are found or the timeout expires.
+type Ingester struct {
+	observer.NopObserver
+
+	Bucket Bucket
+	// Interval is how often the artifacts of pending runs are looked for.
+	Interval time.Duration
+	// Timeout is how long after its completion the artifacts of a run are looked for.
+	Timeout time.Duration
+	// AllowList selects the test cases which are counted per pool and
+	// portgroup. No test cases are counted if empty.
+	AllowList []*regexp.Regexp
+	// RecordPassed also lists passed and skipped test cases on the run records.
+	RecordPassed bool
+
+	pending []pendingRun
+	// filename is where the pending runs are saved.
+	filename string
+
+	ingestionCounter *prometheus.CounterVec
+	testCaseCounter  *prometheus.CounterVec
+
+	testContext *testcontext.TestContextService
+	mutex       sync.Mutex
+
+	log logr.Logger
+}
+
+func (i *Ingester) SetupWithManager(mgr ctrl.Manager,
+	testContext *testcontext.TestContextService) error {
+	i.testContext = testContext
+	i.log = mgr.GetLogger().WithName("junit")
+	if i.Interval <= 0 {
+		i.Interval = defaultInterval
+	}
+	if i.Timeout <= 0 {
+		i.Timeout = defaultTimeout
+	}
+
+	i.ingestionCounter = monitor.JUnitIngestions.NewCounterVec()
+	i.testCaseCounter = monitor.JUnitTestCaseResults.NewCounterVec()
+	if err := monitor.JUnitIngestions.Register(i.ingestionCounter); err != nil {
+		return fmt.Errorf("error registering junit ingestion metric: %w", err)
+	}
+	if err := monitor.JUnitTestCaseResults.Register(i.testCaseCounter); err != nil {
+		return fmt.Errorf("error registering junit test case metric: %w", err)
+	}
+
+	i.filename = path.Join(testContext.Directory, pendingFilename)
+	if err := i.Restore(i.filename); err != nil {
+		i.log.Error(err, "error restoring pending junit ingestions")
+	}
+
+	if err := mgr.Add(i); err != nil {
+		return fmt.Errorf("error adding junit ingester to manager: %w", err)
+	}
+	return nil
+}
+
+// SetupWithServer serves the test case failures through the API.
+func (i *Ingester) SetupWithServer(server *api.Server) {
+	server.Handle("GET /api/v1/testcases", http.HandlerFunc(i.listTestCases))
+}
+
+// OnRunCompleted queues a completed run for ingestion if it identifies its prow job.
+func (i *Ingester) OnRunCompleted(testContext *data.TestContext, run data.RunRecord) {
+	if len(run.Name) == 0 || len(run.BuildID) == 0 {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.pending = append(i.pending, pendingRun{
+		Namespace: run.Namespace,
+		Completed: run.Completed,
+		Job:       run.Job,
+		Pool:      run.Pool,
+		Portgroup: run.Portgroup,
+	})
+}
+
+// Start ingests the results of pending runs every interval until the context is cancelled.
+func (i *Ingester) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, i.ingest, i.Interval)
+	return nil
+}
+
+// ingestion is the JUnit results read for a pending run.
+type ingestion struct {
+	run     pendingRun
+	results *data.TestCaseResults
+	cases   []data.TestCase
+}
+
+func (i *Ingester) ingest(ctx context.Context) {
+	i.mutex.Lock()
+	pending := append([]pendingRun(nil), i.pending...)
+	i.mutex.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	now := time.Now()
+	done := make(map[string]bool)
+	finish := func(run *pendingRun, outcome string) {
+		i.ingestionCounter.WithLabelValues(outcome).Inc()
+		done[run.key()] = true
+	}
+
+	var ingestions []ingestion
+	for _, run := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		results, cases, err := i.read(ctx, &run)
+		if err != nil {
+			i.log.Error(err, "error ingesting junit results", "namespace", run.Namespace)
+		}
+		if results != nil {
+			ingestions = append(ingestions, ingestion{run: run, results: results, cases: cases})
+		} else if now.Sub(run.Completed) > i.Timeout {
+			finish(&run, outcomeMissing)
+		}
+	}
+
+	if len(ingestions) > 0 {
+		i.record(ingestions, now, finish)
+	}
+
+	i.mutex.Lock()
+	var remaining []pendingRun
+	for _, run := range i.pending {
+		if !done[run.key()] {
+			remaining = append(remaining, run)
+		}
+	}
+	i.pending = remaining
+	i.mutex.Unlock()
+
+	if err := i.Save(i.filename); err != nil {
+		i.log.Error(err, "error saving pending junit ingestions")
+	}
+}
+
+// record records the test cases of the runs of one interval in the run
+// ledger at once. A run not in the run ledger yet is retried until the
+// timeout.
+func (i *Ingester) record(ingestions []ingestion, now time.Time, finish func(run *pendingRun, outcome string)) {
+	updates := make([]ledger.RunUpdate, len(ingestions))
+	for n := range ingestions {
+		results := ingestions[n].results
+		updates[n] = ledger.RunUpdate{
+			Namespace: ingestions[n].run.Namespace,
+			Completed: ingestions[n].run.Completed,
+			Update: func(record *data.RunRecord) {
+				record.TestCases = results
+			},
+		}
+	}
+	applied, err := i.testContext.UpdateRuns(updates)
+	if err != nil {
+		i.log.Error(err, "error recording test cases")
+	}
+
+	for n := range ingestions {
+		run, results := &ingestions[n].run, ingestions[n].results
+		if !applied[n] {
+			if now.Sub(run.Completed) > i.Timeout {
+				i.log.Error(fmt.Errorf("run completed at %s is not in the run ledger", run.Completed),
+					"error recording test cases", "namespace", run.Namespace)
+				finish(run, outcomeFailed)
+			}
+			continue
+		}
+		i.count(run, ingestions[n].cases)
+		i.log.V(1).Info("ingested junit results", "namespace", run.Namespace, "prefix", ArtifactPrefix(run.Job),
+			"passed", results.Passed, "failed", results.Failed, "flaked", results.Flaked)
+		finish(run, outcomeIngested)
+	}
+}
+
+// read reads the results of a run. It returns nil results if no results
+// were uploaded yet.
+func (i *Ingester) read(ctx context.Context, run *pendingRun) (*data.TestCaseResults, []data.TestCase, error) {
+	prefix := ArtifactPrefix(run.Job)
+	names, err := i.Bucket.List(ctx, prefix)
+	if err != nil {
+		// the bucket may be unavailable, try again until the timeout
+		return nil, nil, err
+	}
+
+	var cases []data.TestCase
+	found := false
+	for _, name := range names {
+		if !IsResultFile(name) {
+			continue
+		}
+		found = true
+		fileCases, err := i.parse(ctx, name)
+		if err != nil {
+			i.log.Error(err, "skipping junit results", "namespace", run.Namespace, "object", name)
+			continue
+		}
+		cases = append(cases, fileCases...)
+	}
+	if !found {
+		return nil, nil, nil
+	}
+
+	cases = Merge(cases)
+	return Summarize(cases, i.RecordPassed), cases, nil
+}
+
+func (i *Ingester) parse(ctx context.Context, name string) ([]data.TestCase, error) {
+	reader, err := i.Bucket.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return Parse(reader)
+}
+
+// count increments the counters of the allow-listed test cases.
+func (i *Ingester) count(run *pendingRun, cases []data.TestCase) {
+	if len(i.AllowList) == 0 {
+		return
+	}
+	for _, testCase := range cases {
+		for _, allowed := range i.AllowList {
+			if allowed.MatchString(testCase.Name) {
+				i.testCaseCounter.WithLabelValues(testCase.Name, run.Pool, run.Portgroup, testCase.Result).Inc()
+				break
+			}
+		}
+	}
+}
+
+// LoadAllowList reads one regular expression per line. Empty lines and lines
+// starting with # are ignored. Expressions match whole test case names.
+func LoadAllowList(filename string) ([]*regexp.Regexp, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	var allowList []*regexp.Regexp
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		expression := strings.TrimSpace(scanner.Text())
+		if len(expression) == 0 || strings.HasPrefix(expression, "#") {
+			continue
+		}
+		allowed, err := regexp.Compile("^(?:" + expression + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression on line %d of %s: %w", line, filename, err)
+		}
+		allowList = append(allowList, allowed)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+	}
+	return allowList, nil
+}
+
+// Save saves the pending runs to a file
+func (i *Ingester) Save(filename string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(i.pending); err != nil {
+		return fmt.Errorf("failed to encode pending runs: %w", err)
+	}
+	return nil
+}
+
+// Restore restores the pending runs from a file
+func (i *Ingester) Restore(filename string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&i.pending); err != nil {
+		return fmt.Errorf("failed to decode pending runs: %w", err)
+	}
+
+	i.log.Info("Successfully restored pending junit ingestions", "filename", filename, "count", len(i.pending))
+	return nil
+}
+
+// TestCaseStats counts how often a test case failed in the ingested runs
+// selected by a filter.
+type TestCaseStats struct {
+	Name  string `json:"name"`
+	Suite string `json:"suite,omitempty"`
+	// Runs is the number of selected runs whose results were ingested.
+	Runs        int     `json:"runs"`
+	Failed      int     `json:"failed"`
+	Flaked      int     `json:"flaked"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
+// listTestCases serves the test cases which failed or flaked in the runs
+// selected by the same filters as the runs API, most failures first.
+func (i *Ingester) listTestCases(w http.ResponseWriter, r *http.Request) {
+	filter, err := api.ParseFilter(r.URL.Query())
+	if err != nil {
+		if err := api.WriteError(w, http.StatusBadRequest, err); err != nil {
+			i.log.Error(err, "error encoding response")
+		}
+		return
+	}
+
+	runs := 0
+	stats := make(map[string]*TestCaseStats)
+	for _, run := range i.testContext.QueryRuns(filter) {
+		if run.TestCases == nil {
+			continue
+		}
+		runs++
+		for _, testCase := range run.TestCases.Cases {
+			if testCase.Result != data.TestCaseFailed && testCase.Result != data.TestCaseFlaked {
+				continue
+			}
+			key := testCase.Suite + "/" + testCase.Name
+			stat, exists := stats[key]
+			if !exists {
+				stat = &TestCaseStats{Name: testCase.Name, Suite: testCase.Suite}
+				stats[key] = stat
+			}
+			if testCase.Result == data.TestCaseFailed {
+				stat.Failed++
+			} else {
+				stat.Flaked++
+			}
+		}
+	}
+
+	out := make([]TestCaseStats, 0, len(stats))
+	for _, stat := range stats {
+		stat.Runs = runs
+		stat.FailureRate = float64(stat.Failed) / float64(runs)
+		out = append(out, *stat)
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Failed != out[b].Failed {
+			return out[a].Failed > out[b].Failed
+		}
+		return out[a].Name < out[b].Name
+	})
+
+	if err := api.WriteJSON(w, http.StatusOK, out); err != nil {
+		i.log.Error(err, "error encoding response")
+	}
+}
@@ -0,0 +1,154 @@
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+)
+
+// maxMessageLength bounds the failure message kept for a test case.
+const maxMessageLength = 512
+
+// suite is a <testsuite> element, or the <testsuites> element wrapping them.
+type suite struct {
+	Name   string     `xml:"name,attr"`
+	Suites []suite    `xml:"testsuite"`
+	Cases  []testCase `xml:"testcase"`
+}
+
+type testCase struct {
+	Name      string   `xml:"name,attr"`
+	Classname string   `xml:"classname,attr"`
+	Time      float64  `xml:"time,attr"`
+	Failure   *message `xml:"failure"`
+	Error     *message `xml:"error"`
+	Skipped   *message `xml:"skipped"`
+}
+
+type message struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (m *message) String() string {
+	text := m.Message
+	if len(text) == 0 {
+		text = strings.TrimSpace(m.Text)
+	}
+	if len(text) > maxMessageLength {
+		text = text[:maxMessageLength]
+	}
+	return text
+}
+
+// IsResultFile returns true if an artifact holds JUnit results. ci-operator
+// steps write them as junit*.xml.
+func IsResultFile(name string) bool {
+	base := path.Base(name)
+	return strings.HasPrefix(base, "junit") && strings.HasSuffix(base, ".xml")
+}
+
+// Parse reads the test cases of a JUnit XML document, whose root is either a
+// <testsuites> or a <testsuite> element.
+func Parse(r io.Reader) ([]data.TestCase, error) {
+	var root suite
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to decode junit: %w", err)
+	}
+	var cases []data.TestCase
+	collect(&root, &cases)
+	return cases, nil
+}
+
+func collect(s *suite, cases *[]data.TestCase) {
+	for _, c := range s.Cases {
+		testCase := data.TestCase{
+			Name:     c.Name,
+			Suite:    s.Name,
+			Result:   data.TestCasePassed,
+			Duration: c.Time,
+		}
+		if len(testCase.Suite) == 0 {
+			testCase.Suite = c.Classname
+		}
+		switch {
+		case c.Failure != nil:
+			testCase.Result, testCase.Message = data.TestCaseFailed, c.Failure.String()
+		case c.Error != nil:
+			testCase.Result, testCase.Message = data.TestCaseFailed, c.Error.String()
+		case c.Skipped != nil:
+			testCase.Result = data.TestCaseSkipped
+		}
+		*cases = append(*cases, testCase)
+	}
+	for i := range s.Suites {
+		collect(&s.Suites[i], cases)
+	}
+}
+
+// Merge combines the test cases of all result files of a run. A test case
+// reported as both failed and passed, e.g. because it was retried, flaked.
+func Merge(cases []data.TestCase) []data.TestCase {
+	merged := make(map[string]*data.TestCase)
+	var keys []string
+	for _, testCase := range cases {
+		key := testCase.Suite + "/" + testCase.Name
+		known, exists := merged[key]
+		if !exists {
+			testCase := testCase
+			merged[key] = &testCase
+			keys = append(keys, key)
+			continue
+		}
+		switch {
+		case known.Result == testCase.Result || testCase.Result == data.TestCaseSkipped:
+		case known.Result == data.TestCaseSkipped:
+			*known = testCase
+		case known.Result == data.TestCaseFlaked:
+		default:
+			// one passed and one failed
+			if testCase.Result == data.TestCaseFailed {
+				known.Message = testCase.Message
+			}
+			known.Result = data.TestCaseFlaked
+		}
+	}
+	sort.Strings(keys)
+
+	out := make([]data.TestCase, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, *merged[key])
+	}
+	return out
+}
+
+// Summarize counts the merged test cases of a run by result. Passed and
+// skipped test cases are only listed if recordPassed is true.
+func Summarize(cases []data.TestCase, recordPassed bool) *data.TestCaseResults {
+	results := &data.TestCaseResults{}
+	for _, testCase := range cases {
+		switch testCase.Result {
+		case data.TestCasePassed:
+			results.Passed++
+			if !recordPassed {
+				continue
+			}
+		case data.TestCaseFailed:
+			results.Failed++
+		case data.TestCaseFlaked:
+			results.Flaked++
+		case data.TestCaseSkipped:
+			results.Skipped++
+			if !recordPassed {
+				continue
+			}
+		}
+		results.Cases = append(results.Cases, testCase)
+	}
+	return results
+}
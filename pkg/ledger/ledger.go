@@ -0,0 +1,379 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+)
+
+// Ledger keeps the history of completed test runs. Runs are appended to a
+// JSON lines file so the history survives restarts of the monitor.
+type Ledger struct {
+	// runs are ordered by completion.
+	runs []data.RunRecord
+	// revision is the revision of the most recent change.
+	revision uint64
+	// jobs indexes the runs by the ProwJobKeys of their job.
+	jobs      map[string]runKey
+	filename  string
+	retention time.Duration
+	mutex     *sync.Mutex
+	log       logr.Logger
+}
+
+// runKey identifies a run by its namespace and completion.
+type runKey struct {
+	namespace string
+	completed int64
+}
+
+func keyOf(run *data.RunRecord) runKey {
+	return runKey{run.Namespace, run.Completed.UnixNano()}
+}
+
+// Filter selects runs from the ledger. Empty fields match any run.
+type Filter struct {
+	TestName    string
+	Variant     string
+	JobType     string
+	Pool        string
+	NetworkType string
+	Portgroup   string
+	// Result is either "passed" or "failed".
+	Result string
+	Since  time.Time
+	Until  time.Time
+}
+
+// Matches returns true if the run is selected by the filter.
+func (f *Filter) Matches(run *data.RunRecord) bool {
+	switch {
+	case len(f.TestName) > 0 && f.TestName != run.TestName:
+		return false
+	case len(f.Variant) > 0 && f.Variant != run.Variant:
+		return false
+	case len(f.JobType) > 0 && f.JobType != run.JobType:
+		return false
+	case len(f.Pool) > 0 && f.Pool != run.Pool:
+		return false
+	case len(f.NetworkType) > 0 && f.NetworkType != run.NetworkType:
+		return false
+	case len(f.Portgroup) > 0 && f.Portgroup != run.Portgroup:
+		return false
+	case len(f.Result) > 0 && f.Result != run.Result():
+		return false
+	case !f.Since.IsZero() && run.Completed.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && run.Completed.After(f.Until):
+		return false
+	}
+	return true
+}
+
+// Initialize loads the runs persisted in filename. Runs older than retention
+// are dropped and the file is compacted. An empty filename keeps the ledger
+// in memory only.
+func (l *Ledger) Initialize(log logr.Logger, filename string, retention time.Duration) error {
+	l.log = log
+	l.filename = filename
+	l.retention = retention
+	l.mutex = &sync.Mutex{}
+	l.jobs = make(map[string]runKey)
+
+	if len(filename) == 0 {
+		return nil
+	}
+
+	runs, err := Load(filename)
+	if err != nil {
+		return err
+	}
+	l.runs = runs
+	l.expire(time.Now())
+	for i := range l.runs {
+		l.indexJob(&l.runs[i])
+	}
+	for _, run := range l.runs {
+		l.revision = max(l.revision, run.Revision)
+	}
+	// runs recorded before the ledger kept revisions
+	for i := range l.runs {
+		if l.runs[i].Revision == 0 {
+			l.revision++
+			l.runs[i].Sequence, l.runs[i].Revision = l.revision, l.revision
+		}
+	}
+
+	if err := l.compact(); err != nil {
+		return err
+	}
+	l.log.Info("Successfully restored run ledger", "filename", filename, "count", len(l.runs))
+	return nil
+}
+
+// Load reads all runs from a ledger file without keeping it open.
+func Load(filename string) ([]data.RunRecord, error) {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	var runs []data.RunRecord
+	scanner := bufio.NewScanner(file)
+	// runs with ingested test cases may be large
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var run data.RunRecord
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, fmt.Errorf("failed to decode run on line %d of %s: %w", line, filename, err)
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Completed.Before(runs[j].Completed)
+	})
+	return runs, nil
+}
+
+// Record adds a completed run to the ledger in order of completion. Runs
+// may be recorded after runs which completed later, so the run is inserted
+// rather than appended; the file is sorted again when it is loaded.
+func (l *Ledger) Record(run data.RunRecord) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.revision++
+	run.Sequence, run.Revision = l.revision, l.revision
+	i := sort.Search(len(l.runs), func(i int) bool {
+		return l.runs[i].Completed.After(run.Completed)
+	})
+	l.runs = append(l.runs, data.RunRecord{})
+	copy(l.runs[i+1:], l.runs[i:])
+	l.runs[i] = run
+	l.indexJob(&run)
+	l.expire(time.Now())
+
+	if len(l.filename) == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(l.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", l.filename, err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(run); err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	return nil
+}
+
+// Update applies update to the run of a namespace which completed at the
+// given time and rewrites the ledger file. It returns false if the run is
+// not in the ledger.
+func (l *Ledger) Update(namespace string, completed time.Time, update func(run *data.RunRecord)) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	i, found := l.find(runKey{namespace, completed.UnixNano()})
+	if !found {
+		return false, nil
+	}
+	return true, l.update(&l.runs[i], update)
+}
+
+// UpdateJob looks up the run of a prow job by the keys of the prow job. If
+// match selects it, the run is moved to the next revision, update is applied
+// to it and the ledger file is rewritten. It returns false if no run matched.
+func (l *Ledger) UpdateJob(keys []string, match func(run *data.RunRecord) bool, update func(run *data.RunRecord)) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, key := range keys {
+		indexed, exists := l.jobs[key]
+		if !exists {
+			continue
+		}
+		i, found := l.find(indexed)
+		if !found || !match(&l.runs[i]) {
+			continue
+		}
+		return true, l.update(&l.runs[i], update)
+	}
+	return false, nil
+}
+
+// update moves a run to the next revision, applies update to it and rewrites the ledger file.
+func (l *Ledger) update(run *data.RunRecord, update func(run *data.RunRecord)) error {
+	l.revision++
+	run.Revision = l.revision
+	update(run)
+	if len(l.filename) == 0 {
+		return nil
+	}
+	return l.compact()
+}
+
+// RunUpdate updates the run of a namespace which completed at the given time.
+type RunUpdate struct {
+	Namespace string
+	Completed time.Time
+	Update    func(run *data.RunRecord)
+}
+
+// UpdateAll applies each update to its run, moves the updated runs to the
+// next revisions and rewrites the ledger file once. It returns whether each
+// update found its run in the ledger.
+func (l *Ledger) UpdateAll(updates []RunUpdate) ([]bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	indices := make(map[runKey]int, len(updates))
+	for i, update := range updates {
+		indices[runKey{update.Namespace, update.Completed.UnixNano()}] = i
+	}
+
+	applied := make([]bool, len(updates))
+	changed := false
+	for i := range l.runs {
+		run := &l.runs[i]
+		index, exists := indices[keyOf(run)]
+		if !exists || applied[index] {
+			continue
+		}
+		l.revision++
+		run.Revision = l.revision
+		updates[index].Update(run)
+		applied[index] = true
+		changed = true
+	}
+	if !changed || len(l.filename) == 0 {
+		return applied, nil
+	}
+	return applied, l.compact()
+}
+
+// Query returns the runs selected by the filter, most recently completed first.
+func (l *Ledger) Query(filter Filter) []data.RunRecord {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var runs []data.RunRecord
+	for i := len(l.runs) - 1; i >= 0; i-- {
+		if filter.Matches(&l.runs[i]) {
+			runs = append(runs, l.runs[i])
+		}
+	}
+	return runs
+}
+
+// Changes returns the runs recorded or updated after the given revision in
+// the order of their revision, and the revision of the most recent change.
+// Consumers pass the returned revision on the next call to follow the ledger.
+func (l *Ledger) Changes(after uint64) ([]data.RunRecord, uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var runs []data.RunRecord
+	for i := range l.runs {
+		if l.runs[i].Revision > after {
+			runs = append(runs, l.runs[i])
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Revision < runs[j].Revision
+	})
+	return runs, l.revision
+}
+
+// find returns the index of a run in the runs, which are ordered by completion.
+func (l *Ledger) find(key runKey) (int, bool) {
+	i := sort.Search(len(l.runs), func(i int) bool {
+		return l.runs[i].Completed.UnixNano() >= key.completed
+	})
+	for ; i < len(l.runs) && l.runs[i].Completed.UnixNano() == key.completed; i++ {
+		if l.runs[i].Namespace == key.namespace {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// indexJob indexes a run by the keys of its prow job, unless a run which
+// completed later has the same keys.
+func (l *Ledger) indexJob(run *data.RunRecord) {
+	key := keyOf(run)
+	for _, jobKey := range run.ProwJobKeys() {
+		if indexed, exists := l.jobs[jobKey]; !exists || indexed.completed <= key.completed {
+			l.jobs[jobKey] = key
+		}
+	}
+}
+
+// expire drops runs which completed before the retention period.
+func (l *Ledger) expire(now time.Time) {
+	if l.retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-l.retention)
+	idx := sort.Search(len(l.runs), func(i int) bool {
+		return !l.runs[i].Completed.Before(cutoff)
+	})
+	if idx == 0 {
+		return
+	}
+	for i := range l.runs[:idx] {
+		key := keyOf(&l.runs[i])
+		for _, jobKey := range l.runs[i].ProwJobKeys() {
+			if l.jobs[jobKey] == key {
+				delete(l.jobs, jobKey)
+			}
+		}
+	}
+	l.runs = append([]data.RunRecord(nil), l.runs[idx:]...)
+}
+
+// compact rewrites the ledger file with the runs held in memory.
+func (l *Ledger) compact() error {
+	tmpFilename := l.filename + ".tmp"
+	file, err := os.Create(tmpFilename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", tmpFilename, err)
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, run := range l.runs {
+		if err := encoder.Encode(run); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to encode run: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close file %s: %w", tmpFilename, err)
+	}
+
+	if err := os.Rename(tmpFilename, l.filename); err != nil {
+		return fmt.Errorf("failed to replace file %s: %w", l.filename, err)
+	}
+	return nil
+}
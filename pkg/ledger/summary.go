@@ -0,0 +1,105 @@
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+)
+
+// Dimensions by which runs can be grouped when summarizing.
+const (
+	DimensionTestName    = "test_name"
+	DimensionVariant     = "variant"
+	DimensionJobType     = "job_type"
+	DimensionPool        = "pool"
+	DimensionNetworkType = "network_type"
+	DimensionPortgroup   = "portgroup"
+
+	DimensionVCenter        = "vcenter"
+	DimensionComputeCluster = "compute_cluster"
+	DimensionDatastore      = "datastore"
+)
+
+// Summary holds the pass/fail totals of the runs sharing the same dimension values.
+type Summary struct {
+	Labels   map[string]string `json:"labels"`
+	Passes   int               `json:"passes"`
+	Fails    int               `json:"fails"`
+	PassRate float64           `json:"pass_rate"`
+}
+
+// Total returns the number of runs in the summary.
+func (s *Summary) Total() int {
+	return s.Passes + s.Fails
+}
+
+// DimensionValue returns the value of a dimension for a run.
+func DimensionValue(run *data.RunRecord, dimension string) (string, error) {
+	switch dimension {
+	case DimensionTestName:
+		return run.TestName, nil
+	case DimensionVariant:
+		return run.Variant, nil
+	case DimensionJobType:
+		return run.JobType, nil
+	case DimensionPool:
+		return run.Pool, nil
+	case DimensionNetworkType:
+		return run.NetworkType, nil
+	case DimensionPortgroup:
+		return run.Portgroup, nil
+	case DimensionVCenter:
+		return run.Topology.VCenter, nil
+	case DimensionComputeCluster:
+		return run.Topology.ComputeCluster, nil
+	case DimensionDatastore:
+		return run.Topology.Datastore, nil
+	}
+	return "", fmt.Errorf("unknown dimension %q", dimension)
+}
+
+// Summarize groups the runs by the given dimensions and totals the passes and
+// fails of each group. Summaries are sorted by their dimension values.
+func Summarize(runs []data.RunRecord, dimensions ...string) ([]Summary, error) {
+	groups := make(map[string]*Summary)
+	var keys []string
+
+	for i := range runs {
+		run := &runs[i]
+		values := make([]string, len(dimensions))
+		for j, dimension := range dimensions {
+			value, err := DimensionValue(run, dimension)
+			if err != nil {
+				return nil, err
+			}
+			values[j] = value
+		}
+
+		key := strings.Join(values, "\x00")
+		summary, exists := groups[key]
+		if !exists {
+			summary = &Summary{Labels: make(map[string]string, len(dimensions))}
+			for j, dimension := range dimensions {
+				summary.Labels[dimension] = values[j]
+			}
+			groups[key] = summary
+			keys = append(keys, key)
+		}
+		if run.Failed {
+			summary.Fails++
+		} else {
+			summary.Passes++
+		}
+	}
+
+	sort.Strings(keys)
+	summaries := make([]Summary, 0, len(keys))
+	for _, key := range keys {
+		summary := groups[key]
+		summary.PassRate = float64(summary.Passes) / float64(summary.Total())
+		summaries = append(summaries, *summary)
+	}
+	return summaries, nil
+}
@@ -0,0 +1,399 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metric groups.
+const (
+	GroupRuns          = "runs"
+	GroupHealth        = "health"
+	GroupFlakes        = "flakes"
+	GroupIncidents     = "incidents"
+	GroupProbes        = "probes"
+	GroupNotifications = "notifications"
+	GroupExports       = "exports"
+	GroupJUnit         = "junit"
+	GroupWebhook       = "webhook"
+	GroupInternal      = "internal"
+)
+
+// Groups are all metric groups.
+var Groups = []Group{
+	{Name: GroupRuns, Description: "Outcomes of completed runs, pod failures, runs in flight and leaked leases.", Enabled: true},
+	{Name: GroupHealth, Description: "Pool and portgroup health scores and pass rates.", Enabled: true},
+	{Name: GroupFlakes, Description: "Pool and portgroup flake rates.", Enabled: true},
+	{Name: GroupIncidents, Description: "Active incidents of correlated failures.", Enabled: true},
+	{Name: GroupProbes, Description: "Canary lease probes.", Enabled: true},
+	{Name: GroupNotifications, Description: "Delivery of notifications.", Enabled: true},
+	{Name: GroupExports, Description: "Delivery of traces, CloudEvents, Sippy exports and pushed metrics.", Enabled: true},
+	{Name: GroupJUnit, Description: "Ingestion of JUnit results and allow-listed test case results.", Enabled: true},
+	{Name: GroupWebhook, Description: "Prow job notifications received over the webhook.", Enabled: true},
+	{Name: GroupInternal, Description: "Run observers and the series of the exposed metrics.", Enabled: true},
+}
+
+var (
+	RunPasses = Metric{
+		Name:      "prow_ci_test_passes",
+		Help:      "The total number of passes for a given prow variant.",
+		Type:      TypeCounter,
+		Labels:    []string{"test_name", "variant", "job_type", "pool", "network_type", "vlan"},
+		Group:     GroupRuns,
+		Stability: StabilityStable,
+	}
+	RunFails = Metric{
+		Name:      "prow_ci_test_fails",
+		Help:      "The total number of fails for a given prow variant.",
+		Type:      TypeCounter,
+		Labels:    []string{"test_name", "variant", "job_type", "pool", "network_type", "vlan"},
+		Group:     GroupRuns,
+		Stability: StabilityStable,
+	}
+	RunCorrections = Metric{
+		Name:      "prow_ci_test_corrections",
+		Help:      "The total number of completed runs whose outcome was corrected after they were counted, by corrected outcome.",
+		Type:      TypeCounter,
+		Labels:    []string{"test_name", "variant", "job_type", "pool", "network_type", "vlan", "outcome"},
+		Group:     GroupRuns,
+		Stability: StabilityAlpha,
+	}
+	PodFailures = Metric{
+		Name:      "prow_ci_pod_failures",
+		Help:      "The total number of pod failures for a given prow variant.",
+		Type:      TypeCounter,
+		Labels:    []string{"test_name", "variant", "pod_name", "node_name"},
+		Group:     GroupRuns,
+		Stability: StabilityStable,
+	}
+	RunsInFlight = Metric{
+		Name:      "prow_ci_runs_in_flight",
+		Help:      "The number of test runs currently in flight.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool", "network_type", "vlan"},
+		Group:     GroupRuns,
+		Stability: StabilityBeta,
+	}
+	RunsFailedInFlight = Metric{
+		Name:      "prow_ci_runs_failed_in_flight",
+		Help:      "The number of test runs in flight which already have a failed pod.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool", "network_type", "vlan"},
+		Group:     GroupRuns,
+		Stability: StabilityBeta,
+	}
+	RunsStuck = Metric{
+		Name:      "prow_ci_runs_stuck",
+		Help:      "The number of test runs in flight for longer than the maximum expected run age.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool", "network_type", "vlan"},
+		Group:     GroupRuns,
+		Stability: StabilityBeta,
+	}
+	OldestRunAge = Metric{
+		Name:      "prow_ci_oldest_run_age_seconds",
+		Help:      "The age of the oldest test run in flight.",
+		Type:      TypeGauge,
+		Group:     GroupRuns,
+		Stability: StabilityBeta,
+	}
+	LeasesLeaked = Metric{
+		Name:      "prow_ci_leases_leaked",
+		Help:      "The number of leases which outlived their test namespace.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool"},
+		Group:     GroupRuns,
+		Stability: StabilityAlpha,
+	}
+
+	PoolHealthScore = Metric{
+		Name:      "pool_health_score",
+		Help:      "Standard deviations the failures of a pool lie above the failures expected from the global rate of the same tests and variants.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool"},
+		Group:     GroupHealth,
+		Stability: StabilityBeta,
+	}
+	PortgroupHealthScore = Metric{
+		Name:      "portgroup_health_score",
+		Help:      "Standard deviations the failures of a portgroup lie above the failures expected from the global rate of the same tests and variants.",
+		Type:      TypeGauge,
+		Labels:    []string{"portgroup"},
+		Group:     GroupHealth,
+		Stability: StabilityBeta,
+	}
+	PoolFailureRateByConcurrency = Metric{
+		Name:      "pool_failure_rate_by_concurrency",
+		Help:      "The failure rate of runs on a pool, or a portgroup of it, bucketed by the number of other runs in flight on the pool or portgroup when they were leased.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool", "portgroup", "concurrency"},
+		Group:     GroupHealth,
+		Stability: StabilityAlpha,
+	}
+	PoolRunsByConcurrency = Metric{
+		Name:      "pool_runs_by_concurrency",
+		Help:      "The number of runs on a pool, or a portgroup of it, bucketed by the number of other runs in flight on the pool or portgroup when they were leased or first failed.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool", "portgroup", "phase", "concurrency"},
+		Group:     GroupHealth,
+		Stability: StabilityAlpha,
+	}
+	PoolPassRate = Metric{
+		Name:      "pool_pass_rate",
+		Help:      "The share of runs on a pool, portgroup and variant which passed within the window.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool", "portgroup", "variant", "window"},
+		Group:     GroupHealth,
+		Stability: StabilityAlpha,
+	}
+	PoolRunsWindow = Metric{
+		Name:      "pool_runs_total_window",
+		Help:      "The number of runs on a pool, portgroup and variant which completed within the window.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool", "portgroup", "variant", "window"},
+		Group:     GroupHealth,
+		Stability: StabilityAlpha,
+	}
+
+	PoolFlakeRate = Metric{
+		Name:      "pool_flake_rate",
+		Help:      "The share of runs on a pool which failed and then passed when rerun for the same commit.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool"},
+		Group:     GroupFlakes,
+		Stability: StabilityBeta,
+	}
+	PortgroupFlakeRate = Metric{
+		Name:      "portgroup_flake_rate",
+		Help:      "The share of runs on a portgroup which failed and then passed when rerun for the same commit.",
+		Type:      TypeGauge,
+		Labels:    []string{"portgroup"},
+		Group:     GroupFlakes,
+		Stability: StabilityBeta,
+	}
+
+	IncidentAffectedNamespaces = Metric{
+		Name:      "failure_incident_affected_namespaces",
+		Help:      "The number of namespaces affected by an active incident of correlated failures sharing the same topology.",
+		Type:      TypeGauge,
+		Labels:    []string{"dimension", "value"},
+		Group:     GroupIncidents,
+		Stability: StabilityBeta,
+	}
+
+	PoolProbeSuccess = Metric{
+		Name:      "pool_probe_success",
+		Help:      "Whether the latest canary lease pinned to a pool was fulfilled with a complete topology.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool"},
+		Group:     GroupProbes,
+		Stability: StabilityAlpha,
+	}
+	PoolProbeLastRun = Metric{
+		Name:      "pool_probe_last_run_timestamp_seconds",
+		Help:      "When the latest canary lease pinned to a pool was created.",
+		Type:      TypeGauge,
+		Labels:    []string{"pool"},
+		Group:     GroupProbes,
+		Stability: StabilityAlpha,
+	}
+	PoolProbes = Metric{
+		Name:      "pool_probes_total",
+		Help:      "The number of canary leases pinned to a pool by outcome.",
+		Type:      TypeCounter,
+		Labels:    []string{"pool", "outcome"},
+		Group:     GroupProbes,
+		Stability: StabilityAlpha,
+	}
+	PoolProbeFulfilled = Metric{
+		Name:      "pool_probe_fulfilled_seconds",
+		Help:      "How long the capacity manager took to fulfill a canary lease pinned to a pool.",
+		Type:      TypeHistogram,
+		Labels:    []string{"pool"},
+		Group:     GroupProbes,
+		Stability: StabilityAlpha,
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 900},
+	}
+
+	NotificationsSent = Metric{
+		Name:      "notifications_sent_total",
+		Help:      "The number of notifications sent to a receiver by alert and status.",
+		Type:      TypeCounter,
+		Labels:    []string{"receiver", "alertname", "status"},
+		Group:     GroupNotifications,
+		Stability: StabilityBeta,
+	}
+	NotificationErrors = Metric{
+		Name:      "notification_errors_total",
+		Help:      "The number of notifications which could not be delivered to a receiver.",
+		Type:      TypeCounter,
+		Labels:    []string{"receiver"},
+		Group:     GroupNotifications,
+		Stability: StabilityBeta,
+	}
+
+	TraceRunsExported = Metric{
+		Name:      "trace_runs_exported_total",
+		Help:      "The number of runs exported as traces.",
+		Type:      TypeCounter,
+		Group:     GroupExports,
+		Stability: StabilityAlpha,
+	}
+	TraceRunsDropped = Metric{
+		Name:      "trace_runs_dropped_total",
+		Help:      "The number of runs which could not be exported as traces by reason.",
+		Type:      TypeCounter,
+		Labels:    []string{"reason"},
+		Group:     GroupExports,
+		Stability: StabilityAlpha,
+	}
+	CloudEventsDelivered = Metric{
+		Name:      "cloudevents_delivered_total",
+		Help:      "The number of run lifecycle events delivered to a sink by type.",
+		Type:      TypeCounter,
+		Labels:    []string{"sink", "type"},
+		Group:     GroupExports,
+		Stability: StabilityAlpha,
+	}
+	CloudEventsDropped = Metric{
+		Name:      "cloudevents_dropped_total",
+		Help:      "The number of run lifecycle events which were not delivered to a sink by reason.",
+		Type:      TypeCounter,
+		Labels:    []string{"sink", "reason"},
+		Group:     GroupExports,
+		Stability: StabilityAlpha,
+	}
+	CloudEventsQueued = Metric{
+		Name:      "cloudevents_queued",
+		Help:      "The number of run lifecycle events waiting to be delivered to a sink.",
+		Type:      TypeGauge,
+		Labels:    []string{"sink"},
+		Group:     GroupExports,
+		Stability: StabilityAlpha,
+	}
+	MetricsPushes = Metric{
+		Name:      "metrics_pushes_total",
+		Help:      "The number of pushes of the metrics to a remote-write endpoint or Pushgateway which were delivered, written to the fallback directory or lost.",
+		Type:      TypeCounter,
+		Labels:    []string{"protocol", "outcome"},
+		Group:     GroupExports,
+		Stability: StabilityAlpha,
+	}
+	SippyJobRunsExported = Metric{
+		Name:      "sippy_job_runs_exported_total",
+		Help:      "The number of job runs written to Sippy export files.",
+		Type:      TypeCounter,
+		Group:     GroupExports,
+		Stability: StabilityAlpha,
+	}
+
+	JUnitIngestions = Metric{
+		Name:      "junit_ingestions_total",
+		Help:      "The number of runs whose JUnit results were ingested, not found before the timeout or failed to ingest.",
+		Type:      TypeCounter,
+		Labels:    []string{"outcome"},
+		Group:     GroupJUnit,
+		Stability: StabilityAlpha,
+	}
+	JUnitTestCaseResults = Metric{
+		Name:      "junit_testcase_results_total",
+		Help:      "The number of results of allow-listed test cases by pool and portgroup.",
+		Type:      TypeCounter,
+		Labels:    []string{"testcase", "pool", "portgroup", "result"},
+		Group:     GroupJUnit,
+		Stability: StabilityAlpha,
+	}
+
+	ProwWebhooksReceived = Metric{
+		Name:      "prow_webhooks_received_total",
+		Help:      "The number of prow job notifications applied, ignored because the prow job did not finish yet, or rejected.",
+		Type:      TypeCounter,
+		Labels:    []string{"outcome"},
+		Group:     GroupWebhook,
+		Stability: StabilityAlpha,
+	}
+
+	RunObserverDropped = Metric{
+		Name:      "run_observer_dropped_total",
+		Help:      "The number of notifications dropped because the queue of a run observer was full.",
+		Type:      TypeCounter,
+		Labels:    []string{"observer", "hook"},
+		Group:     GroupInternal,
+		Stability: StabilityAlpha,
+	}
+	RunObserverPanics = Metric{
+		Name:      "run_observer_panics_total",
+		Help:      "The number of notifications a run observer panicked on.",
+		Type:      TypeCounter,
+		Labels:    []string{"observer", "hook"},
+		Group:     GroupInternal,
+		Stability: StabilityAlpha,
+	}
+	RunObserverDuration = Metric{
+		Name:      "run_observer_duration_seconds",
+		Help:      "How long a run observer took to handle a notification.",
+		Type:      TypeHistogram,
+		Labels:    []string{"observer", "hook"},
+		Group:     GroupInternal,
+		Stability: StabilityAlpha,
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 10, 7),
+	}
+	MetricSeries = Metric{
+		Name:      "metric_series",
+		Help:      "The number of series of each metric family exposed by the monitor.",
+		Type:      TypeGauge,
+		Labels:    []string{"family"},
+		Group:     GroupInternal,
+		Stability: StabilityAlpha,
+	}
+	MetricLabelOverflows = Metric{
+		Name:      "metric_label_overflows_total",
+		Help:      "The number of increments whose label value was replaced with other because it was not allowed or exceeded the limit of its label.",
+		Type:      TypeCounter,
+		Labels:    []string{"family", "label"},
+		Group:     GroupInternal,
+		Stability: StabilityAlpha,
+	}
+)
+
+// Catalog lists every metric family exposed by the monitor.
+var Catalog = []*Metric{
+	&RunPasses,
+	&RunFails,
+	&RunCorrections,
+	&PodFailures,
+	&RunsInFlight,
+	&RunsFailedInFlight,
+	&RunsStuck,
+	&OldestRunAge,
+	&LeasesLeaked,
+	&PoolHealthScore,
+	&PortgroupHealthScore,
+	&PoolFailureRateByConcurrency,
+	&PoolRunsByConcurrency,
+	&PoolPassRate,
+	&PoolRunsWindow,
+	&PoolFlakeRate,
+	&PortgroupFlakeRate,
+	&IncidentAffectedNamespaces,
+	&PoolProbeSuccess,
+	&PoolProbeLastRun,
+	&PoolProbes,
+	&PoolProbeFulfilled,
+	&NotificationsSent,
+	&NotificationErrors,
+	&TraceRunsExported,
+	&TraceRunsDropped,
+	&CloudEventsDelivered,
+	&CloudEventsDropped,
+	&CloudEventsQueued,
+	&MetricsPushes,
+	&SippyJobRunsExported,
+	&JUnitIngestions,
+	&JUnitTestCaseResults,
+	&ProwWebhooksReceived,
+	&RunObserverDropped,
+	&RunObserverPanics,
+	&RunObserverDuration,
+	&MetricSeries,
+	&MetricLabelOverflows,
+}
@@ -0,0 +1,53 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats of the catalog.
+const (
+	FormatTable    = "table"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+// WriteCatalog writes the metrics of the catalog in the given format,
+// limited to a group if it is not empty.
+func WriteCatalog(w io.Writer, format string, group string) error {
+	var selected []*Metric
+	for _, metric := range Catalog {
+		if len(group) == 0 || metric.Group == group {
+			selected = append(selected, metric)
+		}
+	}
+
+	switch format {
+	case FormatTable:
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "NAME\tTYPE\tGROUP\tSTABILITY\tLABELS")
+		for _, metric := range selected {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", metric.Name, metric.Type, metric.Group, metric.Stability, strings.Join(metric.Labels, ","))
+		}
+		return table.Flush()
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(selected)
+	case FormatMarkdown:
+		fmt.Fprintln(w, "| Metric | Type | Group | Stability | Labels | Description |")
+		fmt.Fprintln(w, "|--------|------|-------|-----------|--------|-------------|")
+		for _, metric := range selected {
+			labels := make([]string, len(metric.Labels))
+			for i, label := range metric.Labels {
+				labels[i] = "`" + label + "`"
+			}
+			fmt.Fprintf(w, "| `%s` | %s | %s | %s | %s | %s |\n", metric.Name, metric.Type, metric.Group, metric.Stability, strings.Join(labels, ", "), metric.Help)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, expected %s, %s or %s", format, FormatTable, FormatJSON, FormatMarkdown)
+}
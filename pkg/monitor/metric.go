@@ -0,0 +1,154 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Types of metrics.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Stability levels of metrics. Stable metrics keep their name and labels,
+// beta metrics may still change in minor ways, alpha metrics may change or
+// disappear, and deprecated metrics will be removed.
+const (
+	StabilityStable     = "stable"
+	StabilityBeta       = "beta"
+	StabilityAlpha      = "alpha"
+	StabilityDeprecated = "deprecated"
+)
+
+// Metric declares a metric family exposed by the monitor.
+type Metric struct {
+	Name      string    `json:"name"`
+	Help      string    `json:"help"`
+	Type      string    `json:"type"`
+	Labels    []string  `json:"labels,omitempty"`
+	Group     string    `json:"group"`
+	Stability string    `json:"stability"`
+	Buckets   []float64 `json:"buckets,omitempty"`
+}
+
+// Group is a set of metrics which is enabled or disabled as a whole.
+type Group struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Enabled is whether the group is enabled unless configured otherwise.
+	Enabled bool `json:"enabled"`
+}
+
+var (
+	// disabled holds the groups disabled by SetGroups.
+	disabled = make(map[string]bool)
+	// groupsMutex guards disabled.
+	groupsMutex sync.Mutex
+)
+
+// SetGroups enables and disables metric groups from a comma separated list
+// of group=true|false pairs, e.g. junit=false,health=true. Groups which are
+// not listed keep their default.
+func SetGroups(value string) error {
+	groupsMutex.Lock()
+	defer groupsMutex.Unlock()
+
+	for _, group := range Groups {
+		disabled[group.Name] = !group.Enabled
+	}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			return fmt.Errorf("invalid metric group %q, expected group=true or group=false", pair)
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid metric group %q: %w", pair, err)
+		}
+		if _, known := disabled[name]; !known {
+			return fmt.Errorf("unknown metric group %q, known groups are %s", name, strings.Join(GroupNames(), ", "))
+		}
+		disabled[name] = !enabled
+	}
+	return nil
+}
+
+// Enabled returns true if the metrics of a group are exposed.
+func Enabled(group string) bool {
+	groupsMutex.Lock()
+	defer groupsMutex.Unlock()
+
+	if isDisabled, configured := disabled[group]; configured {
+		return !isDisabled
+	}
+	for _, known := range Groups {
+		if known.Name == group {
+			return known.Enabled
+		}
+	}
+	return true
+}
+
+// GroupNames returns the names of all metric groups.
+func GroupNames() []string {
+	var names []string
+	for _, group := range Groups {
+		names = append(names, group.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewCounter returns a counter of the metric, which must have no labels.
+func (m *Metric) NewCounter() prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{Name: m.Name, Help: m.Help})
+}
+
+// NewCounterVec returns a counter vector of the metric.
+func (m *Metric) NewCounterVec() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{Name: m.Name, Help: m.Help}, m.Labels)
+}
+
+// NewGaugeVec returns a gauge vector of the metric.
+func (m *Metric) NewGaugeVec() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: m.Name, Help: m.Help}, m.Labels)
+}
+
+// NewHistogramVec returns a histogram vector of the metric.
+func (m *Metric) NewHistogramVec() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: m.Name, Help: m.Help, Buckets: m.Buckets}, m.Labels)
+}
+
+// NewDesc returns the descriptor of the metric for collectors computing it on every scrape.
+func (m *Metric) NewDesc() *prometheus.Desc {
+	return prometheus.NewDesc(m.Name, m.Help, m.Labels, nil)
+}
+
+// Register exposes the collector of the metric, unless the group of the
+// metric is disabled. The collector of a disabled metric still works, it is
+// just not scraped.
+func (m *Metric) Register(collector prometheus.Collector) error {
+	if !Enabled(m.Group) {
+		return nil
+	}
+	return metrics.Registry.Register(collector)
+}
+
+// MustRegister registers the collector like Register and panics if it fails.
+func (m *Metric) MustRegister(collector prometheus.Collector) {
+	if err := m.Register(collector); err != nil {
+		panic(fmt.Errorf("error registering %s metric: %w", m.Name, err))
+	}
+}
@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Receiver types.
+const (
+	ReceiverWebhook      = "webhook"
+	ReceiverSlack        = "slack"
+	ReceiverAlertmanager = "alertmanager"
+)
+
+const (
+	defaultInterval             = time.Minute
+	defaultResendInterval       = 4 * time.Hour
+	defaultHealthScoreThreshold = 3
+	defaultHealthMinRuns        = 10
+)
+
+// Config configures where and how often notifications are sent.
+type Config struct {
+	// Interval is how often alerts are evaluated.
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// ResendInterval is how often a receiver is reminded of an alert which is still firing.
+	ResendInterval metav1.Duration `json:"resend_interval,omitempty"`
+
+	// HealthScoreThreshold is the pool health score from which a pool is reported as degraded.
+	HealthScoreThreshold float64 `json:"health_score_threshold,omitempty"`
+	// HealthMinRuns is the number of runs a pool needs in the health window before it can be reported.
+	HealthMinRuns int `json:"health_min_runs,omitempty"`
+
+	Receivers []ReceiverConfig `json:"receivers"`
+	Silences  []Silence        `json:"silences,omitempty"`
+}
+
+// ReceiverConfig configures a single notifier.
+type ReceiverConfig struct {
+	Name string `json:"name"`
+	// Type is one of webhook, slack or alertmanager.
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// Headers are added to every request, e.g. for authorization.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Template is a text/template rendering the message of an alert. It is
+	// ignored by the alertmanager receiver.
+	Template string `json:"template,omitempty"`
+	// Alerts limits the receiver to the named alerts. All alerts are sent if empty.
+	Alerts []string `json:"alerts,omitempty"`
+}
+
+// Silence suppresses the alerts whose labels match all of its matchers.
+type Silence struct {
+	Matchers map[string]string `json:"matchers"`
+	// EndsAt is when the silence expires. Silences without an end never expire.
+	EndsAt  *metav1.Time `json:"ends_at,omitempty"`
+	Comment string       `json:"comment,omitempty"`
+}
+
+// Matches returns true if the silence is in effect and matches the alert.
+func (s *Silence) Matches(alert *Alert, now time.Time) bool {
+	if s.EndsAt != nil && now.After(s.EndsAt.Time) {
+		return false
+	}
+	for name, value := range s.Matchers {
+		if alert.Labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadConfig reads the notification config from a YAML file and applies the defaults.
+func LoadConfig(filename string) (*Config, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+	}
+
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, fmt.Errorf("failed to decode notification config %s: %w", filename, err)
+	}
+
+	if config.Interval.Duration <= 0 {
+		config.Interval.Duration = defaultInterval
+	}
+	if config.ResendInterval.Duration <= 0 {
+		config.ResendInterval.Duration = defaultResendInterval
+	}
+	if config.HealthScoreThreshold <= 0 {
+		config.HealthScoreThreshold = defaultHealthScoreThreshold
+	}
+	if config.HealthMinRuns <= 0 {
+		config.HealthMinRuns = defaultHealthMinRuns
+	}
+
+	names := make(map[string]bool)
+	for _, receiver := range config.Receivers {
+		if len(receiver.Name) == 0 {
+			return nil, fmt.Errorf("receiver without a name in %s", filename)
+		}
+		if names[receiver.Name] {
+			return nil, fmt.Errorf("duplicate receiver %q in %s", receiver.Name, filename)
+		}
+		names[receiver.Name] = true
+		if len(receiver.URL) == 0 {
+			return nil, fmt.Errorf("receiver %q has no url", receiver.Name)
+		}
+	}
+	for _, silence := range config.Silences {
+		if len(silence.Matchers) == 0 {
+			return nil, fmt.Errorf("silence %q has no matchers and would silence every alert", silence.Comment)
+		}
+	}
+	return config, nil
+}
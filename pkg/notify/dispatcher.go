@@ -0,0 +1,374 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	notificationsFilename = "notifications.json"
+)
+
+// Source returns the alerts currently firing.
+type Source func(now time.Time) []Alert
+
+// deduplicator is implemented by notifiers whose receiver deduplicates alerts
+// itself and expects firing alerts on every evaluation.
+type deduplicator interface {
+	Deduplicates() bool
+}
+
+// Deduplicates lets Alertmanager resolve alerts which are no longer sent.
+func (n *AlertmanagerNotifier) Deduplicates() bool {
+	return true
+}
+
+// delivery is a notification of a receiver, decided under the lock and sent without it.
+type delivery struct {
+	notifier Notifier
+	key      string
+	alert    Alert
+	sent     bool
+}
+
+// alertState tracks a firing alert and when each receiver was last notified of it.
+type alertState struct {
+	Alert    Alert                `json:"alert"`
+	LastSent map[string]time.Time `json:"last_sent,omitempty"`
+	Silenced bool                 `json:"silenced"`
+}
+
+// AlertStatus is the API representation of a firing alert.
+type AlertStatus struct {
+	Alert
+	Silenced bool                 `json:"silenced"`
+	LastSent map[string]time.Time `json:"last_sent,omitempty"`
+}
+
+// Dispatcher evaluates the alert sources every interval and notifies the
+// receivers of new, still firing and resolved alerts.
+type Dispatcher struct {
+	Config  *Config
+	Sources []Source
+	// Client is used by the notifiers. A default client is used if nil.
+	Client *http.Client
+	// Directory keeps the alert states across restarts. It defaults to the
+	// directory of the test context service.
+	Directory string
+
+	notifiers []Notifier
+	alerts    map[string]*alertState
+	// filename is where the alert states are saved.
+	filename string
+
+	sentCounter   *prometheus.CounterVec
+	errorsCounter *prometheus.CounterVec
+
+	mutex sync.Mutex
+
+	log logr.Logger
+}
+
+func (d *Dispatcher) SetupWithManager(mgr ctrl.Manager) error {
+	d.log = mgr.GetLogger().WithName("notify")
+	if len(d.Directory) == 0 {
+		d.Directory = testcontext.DefaultDirectory
+	}
+	if err := d.init(path.Join(d.Directory, notificationsFilename)); err != nil {
+		return err
+	}
+
+	if err := monitor.NotificationsSent.Register(d.sentCounter); err != nil {
+		return fmt.Errorf("error registering notifications sent metric: %w", err)
+	}
+	if err := monitor.NotificationErrors.Register(d.errorsCounter); err != nil {
+		return fmt.Errorf("error registering notification errors metric: %w", err)
+	}
+
+	if err := d.Restore(d.filename); err != nil {
+		d.log.Error(err, "error restoring notifications")
+	}
+
+	if err := mgr.Add(d); err != nil {
+		return fmt.Errorf("error adding notification dispatcher to manager: %w", err)
+	}
+	return nil
+}
+
+// init creates the notifiers of the receivers and the metrics, and keeps the
+// alert states in filename.
+func (d *Dispatcher) init(filename string) error {
+	for _, receiver := range d.Config.Receivers {
+		notifier, err := NewNotifier(receiver, d.Client)
+		if err != nil {
+			return err
+		}
+		d.notifiers = append(d.notifiers, notifier)
+	}
+
+	d.sentCounter = monitor.NotificationsSent.NewCounterVec()
+	d.errorsCounter = monitor.NotificationErrors.NewCounterVec()
+	d.alerts = make(map[string]*alertState)
+	d.filename = filename
+	return nil
+}
+
+// SetupWithServer lists the firing alerts through the API.
+func (d *Dispatcher) SetupWithServer(server *api.Server) {
+	server.Handle("GET /api/v1/alerts", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := api.WriteJSON(w, http.StatusOK, d.Alerts()); err != nil {
+			d.log.Error(err, "error encoding response")
+		}
+	}))
+}
+
+// Start evaluates the alerts every interval until the context is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, d.update, d.Config.Interval.Duration)
+	return nil
+}
+
+// Alerts returns the firing alerts, most recent first.
+func (d *Dispatcher) Alerts() []AlertStatus {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	alerts := make([]AlertStatus, 0, len(d.alerts))
+	for _, state := range d.alerts {
+		lastSent := make(map[string]time.Time, len(state.LastSent))
+		for receiver, sent := range state.LastSent {
+			lastSent[receiver] = sent
+		}
+		alerts = append(alerts, AlertStatus{Alert: state.Alert, Silenced: state.Silenced, LastSent: lastSent})
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].StartsAt.After(alerts[j].StartsAt)
+	})
+	return alerts
+}
+
+func (d *Dispatcher) update(ctx context.Context) {
+	d.dispatch(ctx, time.Now())
+}
+
+// dispatch evaluates the sources and notifies the receivers. The receivers
+// are notified without holding the lock, so the API is not blocked by slow
+// receivers, and the alert states are only saved if they changed.
+func (d *Dispatcher) dispatch(ctx context.Context, now time.Time) {
+	firing := make(map[string]Alert)
+	for _, source := range d.Sources {
+		for _, alert := range source(now) {
+			firing[alert.Key] = alert
+		}
+	}
+
+	deliveries, changed := d.evaluate(firing, now)
+	for i := range deliveries {
+		deliveries[i].sent = d.send(ctx, deliveries[i].notifier, &deliveries[i].alert)
+	}
+	if d.record(deliveries, now) || changed {
+		if err := d.save(d.filename); err != nil {
+			d.log.Error(err, "error saving notifications")
+		}
+	}
+}
+
+// evaluate updates the alert states with the firing alerts and returns the
+// notifications which are due, and whether the alert states changed.
+func (d *Dispatcher) evaluate(firing map[string]Alert, now time.Time) ([]delivery, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var deliveries []delivery
+	changed := false
+	for key, alert := range firing {
+		state, exists := d.alerts[key]
+		if !exists {
+			state = &alertState{Alert: alert, LastSent: make(map[string]time.Time)}
+			d.alerts[key] = state
+			changed = true
+			d.log.Info("alert firing", "alert", key)
+		} else {
+			// keep when the alert first fired, refresh everything else
+			alert.StartsAt = state.Alert.StartsAt
+			state.Alert = alert
+		}
+		silenced := d.silenced(&state.Alert, now)
+		changed = changed || silenced != state.Silenced
+		state.Silenced = silenced
+		if state.Silenced {
+			continue
+		}
+		for _, notifier := range d.notifiers {
+			if d.due(notifier, state, now) {
+				deliveries = append(deliveries, delivery{notifier: notifier, key: key, alert: state.Alert})
+			}
+		}
+	}
+
+	for key, state := range d.alerts {
+		if _, exists := firing[key]; exists {
+			continue
+		}
+		if state.Alert.EndsAt == nil {
+			resolved := now
+			state.Alert.EndsAt = &resolved
+			changed = true
+			d.log.Info("alert resolved", "alert", key)
+		}
+		// only receivers which were told the alert fired are told it resolved
+		for _, notifier := range d.notifiers {
+			if _, sent := state.LastSent[notifier.Name()]; sent {
+				deliveries = append(deliveries, delivery{notifier: notifier, key: key, alert: state.Alert})
+			}
+		}
+		if len(state.LastSent) == 0 {
+			delete(d.alerts, key)
+			changed = true
+		}
+	}
+	return deliveries, changed
+}
+
+// record records when the receivers were notified and drops resolved alerts
+// once every receiver was told. It returns whether the alert states changed.
+func (d *Dispatcher) record(deliveries []delivery, now time.Time) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	changed := false
+	for _, delivery := range deliveries {
+		state, exists := d.alerts[delivery.key]
+		if !delivery.sent || !exists {
+			continue
+		}
+		name := delivery.notifier.Name()
+		if delivery.alert.EndsAt != nil {
+			delete(state.LastSent, name)
+			if len(state.LastSent) == 0 {
+				delete(d.alerts, delivery.key)
+			}
+			changed = true
+			continue
+		}
+		_, notified := state.LastSent[name]
+		state.LastSent[name] = now
+		// receivers which deduplicate are sent every alert on every evaluation
+		if dedup, ok := delivery.notifier.(deduplicator); !notified || !ok || !dedup.Deduplicates() {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// silenced returns true if any silence in effect matches the alert.
+func (d *Dispatcher) silenced(alert *Alert, now time.Time) bool {
+	for i := range d.Config.Silences {
+		if d.Config.Silences[i].Matches(alert, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// due returns true if the notifier accepts the alert and has not been
+// notified of it within the resend interval.
+func (d *Dispatcher) due(notifier Notifier, state *alertState, now time.Time) bool {
+	if !d.accepts(notifier, &state.Alert) {
+		return false
+	}
+	if dedup, ok := notifier.(deduplicator); ok && dedup.Deduplicates() {
+		return true
+	}
+	lastSent, sent := state.LastSent[notifier.Name()]
+	return !sent || now.Sub(lastSent) >= d.Config.ResendInterval.Duration
+}
+
+// accepts returns true if the receiver of the notifier is not limited to other alerts.
+func (d *Dispatcher) accepts(notifier Notifier, alert *Alert) bool {
+	for _, receiver := range d.Config.Receivers {
+		if receiver.Name != notifier.Name() {
+			continue
+		}
+		if len(receiver.Alerts) == 0 {
+			return true
+		}
+		for _, name := range receiver.Alerts {
+			if name == alert.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// send notifies a receiver. Failed notifications are retried on the next evaluation.
+func (d *Dispatcher) send(ctx context.Context, notifier Notifier, alert *Alert) bool {
+	if err := notifier.Notify(ctx, alert); err != nil {
+		d.log.Error(err, "error sending notification", "receiver", notifier.Name(), "alert", alert.Key)
+		d.errorsCounter.WithLabelValues(notifier.Name()).Inc()
+		return false
+	}
+	d.sentCounter.WithLabelValues(notifier.Name(), alert.Name, alert.Status()).Inc()
+	return true
+}
+
+// save saves the alert states to a file. They are encoded under the lock
+// and written without it.
+func (d *Dispatcher) save(filename string) error {
+	d.mutex.Lock()
+	content, err := json.MarshalIndent(d.alerts, "", "  ")
+	d.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode notifications: %w", err)
+	}
+
+	if err := os.WriteFile(filename, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// Restore restores the alert states from a file so receivers are not
+// notified again after a restart.
+func (d *Dispatcher) Restore(filename string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&d.alerts); err != nil {
+		return fmt.Errorf("failed to decode notifications: %w", err)
+	}
+	for _, state := range d.alerts {
+		if state.LastSent == nil {
+			state.LastSent = make(map[string]time.Time)
+		}
+	}
+
+	d.log.Info("Successfully restored notifications", "filename", filename, "count", len(d.alerts))
+	return nil
+}
@@ -0,0 +1,294 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// standIn is a local receiver recording the requests it is sent.
+type standIn struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	requests []request
+	// failures is how many requests are answered with an error before succeeding.
+	failures int
+}
+
+type request struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func newStandIn(t *testing.T) *standIn {
+	s := &standIn{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("error reading request: %v", err)
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.failures > 0 {
+			s.failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		s.requests = append(s.requests, request{path: r.URL.Path, header: r.Header.Clone(), body: body})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *standIn) received() []request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]request(nil), s.requests...)
+}
+
+func (s *standIn) fail(count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = count
+}
+
+func newDispatcher(t *testing.T, config *Config, sources ...Source) *Dispatcher {
+	t.Helper()
+	if config.ResendInterval.Duration == 0 {
+		config.ResendInterval.Duration = time.Hour
+	}
+	d := &Dispatcher{Config: config, Sources: sources, log: logr.Discard()}
+	if err := d.init(filepath.Join(t.TempDir(), "notifications.json")); err != nil {
+		t.Fatalf("error creating dispatcher: %v", err)
+	}
+	return d
+}
+
+// firingSource returns the alerts while firing is true.
+func firingSource(firing *bool, alerts ...Alert) Source {
+	return func(now time.Time) []Alert {
+		if !*firing {
+			return nil
+		}
+		return alerts
+	}
+}
+
+var degraded = Alert{
+	Key:     AlertPoolDegraded + "/pool-a",
+	Name:    AlertPoolDegraded,
+	Labels:  map[string]string{AlertNameLabel: AlertPoolDegraded, "pool": "pool-a"},
+	Summary: "pool pool-a is degraded",
+}
+
+func TestNotifiers(t *testing.T) {
+	webhook, slack, alertmanager := newStandIn(t), newStandIn(t), newStandIn(t)
+	d := newDispatcher(t, &Config{Receivers: []ReceiverConfig{
+		{Name: "webhook", Type: ReceiverWebhook, URL: webhook.URL, Headers: map[string]string{"Authorization": "Bearer secret"}},
+		{Name: "slack", Type: ReceiverSlack, URL: slack.URL, Template: "{{ .Status }} {{ .Labels.pool }}"},
+		{Name: "alertmanager", Type: ReceiverAlertmanager, URL: alertmanager.URL + "/"},
+	}})
+
+	alert := degraded
+	alert.StartsAt = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, notifier := range d.notifiers {
+		if err := notifier.Notify(context.Background(), &alert); err != nil {
+			t.Fatalf("error notifying %s: %v", notifier.Name(), err)
+		}
+	}
+
+	requests := webhook.received()
+	if len(requests) != 1 {
+		t.Fatalf("webhook received %d requests, expected 1", len(requests))
+	}
+	if got := requests[0].header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("webhook authorization %q, expected the configured header", got)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(requests[0].body, &payload); err != nil {
+		t.Fatalf("error decoding webhook payload: %v", err)
+	}
+	if payload.Status != StatusFiring || payload.Alert.Key != alert.Key || payload.Message != "[FIRING] PoolDegraded: pool pool-a is degraded" {
+		t.Errorf("unexpected webhook payload %+v", payload)
+	}
+
+	requests = slack.received()
+	if len(requests) != 1 {
+		t.Fatalf("slack received %d requests, expected 1", len(requests))
+	}
+	var message map[string]string
+	if err := json.Unmarshal(requests[0].body, &message); err != nil {
+		t.Fatalf("error decoding slack payload: %v", err)
+	}
+	if message["text"] != "firing pool-a" {
+		t.Errorf("slack text %q, expected the rendered template", message["text"])
+	}
+
+	requests = alertmanager.received()
+	if len(requests) != 1 {
+		t.Fatalf("alertmanager received %d requests, expected 1", len(requests))
+	}
+	if requests[0].path != "/api/v2/alerts" {
+		t.Errorf("alertmanager path %q, expected /api/v2/alerts", requests[0].path)
+	}
+	var alerts []alertmanagerAlert
+	if err := json.Unmarshal(requests[0].body, &alerts); err != nil {
+		t.Fatalf("error decoding alertmanager payload: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Labels["pool"] != "pool-a" || alerts[0].Annotations["summary"] != alert.Summary ||
+		!alerts[0].StartsAt.Equal(alert.StartsAt) || alerts[0].EndsAt != nil {
+		t.Errorf("unexpected alertmanager alerts %+v", alerts)
+	}
+}
+
+func TestDispatcherDeduplicatesAndResends(t *testing.T) {
+	webhook, alertmanager := newStandIn(t), newStandIn(t)
+	firing := true
+	d := newDispatcher(t, &Config{Receivers: []ReceiverConfig{
+		{Name: "webhook", Type: ReceiverWebhook, URL: webhook.URL},
+		{Name: "alertmanager", Type: ReceiverAlertmanager, URL: alertmanager.URL},
+	}}, firingSource(&firing, degraded))
+
+	start := time.Now()
+	ctx := context.Background()
+	d.dispatch(ctx, start)
+	d.dispatch(ctx, start.Add(time.Minute))
+	if got := len(webhook.received()); got != 1 {
+		t.Errorf("webhook received %d notifications within the resend interval, expected 1", got)
+	}
+	// Alertmanager deduplicates itself and resolves alerts which are no longer sent
+	if got := len(alertmanager.received()); got != 2 {
+		t.Errorf("alertmanager received %d notifications, expected one per evaluation", got)
+	}
+
+	d.dispatch(ctx, start.Add(time.Hour))
+	if got := len(webhook.received()); got != 2 {
+		t.Errorf("webhook received %d notifications after the resend interval, expected 2", got)
+	}
+}
+
+func TestDispatcherSilences(t *testing.T) {
+	webhook := newStandIn(t)
+	firing := true
+	ends := metav1.NewTime(time.Now().Add(time.Hour))
+	d := newDispatcher(t, &Config{
+		Receivers: []ReceiverConfig{{Name: "webhook", Type: ReceiverWebhook, URL: webhook.URL}},
+		Silences:  []Silence{{Matchers: map[string]string{"pool": "pool-a"}, EndsAt: &ends}},
+	}, firingSource(&firing, degraded))
+
+	ctx := context.Background()
+	d.dispatch(ctx, time.Now())
+	if got := len(webhook.received()); got != 0 {
+		t.Errorf("webhook received %d notifications of a silenced alert", got)
+	}
+	alerts := d.Alerts()
+	if len(alerts) != 1 || !alerts[0].Silenced {
+		t.Fatalf("expected a single silenced alert, got %+v", alerts)
+	}
+
+	// the alert is sent once the silence expired
+	d.dispatch(ctx, ends.Add(time.Minute))
+	if got := len(webhook.received()); got != 1 {
+		t.Errorf("webhook received %d notifications after the silence expired, expected 1", got)
+	}
+	if alerts := d.Alerts(); alerts[0].Silenced {
+		t.Errorf("alert is still silenced after the silence expired")
+	}
+}
+
+func TestDispatcherResolves(t *testing.T) {
+	webhook, slack, other := newStandIn(t), newStandIn(t), newStandIn(t)
+	firing := true
+	d := newDispatcher(t, &Config{Receivers: []ReceiverConfig{
+		{Name: "webhook", Type: ReceiverWebhook, URL: webhook.URL},
+		{Name: "slack", Type: ReceiverSlack, URL: slack.URL},
+		{Name: "other", Type: ReceiverWebhook, URL: other.URL, Alerts: []string{AlertLeaseLeaked}},
+	}}, firingSource(&firing, degraded))
+
+	start := time.Now()
+	ctx := context.Background()
+	d.dispatch(ctx, start)
+
+	// the resolution is retried for receivers which could not be told
+	firing = false
+	slack.fail(1)
+	d.dispatch(ctx, start.Add(time.Minute))
+	alerts := d.Alerts()
+	if len(alerts) != 1 || alerts[0].EndsAt == nil {
+		t.Fatalf("expected a resolved alert kept for the failed receiver, got %+v", alerts)
+	}
+	if _, pending := alerts[0].LastSent["slack"]; !pending || len(alerts[0].LastSent) != 1 {
+		t.Errorf("expected only slack to still be told, got %v", alerts[0].LastSent)
+	}
+
+	d.dispatch(ctx, start.Add(2*time.Minute))
+	if alerts := d.Alerts(); len(alerts) != 0 {
+		t.Errorf("expected the alert to be dropped once every receiver was told, got %+v", alerts)
+	}
+
+	for name, stand := range map[string]*standIn{"webhook": webhook, "slack": slack} {
+		requests := stand.received()
+		if len(requests) != 2 {
+			t.Fatalf("%s received %d notifications, expected firing and resolved", name, len(requests))
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(requests[1].body, &payload); err != nil {
+			t.Fatalf("error decoding %s payload: %v", name, err)
+		}
+		if name == "webhook" && payload["status"] != StatusResolved {
+			t.Errorf("webhook status %v, expected resolved", payload["status"])
+		}
+		if name == "slack" && payload["text"] != "[RESOLVED] PoolDegraded: pool pool-a is degraded" {
+			t.Errorf("slack text %v, expected the resolved message", payload["text"])
+		}
+	}
+	// receivers which were never told the alert fired are not told it resolved
+	if got := len(other.received()); got != 0 {
+		t.Errorf("receiver limited to other alerts received %d notifications", got)
+	}
+}
+
+func TestDispatcherSavesOnlyOnChange(t *testing.T) {
+	webhook := newStandIn(t)
+	firing := true
+	d := newDispatcher(t, &Config{Receivers: []ReceiverConfig{
+		{Name: "webhook", Type: ReceiverWebhook, URL: webhook.URL},
+	}}, firingSource(&firing, degraded))
+
+	start := time.Now()
+	ctx := context.Background()
+	d.dispatch(ctx, start)
+	if _, err := os.Stat(d.filename); err != nil {
+		t.Fatalf("expected the alert states to be saved: %v", err)
+	}
+
+	if err := os.Remove(d.filename); err != nil {
+		t.Fatal(err)
+	}
+	d.dispatch(ctx, start.Add(time.Minute))
+	if _, err := os.Stat(d.filename); !os.IsNotExist(err) {
+		t.Errorf("expected the unchanged alert states not to be saved, got %v", err)
+	}
+
+	restored := newDispatcher(t, &Config{}, nil)
+	firing = false
+	d.dispatch(ctx, start.Add(2*time.Minute))
+	if err := restored.Restore(d.filename); err != nil {
+		t.Fatalf("error restoring alert states: %v", err)
+	}
+	if alerts := restored.Alerts(); len(alerts) != 0 {
+		t.Errorf("expected the resolved alert to be saved as dropped, got %+v", alerts)
+	}
+}
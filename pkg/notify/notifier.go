@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// AlertNameLabel holds the name of the alert in its labels.
+	AlertNameLabel = "alertname"
+
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+
+	requestTimeout = 30 * time.Second
+
+	defaultTemplate = `[{{ .Status | upper }}] {{ .Name }}: {{ .Summary }}{{ if .Description }}
+{{ .Description }}{{ end }}`
+)
+
+// Alert is a condition worth notifying about, such as a degraded pool.
+type Alert struct {
+	// Key identifies the alert across evaluations for deduplication.
+	Key         string            `json:"key"`
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels"`
+	Summary     string            `json:"summary"`
+	Description string            `json:"description,omitempty"`
+	StartsAt    time.Time         `json:"starts_at"`
+	// EndsAt is set once the alert resolved.
+	EndsAt *time.Time `json:"ends_at,omitempty"`
+}
+
+// Status returns firing or resolved.
+func (a *Alert) Status() string {
+	if a.EndsAt != nil {
+		return StatusResolved
+	}
+	return StatusFiring
+}
+
+// Notifier delivers alerts to a receiver.
+type Notifier interface {
+	// Name is the name of the receiver in the config.
+	Name() string
+	// Notify sends a firing or resolved alert.
+	Notify(ctx context.Context, alert *Alert) error
+}
+
+// NewNotifier creates the notifier for a receiver. The HTTP client is shared
+// by all notifiers and may point them to a local stand-in.
+func NewNotifier(config ReceiverConfig, client *http.Client) (Notifier, error) {
+	base := httpNotifier{
+		name:    config.Name,
+		url:     config.URL,
+		headers: config.Headers,
+		client:  client,
+	}
+	if base.client == nil {
+		base.client = &http.Client{Timeout: requestTimeout}
+	}
+
+	switch config.Type {
+	case ReceiverWebhook, ReceiverSlack:
+		text := config.Template
+		if len(text) == 0 {
+			text = defaultTemplate
+		}
+		tmpl, err := template.New(config.Name).Funcs(template.FuncMap{
+			"upper": strings.ToUpper,
+			"lower": strings.ToLower,
+			"join":  strings.Join,
+		}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template of receiver %q: %w", config.Name, err)
+		}
+		if config.Type == ReceiverSlack {
+			return &SlackNotifier{httpNotifier: base, template: tmpl}, nil
+		}
+		return &WebhookNotifier{httpNotifier: base, template: tmpl}, nil
+	case ReceiverAlertmanager:
+		base.url = strings.TrimSuffix(base.url, "/") + "/api/v2/alerts"
+		return &AlertmanagerNotifier{httpNotifier: base}, nil
+	}
+	return nil, fmt.Errorf("receiver %q has unknown type %q", config.Name, config.Type)
+}
+
+// httpNotifier posts JSON payloads to a URL.
+type httpNotifier struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (n *httpNotifier) Name() string {
+	return n.name
+}
+
+func (n *httpNotifier) post(ctx context.Context, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range n.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending notification to %s: %w", n.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("receiver %s responded with %s: %s", n.name, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// templateData is what message templates are rendered with.
+type templateData struct {
+	*Alert
+	Status string
+}
+
+func render(tmpl *template.Template, alert *Alert) (string, error) {
+	var message strings.Builder
+	if err := tmpl.Execute(&message, templateData{Alert: alert, Status: alert.Status()}); err != nil {
+		return "", fmt.Errorf("error rendering template %s: %w", tmpl.Name(), err)
+	}
+	return message.String(), nil
+}
+
+// WebhookNotifier posts the alert and its rendered message to a generic webhook.
+type WebhookNotifier struct {
+	httpNotifier
+	template *template.Template
+}
+
+// WebhookPayload is the body posted by the webhook notifier.
+type WebhookPayload struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Alert   *Alert `json:"alert"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert *Alert) error {
+	message, err := render(n.template, alert)
+	if err != nil {
+		return err
+	}
+	return n.post(ctx, WebhookPayload{Status: alert.Status(), Message: message, Alert: alert})
+}
+
+// SlackNotifier posts the rendered message to a Slack-compatible incoming webhook.
+type SlackNotifier struct {
+	httpNotifier
+	template *template.Template
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, alert *Alert) error {
+	message, err := render(n.template, alert)
+	if err != nil {
+		return err
+	}
+	return n.post(ctx, map[string]string{"text": message})
+}
+
+// AlertmanagerNotifier posts alerts to the Alertmanager v2 API, which takes
+// care of its own grouping and routing.
+type AlertmanagerNotifier struct {
+	httpNotifier
+}
+
+// alertmanagerAlert is an alert as accepted by POST /api/v2/alerts.
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+func (n *AlertmanagerNotifier) Notify(ctx context.Context, alert *Alert) error {
+	annotations := map[string]string{"summary": alert.Summary}
+	if len(alert.Description) > 0 {
+		annotations["description"] = alert.Description
+	}
+	return n.post(ctx, []alertmanagerAlert{{
+		Labels:      alert.Labels,
+		Annotations: annotations,
+		StartsAt:    alert.StartsAt,
+		EndsAt:      alert.EndsAt,
+	}})
+}
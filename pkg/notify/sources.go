@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/health"
+	"github.com/openshift-splat-team/test-monitor/pkg/incident"
+)
+
+// Names of the alerts raised by the sources.
+const (
+	AlertPoolDegraded    = "PoolDegraded"
+	AlertLeaseLeaked     = "LeaseLeaked"
+	AlertFailureIncident = "FailureIncident"
+)
+
+// maxListedNamespaces limits how many namespaces are listed in the description of an incident.
+const maxListedNamespaces = 10
+
+// PoolHealthSource raises an alert for every pool whose health score reached
+// the threshold over at least the minimum number of runs.
+func PoolHealthSource(scorer *health.Scorer, threshold float64, minRuns int) Source {
+	return func(now time.Time) []Alert {
+		var alerts []Alert
+		for _, score := range scorer.PoolScores() {
+			if score.Runs < minRuns || score.ZScore < threshold {
+				continue
+			}
+			alerts = append(alerts, Alert{
+				Key:  AlertPoolDegraded + "/" + score.Name,
+				Name: AlertPoolDegraded,
+				Labels: map[string]string{
+					AlertNameLabel: AlertPoolDegraded,
+					"pool":         score.Name,
+				},
+				Summary: fmt.Sprintf("pool %s fails more often than its tests explain (health score %.1f)", score.Name, score.ZScore),
+				Description: fmt.Sprintf("%d of %d runs failed (%.0f%%, 95%% CI %.0f%%-%.0f%%) while %.0f%% were expected from the global failure rates of the same tests and variants.",
+					score.Failures, score.Runs, 100*score.FailureRate, 100*score.FailureRateLower, 100*score.FailureRateUpper, 100*score.ExpectedFailureRate),
+				StartsAt: now,
+			})
+		}
+		return alerts
+	}
+}
+
+// LeakedLeaseSource raises an alert for every lease which outlived its test namespace.
+func LeakedLeaseSource(testContext *testcontext.TestContextService) Source {
+	return func(now time.Time) []Alert {
+		var alerts []Alert
+		for _, lease := range testContext.GetLeakedLeases(testcontext.LeaseLeakGracePeriod) {
+			alerts = append(alerts, Alert{
+				Key:  AlertLeaseLeaked + "/" + lease.Name,
+				Name: AlertLeaseLeaked,
+				Labels: map[string]string{
+					AlertNameLabel: AlertLeaseLeaked,
+					"lease":        lease.Name,
+					"namespace":    lease.Namespace,
+					"pool":         lease.Pool,
+					"portgroup":    lease.Portgroup,
+				},
+				Summary:     fmt.Sprintf("lease %s on pool %s outlived its namespace %s", lease.Name, lease.Pool, lease.Namespace),
+				Description: fmt.Sprintf("The namespace has been gone since %s and the lease is still %s.", lease.OrphanedSince.Format(time.RFC3339), lease.Phase),
+				StartsAt:    *lease.OrphanedSince,
+			})
+		}
+		return alerts
+	}
+}
+
+// IncidentSource raises an alert for every active incident.
+func IncidentSource(correlator *incident.Correlator) Source {
+	return func(now time.Time) []Alert {
+		var alerts []Alert
+		for _, active := range correlator.Incidents() {
+			if !active.Active() {
+				continue
+			}
+			namespaces := active.Namespaces
+			if len(namespaces) > maxListedNamespaces {
+				namespaces = append(namespaces[:maxListedNamespaces:maxListedNamespaces], fmt.Sprintf("and %d more", len(active.Namespaces)-maxListedNamespaces))
+			}
+			alerts = append(alerts, Alert{
+				Key:  AlertFailureIncident + "/" + active.ID,
+				Name: AlertFailureIncident,
+				Labels: map[string]string{
+					AlertNameLabel: AlertFailureIncident,
+					"incident":     active.ID,
+					"dimension":    active.Dimension,
+					"value":        active.Value,
+				},
+				Summary:     fmt.Sprintf("%d namespaces sharing %s %s failed together", len(active.Namespaces), active.Dimension, active.Value),
+				Description: "Affected namespaces: " + strings.Join(namespaces, ", "),
+				StartsAt:    active.Detected,
+			})
+		}
+		return alerts
+	}
+}
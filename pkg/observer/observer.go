@@ -0,0 +1,37 @@
+package observer
+
+import (
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+)
+
+// RunObserver is notified of the lifecycle of test runs. The test contexts
+// passed to the hooks are copies shared by all observers and must not be
+// modified.
+type RunObserver interface {
+	// OnContextCreated is called when a namespace running a test is first seen.
+	OnContextCreated(testContext *data.TestContext)
+	// OnLeaseBound is called when the lease of a test context is fulfilled.
+	OnLeaseBound(testContext *data.TestContext, lease string)
+	// OnPodFailed is called once for every failed pod of a test context.
+	OnPodFailed(testContext *data.TestContext, failure data.PodFailure)
+	// OnRunCompleted is called when the namespace of a test context is deleted.
+	OnRunCompleted(testContext *data.TestContext, run data.RunRecord)
+	// OnRunCorrected is called when the outcome of a completed run changes
+	// after OnRunCompleted, e.g. once the final state of its prow job is
+	// known. The run is the corrected record of the run ledger.
+	OnRunCorrected(run data.RunRecord)
+}
+
+// NopObserver implements every hook of RunObserver as a no-op. Observers
+// embed it to implement only the hooks they are interested in.
+type NopObserver struct{}
+
+func (NopObserver) OnContextCreated(testContext *data.TestContext) {}
+
+func (NopObserver) OnLeaseBound(testContext *data.TestContext, lease string) {}
+
+func (NopObserver) OnPodFailed(testContext *data.TestContext, failure data.PodFailure) {}
+
+func (NopObserver) OnRunCompleted(testContext *data.TestContext, run data.RunRecord) {}
+
+func (NopObserver) OnRunCorrected(run data.RunRecord) {}
@@ -0,0 +1,221 @@
+package observer
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const defaultQueueSize = 1000
+
+// notification calls one of the hooks of an observer.
+type notification struct {
+	hook string
+	call func(observer RunObserver)
+}
+
+type registration struct {
+	name     string
+	observer RunObserver
+	// queue is nil for observers which are notified synchronously.
+	queue chan notification
+}
+
+// Registry delivers the lifecycle of test runs to the registered observers.
+// Optional observers, such as sinks to external systems, have their own
+// bounded queue drained by their own goroutine, so notifying never blocks the
+// caller. A slow observer only falls behind and has notifications dropped
+// once its queue is full, and a panicking observer only loses the
+// notification it panicked on. Observers whose outputs cannot be derived
+// again, such as the run counters and the run ledger, are registered with
+// RegisterSync and are notified by the caller before any queued observer.
+type Registry struct {
+	// QueueSize is the number of notifications which may wait for each observer.
+	QueueSize int
+
+	registrations []*registration
+	mutex         sync.Mutex
+
+	droppedCounter *prometheus.CounterVec
+	panicCounter   *prometheus.CounterVec
+	durationHist   *prometheus.HistogramVec
+
+	log logr.Logger
+}
+
+func (r *Registry) SetupWithManager(mgr ctrl.Manager) error {
+	if err := r.Initialize(mgr.GetLogger().WithName("observer")); err != nil {
+		return err
+	}
+	if err := mgr.Add(r); err != nil {
+		return fmt.Errorf("error adding run observer registry to manager: %w", err)
+	}
+	return nil
+}
+
+// Initialize registers the metrics of the registry. Synchronous observers
+// are notified once it is initialized, queued observers once it is started.
+func (r *Registry) Initialize(log logr.Logger) error {
+	r.log = log
+
+	r.droppedCounter = monitor.RunObserverDropped.NewCounterVec()
+	r.panicCounter = monitor.RunObserverPanics.NewCounterVec()
+	r.durationHist = monitor.RunObserverDuration.NewHistogramVec()
+	for metric, collector := range map[*monitor.Metric]prometheus.Collector{
+		&monitor.RunObserverDropped:  r.droppedCounter,
+		&monitor.RunObserverPanics:   r.panicCounter,
+		&monitor.RunObserverDuration: r.durationHist,
+	} {
+		if err := metric.Register(collector); err != nil {
+			return fmt.Errorf("error registering run observer metric: %w", err)
+		}
+	}
+	return nil
+}
+
+// Register adds an observer. Observers must be registered before the
+// manager is started.
+func (r *Registry) Register(name string, observer RunObserver) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	queueSize := r.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	r.registrations = append(r.registrations, &registration{
+		name:     name,
+		observer: observer,
+		queue:    make(chan notification, queueSize),
+	})
+}
+
+// RegisterSync adds an observer which is notified synchronously by the
+// caller, so none of its notifications are dropped or lost on shutdown. Its
+// hooks must be quick and must not call back into the caller.
+func (r *Registry) RegisterSync(name string, observer RunObserver) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.registrations = append(r.registrations, &registration{
+		name:     name,
+		observer: observer,
+	})
+}
+
+// ContextCreated notifies the observers of a newly seen test context.
+func (r *Registry) ContextCreated(testContext *data.TestContext) {
+	testContext = testContext.Copy()
+	r.notify("context_created", func(observer RunObserver) {
+		observer.OnContextCreated(testContext)
+	})
+}
+
+// LeaseBound notifies the observers of the fulfilled lease of a test context.
+func (r *Registry) LeaseBound(testContext *data.TestContext, lease string) {
+	testContext = testContext.Copy()
+	r.notify("lease_bound", func(observer RunObserver) {
+		observer.OnLeaseBound(testContext, lease)
+	})
+}
+
+// PodFailed notifies the observers of a failed pod of a test context.
+func (r *Registry) PodFailed(testContext *data.TestContext, failure data.PodFailure) {
+	testContext = testContext.Copy()
+	r.notify("pod_failed", func(observer RunObserver) {
+		observer.OnPodFailed(testContext, failure)
+	})
+}
+
+// RunCompleted notifies the observers of a completed test run.
+func (r *Registry) RunCompleted(testContext *data.TestContext, run data.RunRecord) {
+	testContext = testContext.Copy()
+	r.notify("run_completed", func(observer RunObserver) {
+		observer.OnRunCompleted(testContext, run)
+	})
+}
+
+// RunCorrected notifies the observers of the corrected outcome of a completed run.
+func (r *Registry) RunCorrected(run data.RunRecord) {
+	r.notify("run_corrected", func(observer RunObserver) {
+		observer.OnRunCorrected(run)
+	})
+}
+
+// notify delivers a notification to the synchronous observers and queues it
+// for every other observer without blocking.
+func (r *Registry) notify(hook string, call func(observer RunObserver)) {
+	r.mutex.Lock()
+	registrations := append([]*registration(nil), r.registrations...)
+	r.mutex.Unlock()
+
+	for _, registration := range registrations {
+		if registration.queue == nil {
+			r.deliver(registration, notification{hook: hook, call: call})
+		}
+	}
+	for _, registration := range registrations {
+		if registration.queue == nil {
+			continue
+		}
+		select {
+		case registration.queue <- notification{hook: hook, call: call}:
+		default:
+			r.droppedCounter.WithLabelValues(registration.name, hook).Inc()
+		}
+	}
+}
+
+// Start delivers the queued notifications until the context is cancelled.
+// It does not wait for an observer stuck in a hook to return.
+func (r *Registry) Start(ctx context.Context) error {
+	r.mutex.Lock()
+	registrations := append([]*registration(nil), r.registrations...)
+	r.mutex.Unlock()
+
+	for _, registration := range registrations {
+		if registration.queue == nil {
+			continue
+		}
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case notification := <-registration.queue:
+					r.deliver(registration, notification)
+				}
+			}
+		}()
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// NeedLeaderElection lets every replica notify the observers of the test
+// contexts it maintains.
+func (r *Registry) NeedLeaderElection() bool {
+	return false
+}
+
+// deliver calls the hook of an observer, recovering from a panic.
+func (r *Registry) deliver(registration *registration, notification notification) {
+	start := time.Now()
+	defer func() {
+		r.durationHist.WithLabelValues(registration.name, notification.hook).Observe(time.Since(start).Seconds())
+		if recovered := recover(); recovered != nil {
+			r.panicCounter.WithLabelValues(registration.name, notification.hook).Inc()
+			r.log.Error(fmt.Errorf("%v", recovered), "run observer panicked",
+				"observer", registration.name, "hook", notification.hook, "stack", string(debug.Stack()))
+		}
+	}()
+	notification.call(registration.observer)
+}
@@ -0,0 +1,30 @@
+package pools
+
+import (
+	"context"
+	"fmt"
+
+	v1 "github.com/openshift-splat-team/vsphere-capacity-manager/pkg/apis/vspherecapacitymanager.splat.io/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Namespace is the namespace in which the capacity manager keeps its pools and leases.
+const Namespace = "vsphere-infra-helpers"
+
+// Get returns the pool whose name or failure domain name matches name. Leases
+// refer to pools by their failure domain name, which may differ from the name
+// of the Pool resource.
+func Get(ctx context.Context, c client.Client, name string) (*v1.Pool, error) {
+	poolList := &v1.PoolList{}
+	if err := c.List(ctx, poolList, client.InNamespace(Namespace)); err != nil {
+		return nil, fmt.Errorf("error listing pools: %w", err)
+	}
+
+	for i := range poolList.Items {
+		pool := &poolList.Items[i]
+		if pool.Name == name || pool.Spec.Name == name {
+			return pool, nil
+		}
+	}
+	return nil, fmt.Errorf("pool %s not found", name)
+}
@@ -0,0 +1,407 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/openshift-splat-team/test-monitor/pkg/pools"
+	v1 "github.com/openshift-splat-team/vsphere-capacity-manager/pkg/apis/vspherecapacitymanager.splat.io/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	probesFilename = "probes.json"
+
+	// ProbeLabel marks the leases created by the prober.
+	ProbeLabel = "test-monitor.splat.io/probe"
+	// PoolAnnotation holds the name of the pool a probe lease is pinned to.
+	PoolAnnotation = "test-monitor.splat.io/probe-pool"
+
+	defaultInterval    = 30 * time.Minute
+	defaultTimeout     = 15 * time.Minute
+	defaultNetworkType = v1.NetworkTypeSingleTenant
+	defaultNetworks    = 1
+
+	pollInterval = 5 * time.Second
+	// releaseTimeout bounds the deletion of a probe lease after the probe.
+	releaseTimeout = time.Minute
+
+	// maxResults is the number of results kept per pool.
+	maxResults = 100
+)
+
+// Outcomes of a probe.
+const (
+	OutcomeSuccess = "success"
+	// OutcomeFailed means the lease could not be created or the capacity manager failed it.
+	OutcomeFailed = "failed"
+	// OutcomeTimeout means the lease was not fulfilled within the timeout.
+	OutcomeTimeout = "timeout"
+	// OutcomeInvalid means the lease was fulfilled without a complete topology or networks.
+	OutcomeInvalid = "invalid"
+)
+
+// Result is the outcome of probing a pool once.
+type Result struct {
+	// Pool is the failure domain name of the pool, as recorded on the runs.
+	Pool    string    `json:"pool"`
+	Lease   string    `json:"lease,omitempty"`
+	Started time.Time `json:"started"`
+	Outcome string    `json:"outcome"`
+	Reason  string    `json:"reason,omitempty"`
+	// FulfilledAfter is how long the capacity manager took to fulfill the lease.
+	FulfilledAfter *metav1.Duration `json:"fulfilled_after,omitempty"`
+	Server         string           `json:"server,omitempty"`
+	Networks       []string         `json:"networks,omitempty"`
+}
+
+// Success returns true if the pool fulfilled the lease with a complete topology.
+func (r *Result) Success() bool {
+	return r.Outcome == OutcomeSuccess
+}
+
+// Prober periodically creates small leases pinned to each pool and measures
+// how long the capacity manager takes to fulfill them.
+type Prober struct {
+	client.Client
+
+	// Interval is how often each pool is probed.
+	Interval time.Duration
+	// Timeout is how long a probe waits for its lease to be fulfilled.
+	Timeout time.Duration
+	// NetworkType is the network type requested by the probe leases.
+	NetworkType v1.NetworkType
+	// Networks is the number of networks requested by the probe leases.
+	Networks int
+	// Directory keeps the probe results across restarts. It defaults to the
+	// directory of the test context service.
+	Directory string
+
+	results map[string][]Result
+
+	successGauge   *prometheus.GaugeVec
+	lastRunGauge   *prometheus.GaugeVec
+	probesCounter  *prometheus.CounterVec
+	fulfilledHisto *prometheus.HistogramVec
+
+	mutex sync.Mutex
+
+	log logr.Logger
+}
+
+func (p *Prober) SetupWithManager(mgr ctrl.Manager) error {
+	p.Client = mgr.GetClient()
+	p.log = mgr.GetLogger().WithName("probe")
+	if p.Interval <= 0 {
+		p.Interval = defaultInterval
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = defaultTimeout
+	}
+	if len(p.NetworkType) == 0 {
+		p.NetworkType = defaultNetworkType
+	}
+	if p.Networks <= 0 {
+		p.Networks = defaultNetworks
+	}
+	if len(p.Directory) == 0 {
+		p.Directory = testcontext.DefaultDirectory
+	}
+
+	p.successGauge = monitor.PoolProbeSuccess.NewGaugeVec()
+	p.lastRunGauge = monitor.PoolProbeLastRun.NewGaugeVec()
+	p.probesCounter = monitor.PoolProbes.NewCounterVec()
+	p.fulfilledHisto = monitor.PoolProbeFulfilled.NewHistogramVec()
+	for metric, collector := range map[*monitor.Metric]prometheus.Collector{
+		&monitor.PoolProbeSuccess:   p.successGauge,
+		&monitor.PoolProbeLastRun:   p.lastRunGauge,
+		&monitor.PoolProbes:         p.probesCounter,
+		&monitor.PoolProbeFulfilled: p.fulfilledHisto,
+	} {
+		if err := metric.Register(collector); err != nil {
+			return fmt.Errorf("error registering probe metric: %w", err)
+		}
+	}
+
+	p.results = make(map[string][]Result)
+	if err := p.Restore(path.Join(p.Directory, probesFilename)); err != nil {
+		p.log.Error(err, "error restoring probe results")
+	}
+
+	if err := mgr.Add(p); err != nil {
+		return fmt.Errorf("error adding pool prober to manager: %w", err)
+	}
+	return nil
+}
+
+// SetupWithServer lists the probe results through the API.
+func (p *Prober) SetupWithServer(server *api.Server) {
+	server.Handle("GET /api/v1/probes", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := api.WriteJSON(w, http.StatusOK, p.Results(r.URL.Query().Get("pool"))); err != nil {
+			p.log.Error(err, "error encoding response")
+		}
+	}))
+}
+
+// Start probes the pools every interval until the context is cancelled.
+func (p *Prober) Start(ctx context.Context) error {
+	p.releaseStale(ctx)
+	wait.UntilWithContext(ctx, p.update, p.Interval)
+	return nil
+}
+
+// Results returns the results of a pool, or of all pools if pool is empty, most recent first.
+func (p *Prober) Results(pool string) []Result {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	results := []Result{}
+	for name, poolResults := range p.results {
+		if len(pool) == 0 || name == pool {
+			results = append(results, poolResults...)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Started.After(results[j].Started)
+	})
+	return results
+}
+
+// Canaries returns the number of successful probes of a pool started since
+// the given time after the most recent failed one, and the number of failed ones.
+func (p *Prober) Canaries(pool string, since time.Time) (int, int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	successes, failures := 0, 0
+	// results are kept in the order the probes started
+	for _, result := range p.results[pool] {
+		if result.Started.Before(since) {
+			continue
+		}
+		if result.Success() {
+			successes++
+		} else {
+			successes = 0
+			failures++
+		}
+	}
+	return successes, failures
+}
+
+func (p *Prober) update(ctx context.Context) {
+	poolList := &v1.PoolList{}
+	if err := p.List(ctx, poolList, client.InNamespace(pools.Namespace)); err != nil {
+		p.log.Error(err, "error listing pools")
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range poolList.Items {
+		pool := &poolList.Items[i]
+		name := poolName(pool)
+		if pool.Spec.NoSchedule {
+			// the capacity manager does not fulfill leases on pools excluded from scheduling
+			p.successGauge.DeleteLabelValues(name)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.record(p.probe(ctx, pool))
+		}()
+	}
+	wg.Wait()
+
+	if err := p.save(path.Join(p.Directory, probesFilename)); err != nil {
+		p.log.Error(err, "error saving probe results")
+	}
+}
+
+// poolName returns the failure domain name of a pool, which is what leases and runs refer to.
+func poolName(pool *v1.Pool) string {
+	if len(pool.Spec.Name) > 0 {
+		return pool.Spec.Name
+	}
+	return pool.Name
+}
+
+// probe creates a lease pinned to the pool, waits for it to be fulfilled and releases it.
+func (p *Prober) probe(ctx context.Context, pool *v1.Pool) Result {
+	result := Result{Pool: poolName(pool), Started: time.Now()}
+
+	lease := &v1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "test-monitor-probe-",
+			Namespace:    pools.Namespace,
+			Labels:       map[string]string{ProbeLabel: "true"},
+			Annotations:  map[string]string{PoolAnnotation: pool.Name},
+		},
+		Spec: v1.LeaseSpec{
+			VCpus:        1,
+			Memory:       1,
+			Networks:     p.Networks,
+			NetworkType:  p.NetworkType,
+			RequiredPool: pool.Name,
+		},
+	}
+	if err := p.Create(ctx, lease); err != nil {
+		result.Outcome, result.Reason = OutcomeFailed, fmt.Sprintf("error creating lease: %v", err)
+		return result
+	}
+	result.Lease = lease.Name
+	defer p.release(lease)
+
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, p.Timeout, true, func(ctx context.Context) (bool, error) {
+		if err := p.Get(ctx, client.ObjectKeyFromObject(lease), lease); err != nil {
+			p.log.Error(err, "error getting probe lease", "lease", lease.Name)
+			return false, nil
+		}
+		return lease.Status.Phase == v1.PHASE_FULFILLED || lease.Status.Phase == v1.PHASE_FAILED, nil
+	})
+	switch {
+	case err != nil:
+		result.Outcome, result.Reason = OutcomeTimeout, fmt.Sprintf("lease was still %q after %s", lease.Status.Phase, p.Timeout)
+		return result
+	case lease.Status.Phase == v1.PHASE_FAILED:
+		result.Outcome, result.Reason = OutcomeFailed, "lease failed"
+		return result
+	}
+
+	result.FulfilledAfter = &metav1.Duration{Duration: time.Since(result.Started)}
+	result.Server = lease.Status.Server
+	result.Networks = lease.Status.Topology.Networks
+	result.Outcome = OutcomeSuccess
+	if reason := verify(lease, p.Networks); len(reason) > 0 {
+		result.Outcome, result.Reason = OutcomeInvalid, reason
+	}
+	return result
+}
+
+// verify returns why the topology of a fulfilled lease is incomplete, or an empty string.
+func verify(lease *v1.Lease, networks int) string {
+	topology := lease.Status.Topology
+	switch {
+	case len(lease.Status.Server) == 0:
+		return "lease has no vCenter"
+	case len(topology.Datacenter) == 0:
+		return "lease has no datacenter"
+	case len(topology.ComputeCluster) == 0:
+		return "lease has no compute cluster"
+	case len(topology.Datastore) == 0:
+		return "lease has no datastore"
+	case len(topology.Networks) < networks:
+		return fmt.Sprintf("lease has %d of %d networks", len(topology.Networks), networks)
+	}
+	for _, network := range topology.Networks {
+		if len(network) == 0 {
+			return "lease has an empty network"
+		}
+	}
+	return ""
+}
+
+// release deletes a probe lease so the capacity manager frees its resources.
+func (p *Prober) release(lease *v1.Lease) {
+	// the probe context may already be cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if err := p.Delete(ctx, lease); err != nil && !apierrors.IsNotFound(err) {
+		p.log.Error(err, "error releasing probe lease", "lease", lease.Name)
+	}
+}
+
+// releaseStale deletes the probe leases left behind by a previous run of the prober.
+func (p *Prober) releaseStale(ctx context.Context) {
+	leaseList := &v1.LeaseList{}
+	if err := p.List(ctx, leaseList, client.InNamespace(pools.Namespace), client.HasLabels{ProbeLabel}); err != nil {
+		p.log.Error(err, "error listing stale probe leases")
+		return
+	}
+	for i := range leaseList.Items {
+		p.log.Info("releasing stale probe lease", "lease", leaseList.Items[i].Name)
+		p.release(&leaseList.Items[i])
+	}
+}
+
+// record keeps the result of a probe and exports it.
+func (p *Prober) record(result Result) {
+	p.log.Info("probed pool", "pool", result.Pool, "outcome", result.Outcome, "reason", result.Reason)
+
+	success := 0.0
+	if result.Success() {
+		success = 1
+	}
+	p.successGauge.WithLabelValues(result.Pool).Set(success)
+	p.lastRunGauge.WithLabelValues(result.Pool).Set(float64(result.Started.Unix()))
+	p.probesCounter.WithLabelValues(result.Pool, result.Outcome).Inc()
+	if result.FulfilledAfter != nil {
+		p.fulfilledHisto.WithLabelValues(result.Pool).Observe(result.FulfilledAfter.Seconds())
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	results := append(p.results[result.Pool], result)
+	if len(results) > maxResults {
+		results = results[len(results)-maxResults:]
+	}
+	p.results[result.Pool] = results
+}
+
+// save saves the probe results to a file
+func (p *Prober) save(filename string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(p.results); err != nil {
+		return fmt.Errorf("failed to encode probe results: %w", err)
+	}
+	return nil
+}
+
+// Restore restores the probe results from a file
+func (p *Prober) Restore(filename string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	file, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&p.results); err != nil {
+		return fmt.Errorf("failed to decode probe results: %w", err)
+	}
+
+	p.log.Info("Successfully restored probe results", "filename", filename, "pools", len(p.results))
+	return nil
+}
@@ -0,0 +1,307 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Protocols the metrics are pushed with.
+const (
+	ProtocolRemoteWrite = "remote-write"
+	ProtocolPushgateway = "pushgateway"
+)
+
+// Outcomes of a push.
+const (
+	outcomePushed  = "pushed"
+	outcomeSpooled = "spooled"
+	outcomeLost    = "lost"
+)
+
+const (
+	// DefaultJob is the job label of the pushed series.
+	DefaultJob = "test-monitor"
+
+	defaultInterval         = time.Minute
+	defaultMaxRetries       = 3
+	defaultFallbackMaxFiles = 100
+
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+
+	requestTimeout = 30 * time.Second
+
+	// fallbackPrefix and fallbackSuffix name the files of the fallback directory.
+	fallbackPrefix = "metrics-"
+	fallbackSuffix = ".om"
+)
+
+// Pusher pushes the metrics of the registry on an interval, for build
+// clusters without a Prometheus which can scrape the monitor. Pushes which
+// fail after all retries are written to the fallback directory in the
+// OpenMetrics format, from which they can be backfilled with promtool.
+type Pusher struct {
+	// URL is the remote-write endpoint, or the base URL of the Pushgateway.
+	URL string
+	// Protocol is either ProtocolRemoteWrite or ProtocolPushgateway.
+	Protocol string
+	// Headers are added to every request, e.g. for authorization.
+	Headers map[string]string
+	// Interval is how often the metrics are pushed.
+	Interval time.Duration
+	// Job and Instance label the pushed series, or group them on the Pushgateway.
+	// The instance defaults to the host name, so every replica pushes its own series.
+	Job      string
+	Instance string
+	// MaxRetries is how often a failed push is retried before it is written to the fallback directory.
+	MaxRetries int
+	// FallbackDir is the directory failed pushes are written to. Failed pushes are lost if empty.
+	FallbackDir string
+	// FallbackMaxFiles is the number of failed pushes kept in the fallback directory.
+	FallbackMaxFiles int
+	// Client is used to push the metrics. A default client is used if nil.
+	Client *http.Client
+	// Gatherer provides the pushed metrics. The controller-runtime registry is used if nil.
+	Gatherer prometheus.Gatherer
+
+	pushCounter *prometheus.CounterVec
+	// backoff is the wait before the first retry.
+	backoff time.Duration
+
+	log logr.Logger
+}
+
+// sender delivers the gathered metric families to the endpoint.
+type sender func(ctx context.Context, families []*dto.MetricFamily, now time.Time) error
+
+// permanentError marks a push error which a retry will not fix.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+func (p *Pusher) SetupWithManager(mgr ctrl.Manager) error {
+	p.log = mgr.GetLogger().WithName("push")
+	if err := p.init(); err != nil {
+		return err
+	}
+
+	p.pushCounter = monitor.MetricsPushes.NewCounterVec()
+	if err := monitor.MetricsPushes.Register(p.pushCounter); err != nil {
+		return fmt.Errorf("error registering metrics push metric: %w", err)
+	}
+
+	if err := mgr.Add(p); err != nil {
+		return fmt.Errorf("error adding metrics pusher to manager: %w", err)
+	}
+	return nil
+}
+
+// init validates the configuration and applies the defaults.
+func (p *Pusher) init() error {
+	if len(p.URL) == 0 {
+		return fmt.Errorf("a push URL is required")
+	}
+	if p.Protocol != ProtocolRemoteWrite && p.Protocol != ProtocolPushgateway {
+		return fmt.Errorf("unknown push protocol %q, must be %s or %s", p.Protocol, ProtocolRemoteWrite, ProtocolPushgateway)
+	}
+	if p.Interval <= 0 {
+		p.Interval = defaultInterval
+	}
+	if len(p.Job) == 0 {
+		p.Job = DefaultJob
+	}
+	if len(p.Instance) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("error getting the host name as instance: %w", err)
+		}
+		p.Instance = hostname
+	}
+	if p.MaxRetries <= 0 {
+		p.MaxRetries = defaultMaxRetries
+	}
+	if p.FallbackMaxFiles <= 0 {
+		p.FallbackMaxFiles = defaultFallbackMaxFiles
+	}
+	if p.backoff <= 0 {
+		p.backoff = initialBackoff
+	}
+	if p.Client == nil {
+		p.Client = &http.Client{Timeout: requestTimeout}
+	}
+	if p.Gatherer == nil {
+		p.Gatherer = metrics.Registry
+	}
+	if len(p.FallbackDir) > 0 {
+		if err := os.MkdirAll(p.FallbackDir, 0755); err != nil {
+			return fmt.Errorf("error creating fallback directory %s: %w", p.FallbackDir, err)
+		}
+	}
+	return nil
+}
+
+// Start pushes the metrics each interval until the context is cancelled.
+func (p *Pusher) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := p.Push(ctx); err != nil {
+			p.log.Error(err, "error pushing metrics", "url", p.URL)
+		}
+	}, p.Interval)
+	return nil
+}
+
+// NeedLeaderElection pushes the metrics of every replica, like every replica is scraped.
+func (p *Pusher) NeedLeaderElection() bool {
+	return false
+}
+
+// Push gathers the metrics and pushes them, retrying with exponential
+// back-off. If the push still fails, the metrics are written to the fallback
+// directory and the push error is returned.
+func (p *Pusher) Push(ctx context.Context) error {
+	families, err := p.Gatherer.Gather()
+	if err != nil {
+		// a partial result is still worth pushing
+		p.log.Error(err, "error gathering metrics")
+	}
+	now := time.Now()
+
+	var send sender = p.sendRemoteWrite
+	if p.Protocol == ProtocolPushgateway {
+		send = p.sendPushgateway
+	}
+	err = p.retry(ctx, func() error {
+		return send(ctx, families, now)
+	})
+	if err == nil {
+		p.count(outcomePushed)
+		return nil
+	}
+
+	if len(p.FallbackDir) == 0 {
+		p.count(outcomeLost)
+		return err
+	}
+	if spoolErr := p.spool(families, now); spoolErr != nil {
+		p.count(outcomeLost)
+		return errors.Join(err, spoolErr)
+	}
+	p.count(outcomeSpooled)
+	return fmt.Errorf("metrics written to %s: %w", p.FallbackDir, err)
+}
+
+// retry calls push until it succeeds, fails permanently or the retries are exhausted.
+func (p *Pusher) retry(ctx context.Context, push func() error) error {
+	backoff := p.backoff
+	for attempt := 0; ; attempt++ {
+		err := push()
+		if err == nil || errors.As(err, &permanentError{}) || attempt >= p.MaxRetries {
+			return err
+		}
+		p.log.V(1).Info("retrying metrics push", "attempt", attempt+1, "error", err.Error())
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+func (p *Pusher) count(outcome string) {
+	if p.pushCounter != nil {
+		p.pushCounter.WithLabelValues(p.Protocol, outcome).Inc()
+	}
+}
+
+// do sends a request with the configured headers and returns an error unless it succeeded.
+func (p *Pusher) do(req *http.Request) error {
+	for name, value := range p.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error pushing metrics to %s: %w", req.URL.Redacted(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s responded with %s: %s", req.URL.Redacted(), resp.Status, strings.TrimSpace(string(message)))
+	// client errors other than throttling will fail again
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout {
+		return permanentError{err}
+	}
+	return err
+}
+
+// spool writes the metrics with their timestamp to a new file of the
+// fallback directory and removes the oldest files beyond the limit.
+func (p *Pusher) spool(families []*dto.MetricFamily, now time.Time) error {
+	filename := filepath.Join(p.FallbackDir, fallbackPrefix+now.UTC().Format("20060102T150405.000")+fallbackSuffix)
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", filename, err)
+	}
+
+	timestamp := now.UnixMilli()
+	encoder := expfmt.NewEncoder(file, expfmt.NewFormat(expfmt.TypeOpenMetrics))
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			metric.TimestampMs = &timestamp
+		}
+		if err := encoder.Encode(family); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write file %s: %w", filename, err)
+		}
+	}
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write file %s: %w", filename, err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", filename, err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(p.FallbackDir, fallbackPrefix+"*"+fallbackSuffix))
+	if err != nil {
+		return fmt.Errorf("failed to list files of %s: %w", p.FallbackDir, err)
+	}
+	// the time in the file names sorts chronologically
+	sort.Strings(matches)
+	for len(matches) > p.FallbackMaxFiles {
+		if err := os.Remove(matches[0]); err != nil {
+			return fmt.Errorf("failed to remove file %s: %w", matches[0], err)
+		}
+		matches = matches[1:]
+	}
+	return nil
+}
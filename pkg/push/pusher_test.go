@@ -0,0 +1,263 @@
+package push
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/openshift-splat-team/test-monitor/pkg/push/prompb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// request is a request received by the receiver.
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// receiver records the pushed requests and responds with status to the
+// first failures of them.
+type receiver struct {
+	failures int
+	status   int
+
+	requests []request
+	mutex    sync.Mutex
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, request{method: req.Method, path: req.URL.EscapedPath(), header: req.Header.Clone(), body: body})
+	if len(r.requests) <= r.failures {
+		http.Error(w, http.StatusText(r.status), r.status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *receiver) received() []request {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]request(nil), r.requests...)
+}
+
+// newPusher returns a pusher of the test metrics to a local receiver.
+func newPusher(t *testing.T, protocol string, receiver *receiver) *Pusher {
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	registry := prometheus.NewRegistry()
+	runs := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "prow_ci_test_runs", Help: "Runs."}, []string{"pool", "test_name"})
+	runs.WithLabelValues("vcenter-1", "e2e-vsphere-ovn").Add(3)
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "prow_ci_test_duration_seconds", Help: "Duration.", Buckets: []float64{60, 600}})
+	duration.Observe(30)
+	duration.Observe(300)
+	duration.Observe(3000)
+	registry.MustRegister(runs, duration)
+
+	pusher := &Pusher{
+		URL:      server.URL,
+		Protocol: protocol,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		Job:      "test-monitor",
+		Instance: "test-monitor-0",
+		Gatherer: registry,
+		backoff:  time.Millisecond,
+		log:      logr.Discard(),
+	}
+	if err := pusher.init(); err != nil {
+		t.Fatalf("error initializing pusher: %v", err)
+	}
+	return pusher
+}
+
+func TestRemoteWrite(t *testing.T) {
+	receiver := &receiver{}
+	pusher := newPusher(t, ProtocolRemoteWrite, receiver)
+	start := time.Now()
+	if err := pusher.Push(context.Background()); err != nil {
+		t.Fatalf("error pushing metrics: %v", err)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	req := requests[0]
+	for name, value := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"Authorization":                     "Bearer token",
+	} {
+		if req.header.Get(name) != value {
+			t.Errorf("expected header %s %q, got %q", name, value, req.header.Get(name))
+		}
+	}
+
+	decoded, err := snappy.Decode(nil, req.body)
+	if err != nil {
+		t.Fatalf("error decoding snappy block: %v", err)
+	}
+	var writeRequest prompb.WriteRequest
+	if err := proto.Unmarshal(decoded, &writeRequest); err != nil {
+		t.Fatalf("error decoding write request: %v", err)
+	}
+
+	series := map[string]float64{}
+	for _, timeSeries := range writeRequest.Timeseries {
+		if !sort.SliceIsSorted(timeSeries.Labels, func(i, j int) bool {
+			return timeSeries.Labels[i].Name < timeSeries.Labels[j].Name
+		}) {
+			t.Errorf("expected the labels to be sorted by name, got %v", timeSeries.Labels)
+		}
+		if len(timeSeries.Samples) != 1 {
+			t.Fatalf("expected 1 sample per series, got %v", timeSeries.Samples)
+		}
+		sample := timeSeries.Samples[0]
+		if sample.Timestamp < start.UnixMilli() || sample.Timestamp > time.Now().UnixMilli() {
+			t.Errorf("expected the sample to be taken at the push, got timestamp %d", sample.Timestamp)
+		}
+
+		var pairs []string
+		for _, label := range timeSeries.Labels {
+			pairs = append(pairs, label.Name+"="+label.Value)
+		}
+		series[strings.Join(pairs, ",")] = sample.Value
+	}
+
+	common := "instance=test-monitor-0,job=test-monitor"
+	expected := map[string]float64{
+		"__name__=prow_ci_test_runs," + common + ",pool=vcenter-1,test_name=e2e-vsphere-ovn": 3,
+		"__name__=prow_ci_test_duration_seconds_bucket," + common + ",le=60":                 1,
+		"__name__=prow_ci_test_duration_seconds_bucket," + common + ",le=600":                2,
+		"__name__=prow_ci_test_duration_seconds_bucket," + common + ",le=+Inf":               3,
+		"__name__=prow_ci_test_duration_seconds_sum," + common:                               3330,
+		"__name__=prow_ci_test_duration_seconds_count," + common:                             3,
+	}
+	if len(series) != len(expected) {
+		t.Errorf("expected %d series, got %v", len(expected), series)
+	}
+	for name, value := range expected {
+		if got, exists := series[name]; !exists || math.Abs(got-value) > 1e-9 {
+			t.Errorf("expected series %s with value %v, got %v", name, value, series)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		failures int
+		status   int
+		requests int
+		failed   bool
+	}{
+		{name: "pushed", requests: 1},
+		{name: "retried until pushed", failures: 2, status: http.StatusServiceUnavailable, requests: 3},
+		{name: "retried when throttled", failures: 1, status: http.StatusTooManyRequests, requests: 2},
+		{name: "retries exhausted", failures: 10, status: http.StatusServiceUnavailable, requests: 4, failed: true},
+		{name: "rejected", failures: 10, status: http.StatusBadRequest, requests: 1, failed: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			receiver := &receiver{failures: test.failures, status: test.status}
+			pusher := newPusher(t, ProtocolRemoteWrite, receiver)
+			err := pusher.Push(context.Background())
+			if (err != nil) != test.failed {
+				t.Errorf("expected failed %t, got error %v", test.failed, err)
+			}
+			if requests := len(receiver.received()); requests != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, requests)
+			}
+		})
+	}
+}
+
+func TestFallback(t *testing.T) {
+	receiver := &receiver{failures: 100, status: http.StatusBadRequest}
+	pusher := newPusher(t, ProtocolRemoteWrite, receiver)
+	pusher.FallbackDir = t.TempDir()
+	pusher.FallbackMaxFiles = 2
+
+	for i := 0; i < 3; i++ {
+		if err := pusher.Push(context.Background()); err == nil || !strings.Contains(err.Error(), pusher.FallbackDir) {
+			t.Fatalf("expected the failed push to be written to the fallback directory, got %v", err)
+		}
+		// the file names hold the time in milliseconds
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(pusher.FallbackDir, fallbackPrefix+"*"+fallbackSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != pusher.FallbackMaxFiles {
+		t.Fatalf("expected %d files in the fallback directory, got %v", pusher.FallbackMaxFiles, matches)
+	}
+	for _, filename := range matches {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), `prow_ci_test_runs{pool="vcenter-1",test_name="e2e-vsphere-ovn"} 3.0 `) {
+			t.Errorf("expected the counter with its timestamp in %s, got %s", filename, content)
+		}
+		if !strings.HasSuffix(string(content), "# EOF\n") {
+			t.Errorf("expected %s to end like an OpenMetrics exposition, got %s", filename, content)
+		}
+	}
+}
+
+func TestPushgateway(t *testing.T) {
+	receiver := &receiver{}
+	pusher := newPusher(t, ProtocolPushgateway, receiver)
+	pusher.Instance = "build01/test-monitor-0"
+	if err := pusher.Push(context.Background()); err != nil {
+		t.Fatalf("error pushing metrics: %v", err)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	req := requests[0]
+	path := "/metrics/job/test-monitor/instance@base64/" + base64.RawURLEncoding.EncodeToString([]byte(pusher.Instance))
+	if req.method != http.MethodPut || req.path != path {
+		t.Errorf("expected PUT %s, got %s %s", path, req.method, req.path)
+	}
+	if req.header.Get("Authorization") != "Bearer token" {
+		t.Errorf("expected the configured headers, got %v", req.header)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(string(req.body)))
+	if err != nil {
+		t.Fatalf("error parsing pushed metrics: %v", err)
+	}
+	runs, exists := families["prow_ci_test_runs"]
+	if !exists || len(runs.GetMetric()) != 1 || runs.GetMetric()[0].GetCounter().GetValue() != 3 {
+		t.Errorf("expected the run counter to be pushed, got %v", runs)
+	}
+	if duration, exists := families["prow_ci_test_duration_seconds"]; !exists || duration.GetMetric()[0].GetHistogram().GetSampleCount() != 3 {
+		t.Errorf("expected the duration histogram to be pushed, got %v", duration)
+	}
+}
@@ -0,0 +1,46 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// sendPushgateway replaces the metrics of the job and instance group on the
+// Pushgateway, so series which disappeared from the monitor disappear there too.
+func (p *Pusher) sendPushgateway(ctx context.Context, families []*dto.MetricFamily, now time.Time) error {
+	format := expfmt.NewFormat(expfmt.TypeTextPlain)
+	var body bytes.Buffer
+	encoder := expfmt.NewEncoder(&body, format)
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			return permanentError{fmt.Errorf("error encoding metrics: %w", err)}
+		}
+	}
+
+	groupURL := strings.TrimSuffix(p.URL, "/") + "/metrics/" + groupingPath("job", p.Job) + "/" + groupingPath("instance", p.Instance)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, groupURL, &body)
+	if err != nil {
+		return permanentError{fmt.Errorf("error creating request: %w", err)}
+	}
+	req.Header.Set("Content-Type", string(format))
+	req.Header.Set("User-Agent", userAgent)
+	return p.do(req)
+}
+
+// groupingPath returns the path segments of a grouping label, base64 encoded
+// if the value cannot be a path segment.
+func groupingPath(name, value string) string {
+	if len(value) == 0 || strings.Contains(value, "/") {
+		return name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return name + "/" + url.PathEscape(value)
+}
@@ -0,0 +1,112 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/openshift-splat-team/test-monitor/pkg/push/prompb"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	remoteWriteVersion = "0.1.0"
+	userAgent          = "test-monitor"
+)
+
+// sendRemoteWrite posts the metrics as a remote-write 1.0 request, with a
+// sample of every series at the time of the push.
+func (p *Pusher) sendRemoteWrite(ctx context.Context, families []*dto.MetricFamily, now time.Time) error {
+	request, err := proto.Marshal(p.writeRequest(families, now))
+	if err != nil {
+		return permanentError{fmt.Errorf("error encoding write request: %w", err)}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(snappy.Encode(nil, request)))
+	if err != nil {
+		return permanentError{fmt.Errorf("error creating request: %w", err)}
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	return p.do(req)
+}
+
+// writeRequest converts the metrics to a write request. Histograms and
+// summaries are written as their _bucket, _sum and _count series, or
+// quantiles, like they are scraped.
+func (p *Pusher) writeRequest(families []*dto.MetricFamily, now time.Time) *prompb.WriteRequest {
+	timestamp := now.UnixMilli()
+	request := &prompb.WriteRequest{}
+	appendSeries := func(name string, metric *dto.Metric, value float64, extra ...*prompb.Label) {
+		labels := []*prompb.Label{
+			{Name: "__name__", Value: name},
+			{Name: "job", Value: p.Job},
+			{Name: "instance", Value: p.Instance},
+		}
+		for _, pair := range metric.GetLabel() {
+			labels = append(labels, &prompb.Label{Name: pair.GetName(), Value: pair.GetValue()})
+		}
+		labels = append(labels, extra...)
+		// the labels of a series must be sorted by name
+		sort.Slice(labels, func(i, j int) bool {
+			return labels[i].Name < labels[j].Name
+		})
+		request.Timeseries = append(request.Timeseries, &prompb.TimeSeries{
+			Labels:  labels,
+			Samples: []*prompb.Sample{{Value: value, Timestamp: timestamp}},
+		})
+	}
+
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				appendSeries(name, metric, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				appendSeries(name, metric, metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				appendSeries(name, metric, metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				infinite := false
+				for _, bucket := range histogram.GetBucket() {
+					infinite = infinite || math.IsInf(bucket.GetUpperBound(), 1)
+					appendSeries(name+"_bucket", metric, float64(bucket.GetCumulativeCount()), &prompb.Label{Name: "le", Value: formatFloat(bucket.GetUpperBound())})
+				}
+				if !infinite {
+					appendSeries(name+"_bucket", metric, float64(histogram.GetSampleCount()), &prompb.Label{Name: "le", Value: "+Inf"})
+				}
+				appendSeries(name+"_sum", metric, histogram.GetSampleSum())
+				appendSeries(name+"_count", metric, float64(histogram.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					appendSeries(name, metric, quantile.GetValue(), &prompb.Label{Name: "quantile", Value: formatFloat(quantile.GetQuantile())})
+				}
+				appendSeries(name+"_sum", metric, summary.GetSampleSum())
+				appendSeries(name+"_count", metric, float64(summary.GetSampleCount()))
+			}
+		}
+	}
+	return request
+}
+
+// formatFloat formats le and quantile label values like the Prometheus text format.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
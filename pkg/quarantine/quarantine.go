@@ -0,0 +1,102 @@
+package quarantine
+
+import (
+	"sort"
+	"time"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+)
+
+// Modes of the quarantiner.
+const (
+	// ModeOff disables the quarantiner.
+	ModeOff = "off"
+	// ModeRecommend only annotates unhealthy pools and records Events.
+	ModeRecommend = "recommend"
+	// ModeEnforce additionally sets NoSchedule on unhealthy pools.
+	ModeEnforce = "enforce"
+)
+
+// States of a pool tracked by the quarantiner.
+const (
+	StateRecommended = "recommended"
+	StateQuarantined = "quarantined"
+	// StateProbation means the pool only accepts leases pinned to it, such as canaries.
+	StateProbation = "probation"
+)
+
+// Actions recorded in the audit trail.
+const (
+	ActionRecommend  = "recommend"
+	ActionClear      = "clear"
+	ActionQuarantine = "quarantine"
+	ActionProbation  = "probation"
+	ActionRelease    = "release"
+	// ActionReleasedManually is recorded when NoSchedule was cleared by someone else.
+	ActionReleasedManually = "released-manually"
+)
+
+// Annotations set on the Pool resource.
+const (
+	RecommendedAnnotation = "test-monitor.splat.io/quarantine-recommended"
+	QuarantinedAnnotation = "test-monitor.splat.io/quarantined-at"
+	ProbationAnnotation   = "test-monitor.splat.io/probation-at"
+)
+
+// Quarantine is a pool the quarantiner recommended or enforced a quarantine for.
+type Quarantine struct {
+	Pool  string `json:"pool"`
+	State string `json:"state"`
+	// Reason explains why the pool is considered unhealthy.
+	Reason          string     `json:"reason"`
+	Score           float64    `json:"score"`
+	RecommendedAt   time.Time  `json:"recommended_at"`
+	QuarantinedAt   *time.Time `json:"quarantined_at,omitempty"`
+	ProbationAt     *time.Time `json:"probation_at,omitempty"`
+	CanarySuccesses int        `json:"canary_successes"`
+	// Excluded is whether the pool was excluded from unpinned leases before
+	// its probation, which is restored when it is released.
+	Excluded bool `json:"excluded"`
+}
+
+// AuditEntry records an action taken, or which would have been taken in dry-run mode.
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Pool   string    `json:"pool"`
+	Action string    `json:"action"`
+	DryRun bool      `json:"dry_run"`
+	Reason string    `json:"reason"`
+	Score  float64   `json:"score"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// CanarySource counts the canaries run on a pool.
+type CanarySource interface {
+	// Canaries returns the number of successful canaries on the pool since
+	// the given time after the most recent failed one, and the number of
+	// failed canaries since the given time.
+	Canaries(pool string, since time.Time) (int, int)
+}
+
+// RunCanaries treats runs which completed on a pool as its canaries. While a
+// pool is on probation only runs which explicitly require it land on it.
+type RunCanaries struct {
+	Runs func(pool string, since time.Time) []data.RunRecord
+}
+
+func (r *RunCanaries) Canaries(pool string, since time.Time) (int, int) {
+	runs := r.Runs(pool, since)
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Completed.Before(runs[j].Completed)
+	})
+	successes, failures := 0, 0
+	for _, run := range runs {
+		if run.Failed {
+			successes = 0
+			failures++
+			continue
+		}
+		successes++
+	}
+	return successes, failures
+}
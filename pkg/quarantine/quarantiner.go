@@ -0,0 +1,627 @@
+package quarantine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/health"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/pools"
+	v1 "github.com/openshift-splat-team/vsphere-capacity-manager/pkg/apis/vspherecapacitymanager.splat.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	quarantinesFilename = "quarantines.json"
+	auditFilename       = "quarantine_audit.jsonl"
+
+	defaultInterval  = 5 * time.Minute
+	defaultWindow    = 72 * time.Hour
+	defaultThreshold = 3
+	defaultMinRuns   = 10
+	defaultCoolDown  = 6 * time.Hour
+	defaultCanaries  = 3
+
+	// auditRetention is how long audit entries are kept.
+	auditRetention = 90 * 24 * time.Hour
+)
+
+// quarantineState is what is persisted across restarts.
+type quarantineState struct {
+	Quarantines map[string]*Quarantine `json:"quarantines"`
+	// Released holds when pools were last released so that the runs which
+	// led to their quarantine do not immediately quarantine them again.
+	Released map[string]time.Time `json:"released"`
+}
+
+// copy returns a copy of the state which can be changed without the lock.
+func (s *quarantineState) copy() quarantineState {
+	copied := quarantineState{
+		Quarantines: make(map[string]*Quarantine, len(s.Quarantines)),
+		Released:    make(map[string]time.Time, len(s.Released)),
+	}
+	for name, quarantine := range s.Quarantines {
+		quarantine := *quarantine
+		copied.Quarantines[name] = &quarantine
+	}
+	for name, released := range s.Released {
+		copied.Released[name] = released
+	}
+	return copied
+}
+
+// Quarantiner recommends quarantining pools whose health score stays above a
+// threshold and, in enforce mode, sets NoSchedule on them. Quarantined pools
+// are put on probation after a cool-down and released once enough canaries
+// succeeded on them.
+type Quarantiner struct {
+	client.Client
+	Recorder record.EventRecorder
+
+	// Mode is either ModeRecommend or ModeEnforce.
+	Mode string
+	// DryRun records the actions in the audit trail without changing or
+	// recording Events on the pools.
+	DryRun bool
+	// Interval is how often pools are evaluated.
+	Interval time.Duration
+	// Window is how far back completed runs are scored.
+	Window time.Duration
+	// Threshold is the pool health score from which a pool is unhealthy.
+	Threshold float64
+	// MinRuns is the number of runs a pool needs within the window to be judged.
+	MinRuns int
+	// CoolDown is how long a pool stays quarantined before it is put on probation.
+	CoolDown time.Duration
+	// Canaries is the number of consecutive successful canaries which release a pool on probation.
+	Canaries int
+	// CanarySource counts the successful canaries. Runs completed on the pool are used if nil.
+	CanarySource CanarySource
+
+	state quarantineState
+	audit []AuditEntry
+	// actions are the audit entries of the running evaluation.
+	actions []AuditEntry
+	// directory is where the quarantines and the audit trail are saved.
+	directory string
+	// queryRuns returns the completed runs the pools are scored by.
+	queryRuns func(filter ledger.Filter) []data.RunRecord
+
+	mutex sync.Mutex
+
+	log logr.Logger
+}
+
+func (q *Quarantiner) SetupWithManager(mgr ctrl.Manager,
+	testContext *testcontext.TestContextService) error {
+	q.Client = mgr.GetClient()
+	q.Recorder = mgr.GetEventRecorderFor("pool-quarantiner")
+	q.log = mgr.GetLogger().WithName("quarantine")
+	if err := q.init(testContext.Directory, testContext.QueryRuns); err != nil {
+		return err
+	}
+
+	if err := mgr.Add(q); err != nil {
+		return fmt.Errorf("error adding pool quarantiner to manager: %w", err)
+	}
+	return nil
+}
+
+// init applies the defaults, scores the pools by the runs returned by
+// queryRuns and restores the quarantines and the audit trail from directory.
+func (q *Quarantiner) init(directory string, queryRuns func(filter ledger.Filter) []data.RunRecord) error {
+	if q.Mode != ModeRecommend && q.Mode != ModeEnforce {
+		return fmt.Errorf("invalid quarantine mode %q, must be %s or %s", q.Mode, ModeRecommend, ModeEnforce)
+	}
+	if q.Interval <= 0 {
+		q.Interval = defaultInterval
+	}
+	if q.Window <= 0 {
+		q.Window = defaultWindow
+	}
+	if q.Threshold <= 0 {
+		q.Threshold = defaultThreshold
+	}
+	if q.MinRuns <= 0 {
+		q.MinRuns = defaultMinRuns
+	}
+	if q.CoolDown <= 0 {
+		q.CoolDown = defaultCoolDown
+	}
+	if q.Canaries <= 0 {
+		q.Canaries = defaultCanaries
+	}
+	if q.CanarySource == nil {
+		q.CanarySource = &RunCanaries{Runs: func(pool string, since time.Time) []data.RunRecord {
+			return queryRuns(ledger.Filter{Pool: pool, Since: since})
+		}}
+	}
+
+	q.state = quarantineState{
+		Quarantines: make(map[string]*Quarantine),
+		Released:    make(map[string]time.Time),
+	}
+	q.queryRuns = queryRuns
+	q.directory = directory
+	if err := q.Restore(path.Join(q.directory, quarantinesFilename)); err != nil {
+		q.log.Error(err, "error restoring quarantines")
+	}
+	if err := q.restoreAudit(path.Join(q.directory, auditFilename)); err != nil {
+		q.log.Error(err, "error restoring quarantine audit trail")
+	}
+	return nil
+}
+
+// SetupWithServer lists quarantines and the audit trail through the API.
+func (q *Quarantiner) SetupWithServer(server *api.Server) {
+	server.Handle("GET /api/v1/quarantines", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := api.WriteJSON(w, http.StatusOK, q.Quarantines()); err != nil {
+			q.log.Error(err, "error encoding response")
+		}
+	}))
+	server.Handle("GET /api/v1/quarantines/audit", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := api.WriteJSON(w, http.StatusOK, q.Audit()); err != nil {
+			q.log.Error(err, "error encoding response")
+		}
+	}))
+}
+
+// Start evaluates the pools every interval until the context is cancelled.
+func (q *Quarantiner) Start(ctx context.Context) error {
+	q.log.Info("starting pool quarantiner", "mode", q.Mode, "dryRun", q.DryRun)
+	wait.UntilWithContext(ctx, q.update, q.Interval)
+	return nil
+}
+
+// Quarantines returns the pools with a recommended or enforced quarantine, sorted by pool.
+func (q *Quarantiner) Quarantines() []Quarantine {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	quarantines := make([]Quarantine, 0, len(q.state.Quarantines))
+	for _, quarantine := range q.state.Quarantines {
+		quarantines = append(quarantines, *quarantine)
+	}
+	sort.Slice(quarantines, func(i, j int) bool {
+		return quarantines[i].Pool < quarantines[j].Pool
+	})
+	return quarantines
+}
+
+// Audit returns the audit trail, most recent first.
+func (q *Quarantiner) Audit() []AuditEntry {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	audit := make([]AuditEntry, 0, len(q.audit))
+	for i := len(q.audit) - 1; i >= 0; i-- {
+		audit = append(audit, q.audit[i])
+	}
+	return audit
+}
+
+// update evaluates the pools on a copy of the state, which replaces the
+// state once all actions were applied. The lock is not held while the pools
+// are changed, so the API is not blocked by a slow API server.
+func (q *Quarantiner) update(ctx context.Context) {
+	now := time.Now()
+	q.mutex.Lock()
+	state := q.state.copy()
+	q.mutex.Unlock()
+
+	scores, err := q.score(state.Released, now)
+	if err != nil {
+		q.log.Error(err, "error scoring pools")
+		return
+	}
+
+	unhealthy := make(map[string]health.Score)
+	for _, score := range scores {
+		if score.Runs >= q.MinRuns && score.ZScore >= q.Threshold {
+			unhealthy[score.Name] = score
+		}
+	}
+
+	for name, score := range unhealthy {
+		quarantine, exists := state.Quarantines[name]
+		if !exists {
+			quarantine = &Quarantine{
+				Pool:          name,
+				State:         StateRecommended,
+				RecommendedAt: now,
+			}
+			quarantine.Score, quarantine.Reason = score.ZScore, reason(score)
+			if !q.recommend(ctx, quarantine, now) {
+				continue
+			}
+			state.Quarantines[name] = quarantine
+		}
+		if quarantine.State == StateRecommended {
+			quarantine.Score, quarantine.Reason = score.ZScore, reason(score)
+			if q.Mode == ModeEnforce {
+				q.quarantine(ctx, quarantine, now)
+			}
+		}
+	}
+
+	for name, quarantine := range state.Quarantines {
+		switch quarantine.State {
+		case StateRecommended:
+			if _, exists := unhealthy[name]; !exists && q.clear(ctx, quarantine, now) {
+				delete(state.Quarantines, name)
+			}
+		case StateQuarantined:
+			if q.probation(ctx, quarantine, now) {
+				delete(state.Quarantines, name)
+				state.Released[name] = now
+			}
+		case StateProbation:
+			if q.release(ctx, quarantine, now) {
+				delete(state.Quarantines, name)
+				state.Released[name] = now
+			}
+		}
+	}
+
+	for name, released := range state.Released {
+		if now.Sub(released) > q.Window {
+			delete(state.Released, name)
+		}
+	}
+
+	actions := q.actions
+	q.actions = nil
+	q.mutex.Lock()
+	q.state = state
+	q.audit = append(q.audit, actions...)
+	q.mutex.Unlock()
+
+	if err := writeAudit(path.Join(q.directory, auditFilename), actions); err != nil {
+		q.log.Error(err, "error writing quarantine audit trail")
+	}
+	if err := q.save(path.Join(q.directory, quarantinesFilename)); err != nil {
+		q.log.Error(err, "error saving quarantines")
+	}
+}
+
+// score scores the pools over the window, ignoring the runs a pool completed
+// before it was last released.
+func (q *Quarantiner) score(released map[string]time.Time, now time.Time) ([]health.Score, error) {
+	runs := q.queryRuns(ledger.Filter{Since: now.Add(-q.Window)})
+	filtered := runs[:0]
+	for _, run := range runs {
+		if at, exists := released[run.Pool]; exists && run.Completed.Before(at) {
+			continue
+		}
+		filtered = append(filtered, run)
+	}
+	return health.ScoreRuns(filtered, ledger.DimensionPool)
+}
+
+func reason(score health.Score) string {
+	return fmt.Sprintf("health score %.1f: %d of %d runs failed (%.0f%%) while %.0f%% were expected",
+		score.ZScore, score.Failures, score.Runs, 100*score.FailureRate, 100*score.ExpectedFailureRate)
+}
+
+// recommend annotates the pool with the recommendation to quarantine it.
+func (q *Quarantiner) recommend(ctx context.Context, quarantine *Quarantine, now time.Time) bool {
+	return q.act(ctx, quarantine, ActionRecommend, now, func(pool *v1.Pool) (string, string) {
+		setAnnotation(pool, RecommendedAnnotation, quarantine.Reason)
+		return corev1.EventTypeWarning, "QuarantineRecommended"
+	})
+}
+
+// clear removes the recommendation from a pool which became healthy again.
+func (q *Quarantiner) clear(ctx context.Context, quarantine *Quarantine, now time.Time) bool {
+	quarantine.Reason = "health score dropped below the threshold"
+	return q.act(ctx, quarantine, ActionClear, now, func(pool *v1.Pool) (string, string) {
+		delete(pool.Annotations, RecommendedAnnotation)
+		return corev1.EventTypeNormal, "QuarantineRecommendationCleared"
+	})
+}
+
+// quarantine sets NoSchedule on the pool, either because it became unhealthy,
+// unless someone else already excluded it from scheduling, or because a canary
+// failed during its probation.
+func (q *Quarantiner) quarantine(ctx context.Context, quarantine *Quarantine, now time.Time) {
+	onProbation := quarantine.State == StateProbation
+	if !q.DryRun && !onProbation {
+		pool, err := pools.Get(ctx, q.Client, quarantine.Pool)
+		if err != nil {
+			q.log.Error(err, "unable to get pool", "pool", quarantine.Pool)
+			return
+		}
+		if pool.Spec.NoSchedule {
+			// the pool was taken out of scheduling by someone else, who owns releasing it
+			q.log.V(1).Info("pool is already excluded from scheduling", "pool", quarantine.Pool)
+			return
+		}
+	}
+
+	if q.act(ctx, quarantine, ActionQuarantine, now, func(pool *v1.Pool) (string, string) {
+		pool.Spec.NoSchedule = true
+		if onProbation {
+			pool.Spec.Exclude = quarantine.Excluded
+		}
+		delete(pool.Annotations, ProbationAnnotation)
+		setAnnotation(pool, QuarantinedAnnotation, now.UTC().Format(time.RFC3339))
+		return corev1.EventTypeWarning, "Quarantined"
+	}) {
+		quarantinedAt := now
+		quarantine.State = StateQuarantined
+		quarantine.QuarantinedAt = &quarantinedAt
+		quarantine.ProbationAt = nil
+		quarantine.CanarySuccesses = 0
+	}
+}
+
+// probation puts a quarantined pool on probation once the cool-down passed.
+// The capacity manager does not fulfill any lease on a pool with NoSchedule,
+// so the pool is excluded instead, which only admits leases pinned to it such
+// as canaries. It returns true if the pool was released by someone else.
+func (q *Quarantiner) probation(ctx context.Context, quarantine *Quarantine, now time.Time) bool {
+	if !q.DryRun {
+		pool, err := pools.Get(ctx, q.Client, quarantine.Pool)
+		if err != nil {
+			q.log.Error(err, "unable to get pool", "pool", quarantine.Pool)
+			return false
+		}
+		if !pool.Spec.NoSchedule {
+			return q.releasedManually(ctx, quarantine, now, "NoSchedule was cleared by someone else")
+		}
+	}
+
+	if now.Sub(*quarantine.QuarantinedAt) < q.CoolDown {
+		return false
+	}
+	quarantine.Reason = fmt.Sprintf("cool-down of %s passed, admitting canaries", q.CoolDown)
+	if q.act(ctx, quarantine, ActionProbation, now, func(pool *v1.Pool) (string, string) {
+		quarantine.Excluded = pool.Spec.Exclude
+		pool.Spec.NoSchedule = false
+		pool.Spec.Exclude = true
+		setAnnotation(pool, ProbationAnnotation, now.UTC().Format(time.RFC3339))
+		return corev1.EventTypeNormal, "QuarantineProbation"
+	}) {
+		probationAt := now
+		quarantine.State = StateProbation
+		quarantine.ProbationAt = &probationAt
+		quarantine.CanarySuccesses = 0
+	}
+	return false
+}
+
+// release releases a pool on probation once enough consecutive canaries
+// succeeded, or quarantines it again if a canary failed. It returns true if
+// the pool is no longer quarantined.
+func (q *Quarantiner) release(ctx context.Context, quarantine *Quarantine, now time.Time) bool {
+	if !q.DryRun {
+		pool, err := pools.Get(ctx, q.Client, quarantine.Pool)
+		if err != nil {
+			q.log.Error(err, "unable to get pool", "pool", quarantine.Pool)
+			return false
+		}
+		if !pool.Spec.Exclude {
+			return q.releasedManually(ctx, quarantine, now, "Exclude was cleared by someone else")
+		}
+	}
+
+	successes, failures := q.CanarySource.Canaries(quarantine.Pool, *quarantine.ProbationAt)
+	quarantine.CanarySuccesses = successes
+	if failures > 0 {
+		quarantine.Reason = fmt.Sprintf("%d canaries failed during probation", failures)
+		q.quarantine(ctx, quarantine, now)
+		return false
+	}
+	if successes < q.Canaries {
+		return false
+	}
+
+	quarantine.Reason = fmt.Sprintf("%d consecutive canaries succeeded during probation", successes)
+	return q.act(ctx, quarantine, ActionRelease, now, func(pool *v1.Pool) (string, string) {
+		pool.Spec.Exclude = quarantine.Excluded
+		deleteAnnotations(pool)
+		return corev1.EventTypeNormal, "QuarantineReleased"
+	})
+}
+
+// releasedManually forgets the quarantine of a pool someone else released.
+func (q *Quarantiner) releasedManually(ctx context.Context, quarantine *Quarantine, now time.Time, reason string) bool {
+	quarantine.Reason = reason
+	return q.act(ctx, quarantine, ActionReleasedManually, now, func(pool *v1.Pool) (string, string) {
+		deleteAnnotations(pool)
+		return "", ""
+	})
+}
+
+// act applies a change to the pool and records an Event about it, unless in
+// dry-run mode, and appends the action to the audit trail. An empty event
+// type skips the Event. It returns true if the action was taken.
+func (q *Quarantiner) act(ctx context.Context, quarantine *Quarantine, action string, now time.Time,
+	mutate func(pool *v1.Pool) (string, string)) bool {
+	q.log.Info("pool quarantine action", "pool", quarantine.Pool, "action", action, "dryRun", q.DryRun, "reason", quarantine.Reason)
+	if q.DryRun {
+		q.record(quarantine, action, now, nil)
+		return true
+	}
+
+	err := q.apply(ctx, quarantine, mutate)
+	q.record(quarantine, action, now, err)
+	if err != nil {
+		q.log.Error(err, "unable to apply pool quarantine action", "pool", quarantine.Pool, "action", action)
+		return false
+	}
+	return true
+}
+
+func (q *Quarantiner) apply(ctx context.Context, quarantine *Quarantine,
+	mutate func(pool *v1.Pool) (string, string)) error {
+	pool, err := pools.Get(ctx, q.Client, quarantine.Pool)
+	if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(pool.DeepCopy())
+	eventType, reason := mutate(pool)
+	if err := q.Patch(ctx, pool, patch); err != nil {
+		return fmt.Errorf("error patching pool %s: %w", pool.Name, err)
+	}
+	if len(eventType) > 0 {
+		q.Recorder.Eventf(pool, eventType, reason, "%s", quarantine.Reason)
+	}
+	return nil
+}
+
+func deleteAnnotations(pool *v1.Pool) {
+	for _, name := range []string{RecommendedAnnotation, QuarantinedAnnotation, ProbationAnnotation} {
+		delete(pool.Annotations, name)
+	}
+}
+
+func setAnnotation(pool *v1.Pool, name, value string) {
+	if pool.Annotations == nil {
+		pool.Annotations = make(map[string]string)
+	}
+	pool.Annotations[name] = value
+}
+
+// record adds an action to the audit entries of the running evaluation.
+func (q *Quarantiner) record(quarantine *Quarantine, action string, now time.Time, err error) {
+	entry := AuditEntry{
+		Time:   now,
+		Pool:   quarantine.Pool,
+		Action: action,
+		DryRun: q.DryRun,
+		Reason: quarantine.Reason,
+		Score:  quarantine.Score,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	q.actions = append(q.actions, entry)
+}
+
+// writeAudit appends entries to the audit trail file.
+func writeAudit(filename string, entries []AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to encode audit entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// restoreAudit loads the audit trail and rewrites it without the expired entries.
+func (q *Quarantiner) restoreAudit(filename string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	file, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+
+	cutoff := time.Now().Add(-auditRetention)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			q.log.Error(err, "skipping malformed audit entry")
+			continue
+		}
+		if entry.Time.After(cutoff) {
+			q.audit = append(q.audit, entry)
+		}
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read file %s: %w", filename, err)
+	}
+
+	out, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", filename, err)
+	}
+	defer out.Close()
+	encoder := json.NewEncoder(out)
+	for _, entry := range q.audit {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to encode audit entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// save saves the quarantines to a file. They are encoded under the lock and
+// written without it.
+func (q *Quarantiner) save(filename string) error {
+	q.mutex.Lock()
+	content, err := json.MarshalIndent(q.state, "", "  ")
+	q.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode quarantines: %w", err)
+	}
+
+	if err := os.WriteFile(filename, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// Restore restores the quarantines from a file
+func (q *Quarantiner) Restore(filename string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&q.state); err != nil {
+		return fmt.Errorf("failed to decode quarantines: %w", err)
+	}
+	if q.state.Quarantines == nil {
+		q.state.Quarantines = make(map[string]*Quarantine)
+	}
+	if q.state.Released == nil {
+		q.state.Released = make(map[string]time.Time)
+	}
+
+	q.log.Info("Successfully restored quarantines", "filename", filename, "count", len(q.state.Quarantines))
+	return nil
+}
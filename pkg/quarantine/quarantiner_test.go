@@ -0,0 +1,298 @@
+package quarantine
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/pools"
+	v1 "github.com/openshift-splat-team/vsphere-capacity-manager/pkg/apis/vspherecapacitymanager.splat.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const poolName = "vcenter-1-cluster-1"
+
+// fakeClient serves the pools from memory and counts the patches applied to them.
+type fakeClient struct {
+	client.Client
+	pools   map[string]*v1.Pool
+	patches int
+}
+
+func (f *fakeClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	poolList, ok := list.(*v1.PoolList)
+	if !ok {
+		return fmt.Errorf("unexpected list %T", list)
+	}
+	for _, pool := range f.pools {
+		poolList.Items = append(poolList.Items, *pool.DeepCopy())
+	}
+	return nil
+}
+
+func (f *fakeClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	pool, ok := obj.(*v1.Pool)
+	if !ok {
+		return fmt.Errorf("unexpected object %T", obj)
+	}
+	f.pools[pool.Name] = pool.DeepCopy()
+	f.patches++
+	return nil
+}
+
+// fakeCanaries returns the same canaries for every pool.
+type fakeCanaries struct {
+	successes int
+	failures  int
+}
+
+func (f *fakeCanaries) Canaries(pool string, since time.Time) (int, int) {
+	return f.successes, f.failures
+}
+
+// runs returns 10 runs of the pool and four others in the hour before now.
+// Each pool fails one run, and the pool fails 8 if it is unhealthy.
+func runs(now time.Time, unhealthy bool) []data.RunRecord {
+	var runs []data.RunRecord
+	for _, pool := range []string{poolName, "vcenter-1-cluster-2", "vcenter-1-cluster-3", "vcenter-2-cluster-1", "vcenter-2-cluster-2"} {
+		failures := 1
+		if pool == poolName && unhealthy {
+			failures = 8
+		}
+		for i := 0; i < 10; i++ {
+			runs = append(runs, data.RunRecord{
+				Namespace: fmt.Sprintf("ci-op-%s-%d", pool, i),
+				TestName:  "e2e-vsphere-ovn",
+				Pool:      pool,
+				Failed:    i < failures,
+				Completed: now.Add(-time.Duration(i+1) * time.Minute),
+			})
+		}
+	}
+	return runs
+}
+
+func TestUpdate(t *testing.T) {
+	now := time.Now()
+	hoursAgo := func(hours int) *time.Time {
+		at := now.Add(-time.Duration(hours) * time.Hour)
+		return &at
+	}
+
+	for _, test := range []struct {
+		name       string
+		mode       string
+		dryRun     bool
+		unhealthy  bool
+		canaries   fakeCanaries
+		spec       v1.PoolSpec
+		quarantine *Quarantine
+
+		// state is the state of the quarantine after the update, empty if it was dropped.
+		state       string
+		actions     []string
+		noSchedule  bool
+		exclude     bool
+		annotations []string
+		events      int
+	}{
+		{
+			name: "healthy pool is left alone",
+			mode: ModeEnforce,
+		},
+		{
+			name:        "unhealthy pool is recommended",
+			mode:        ModeRecommend,
+			unhealthy:   true,
+			state:       StateRecommended,
+			actions:     []string{ActionRecommend},
+			annotations: []string{RecommendedAnnotation},
+			events:      1,
+		},
+		{
+			name:       "recommendation is cleared once healthy",
+			mode:       ModeRecommend,
+			quarantine: &Quarantine{Pool: poolName, State: StateRecommended, RecommendedAt: *hoursAgo(1)},
+			actions:    []string{ActionClear},
+			events:     1,
+		},
+		{
+			name:        "unhealthy pool is quarantined",
+			mode:        ModeEnforce,
+			unhealthy:   true,
+			state:       StateQuarantined,
+			actions:     []string{ActionRecommend, ActionQuarantine},
+			noSchedule:  true,
+			annotations: []string{RecommendedAnnotation, QuarantinedAnnotation},
+			events:      2,
+		},
+		{
+			name:        "pool already excluded from scheduling is not quarantined",
+			mode:        ModeEnforce,
+			unhealthy:   true,
+			spec:        v1.PoolSpec{NoSchedule: true},
+			state:       StateRecommended,
+			actions:     []string{ActionRecommend},
+			noSchedule:  true,
+			annotations: []string{RecommendedAnnotation},
+			events:      1,
+		},
+		{
+			name:       "quarantined pool cools down",
+			mode:       ModeEnforce,
+			spec:       v1.PoolSpec{NoSchedule: true},
+			quarantine: &Quarantine{Pool: poolName, State: StateQuarantined, QuarantinedAt: hoursAgo(1)},
+			state:      StateQuarantined,
+			noSchedule: true,
+		},
+		{
+			name:        "quarantined pool is put on probation",
+			mode:        ModeEnforce,
+			spec:        v1.PoolSpec{NoSchedule: true},
+			quarantine:  &Quarantine{Pool: poolName, State: StateQuarantined, QuarantinedAt: hoursAgo(7)},
+			state:       StateProbation,
+			actions:     []string{ActionProbation},
+			exclude:     true,
+			annotations: []string{ProbationAnnotation},
+			events:      1,
+		},
+		{
+			name:       "quarantined pool is released manually",
+			mode:       ModeEnforce,
+			quarantine: &Quarantine{Pool: poolName, State: StateQuarantined, QuarantinedAt: hoursAgo(1)},
+			actions:    []string{ActionReleasedManually},
+		},
+		{
+			name:       "pool on probation awaits canaries",
+			mode:       ModeEnforce,
+			canaries:   fakeCanaries{successes: 2},
+			spec:       v1.PoolSpec{Exclude: true},
+			quarantine: &Quarantine{Pool: poolName, State: StateProbation, QuarantinedAt: hoursAgo(8), ProbationAt: hoursAgo(1)},
+			state:      StateProbation,
+			exclude:    true,
+		},
+		{
+			name:       "pool on probation is released",
+			mode:       ModeEnforce,
+			canaries:   fakeCanaries{successes: 3},
+			spec:       v1.PoolSpec{Exclude: true},
+			quarantine: &Quarantine{Pool: poolName, State: StateProbation, QuarantinedAt: hoursAgo(8), ProbationAt: hoursAgo(1)},
+			actions:    []string{ActionRelease},
+			events:     1,
+		},
+		{
+			name:       "pool excluded before its quarantine stays excluded once released",
+			mode:       ModeEnforce,
+			canaries:   fakeCanaries{successes: 3},
+			spec:       v1.PoolSpec{Exclude: true},
+			quarantine: &Quarantine{Pool: poolName, State: StateProbation, QuarantinedAt: hoursAgo(8), ProbationAt: hoursAgo(1), Excluded: true},
+			actions:    []string{ActionRelease},
+			exclude:    true,
+			events:     1,
+		},
+		{
+			name:        "pool on probation is quarantined again when a canary fails",
+			mode:        ModeEnforce,
+			canaries:    fakeCanaries{successes: 1, failures: 1},
+			spec:        v1.PoolSpec{Exclude: true},
+			quarantine:  &Quarantine{Pool: poolName, State: StateProbation, QuarantinedAt: hoursAgo(8), ProbationAt: hoursAgo(1)},
+			state:       StateQuarantined,
+			actions:     []string{ActionQuarantine},
+			noSchedule:  true,
+			annotations: []string{QuarantinedAnnotation},
+			events:      1,
+		},
+		{
+			name:      "dry run only records the quarantine",
+			mode:      ModeEnforce,
+			dryRun:    true,
+			unhealthy: true,
+			state:     StateQuarantined,
+			actions:   []string{ActionRecommend, ActionQuarantine},
+		},
+		{
+			name:       "dry run only records the probation",
+			mode:       ModeEnforce,
+			dryRun:     true,
+			spec:       v1.PoolSpec{NoSchedule: true},
+			quarantine: &Quarantine{Pool: poolName, State: StateQuarantined, QuarantinedAt: hoursAgo(7)},
+			state:      StateProbation,
+			actions:    []string{ActionProbation},
+			noSchedule: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.spec.Name = poolName
+			fake := &fakeClient{pools: map[string]*v1.Pool{
+				poolName: {
+					ObjectMeta: metav1.ObjectMeta{Name: poolName, Namespace: pools.Namespace},
+					Spec:       test.spec,
+				},
+			}}
+			recorder := record.NewFakeRecorder(10)
+			q := &Quarantiner{
+				Client:       fake,
+				Recorder:     recorder,
+				Mode:         test.mode,
+				DryRun:       test.dryRun,
+				CanarySource: &test.canaries,
+				log:          logr.Discard(),
+			}
+			records := runs(now, test.unhealthy)
+			if err := q.init(t.TempDir(), func(filter ledger.Filter) []data.RunRecord {
+				return records
+			}); err != nil {
+				t.Fatalf("error initializing quarantiner: %v", err)
+			}
+			if test.quarantine != nil {
+				q.state.Quarantines[poolName] = test.quarantine
+			}
+
+			q.update(context.Background())
+
+			quarantine, exists := q.state.Quarantines[poolName]
+			switch {
+			case len(test.state) == 0 && exists:
+				t.Errorf("expected the quarantine to be dropped, got %+v", quarantine)
+			case len(test.state) > 0 && !exists:
+				t.Errorf("expected a quarantine in state %s, got none", test.state)
+			case exists && quarantine.State != test.state:
+				t.Errorf("expected state %s, got %s", test.state, quarantine.State)
+			}
+
+			var actions []string
+			for _, entry := range q.audit {
+				if entry.DryRun != test.dryRun {
+					t.Errorf("expected dry run %t in the audit trail, got %+v", test.dryRun, entry)
+				}
+				actions = append(actions, entry.Action)
+			}
+			if fmt.Sprint(actions) != fmt.Sprint(test.actions) {
+				t.Errorf("expected actions %v, got %v", test.actions, actions)
+			}
+
+			pool := fake.pools[poolName]
+			if pool.Spec.NoSchedule != test.noSchedule || pool.Spec.Exclude != test.exclude {
+				t.Errorf("expected noSchedule %t and exclude %t, got %+v", test.noSchedule, test.exclude, pool.Spec)
+			}
+			for _, annotation := range []string{RecommendedAnnotation, QuarantinedAnnotation, ProbationAnnotation} {
+				if _, exists := pool.Annotations[annotation]; exists != slices.Contains(test.annotations, annotation) {
+					t.Errorf("expected annotations %v, got %v", test.annotations, pool.Annotations)
+				}
+			}
+			if len(recorder.Events) != test.events {
+				t.Errorf("expected %d events, got %d", test.events, len(recorder.Events))
+			}
+			if test.dryRun && fake.patches > 0 {
+				t.Errorf("expected no patches in dry run, got %d", fake.patches)
+			}
+		})
+	}
+}
@@ -0,0 +1,427 @@
+package report
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Files of the state directory the report is built from.
+const (
+	TestContextsFile = "test_contexts.json"
+	RunLedgerFile    = "run_ledger.jsonl"
+)
+
+// Sources of the pass and fail totals.
+const (
+	SourceLedger  = "ledger"
+	SourceMetrics = "metrics"
+)
+
+// Columns the rows can be sorted by, besides the dimension values.
+const (
+	SortName     = "name"
+	SortRuns     = "runs"
+	SortPasses   = "passes"
+	SortFails    = "fails"
+	SortPassRate = "pass_rate"
+	SortInFlight = "in_flight"
+)
+
+// labelDimensions maps the labels of the run counters to the dimensions they hold.
+var labelDimensions = map[string]string{
+	"test_name":    ledger.DimensionTestName,
+	"variant":      ledger.DimensionVariant,
+	"job_type":     ledger.DimensionJobType,
+	"pool":         ledger.DimensionPool,
+	"network_type": ledger.DimensionNetworkType,
+	"vlan":         ledger.DimensionPortgroup,
+}
+
+// State is the persisted state of a monitor, read without a cluster connection.
+type State struct {
+	// Runs are the completed runs of the run ledger.
+	Runs []data.RunRecord
+	// InFlight are the test runs which were in flight when the state was saved.
+	InFlight []data.RunRecord
+	// Counters are the run counters of a metrics snapshot, if one was loaded.
+	Counters []Counter
+	// Saved is when the test contexts were last saved.
+	Saved time.Time
+}
+
+// Counter is a series of the pass and fail counters, as a run record holding
+// the dimension values of its labels.
+type Counter struct {
+	Run    data.RunRecord
+	Passes int
+	Fails  int
+}
+
+// Options select and order what the report shows.
+type Options struct {
+	// Tables are the dimensions of each table, e.g. {{"pool"}, {"pool", "variant"}}.
+	Tables [][]string
+	// Source is either SourceLedger or SourceMetrics.
+	Source string
+	Filter ledger.Filter
+	// MinRuns leaves out rows with fewer completed runs.
+	MinRuns int
+	// SortBy is a dimension or one of the sort columns, Descending reverses the order.
+	SortBy     string
+	Descending bool
+}
+
+// Report is the pass/fail totals of the runs in a time range.
+type Report struct {
+	Generated time.Time `json:"generated"`
+	Source    string    `json:"source"`
+	// Since and Until bound the completion of the runs of the ledger. They are unset for metrics snapshots.
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+	// Saved is when the test contexts the runs in flight are taken from were saved.
+	Saved  *time.Time `json:"saved,omitempty"`
+	Tables []Table    `json:"tables"`
+}
+
+// Table is the totals grouped by the same dimensions.
+type Table struct {
+	Dimensions []string `json:"dimensions"`
+	Rows       []Row    `json:"rows"`
+}
+
+// Row is the totals of the runs sharing the same dimension values.
+type Row struct {
+	ledger.Summary
+	Runs int `json:"runs"`
+	// InFlight and FailedInFlight count the runs in flight when the state was saved.
+	InFlight       int `json:"in_flight"`
+	FailedInFlight int `json:"failed_in_flight"`
+}
+
+// Load reads the run ledger and test contexts of a state directory, and the
+// run counters of a metrics snapshot if its filename is not empty. Snapshots
+// are either the JSON snapshots of the monitor or files in the Prometheus text
+// format.
+func Load(dir string, metricsFile string) (*State, error) {
+	state := &State{}
+
+	runs, err := ledger.Load(filepath.Join(dir, RunLedgerFile))
+	if err != nil {
+		return nil, err
+	}
+	state.Runs = runs
+
+	filename := filepath.Join(dir, TestContextsFile)
+	if info, err := os.Stat(filename); err == nil {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+		}
+		var testContexts map[string]*data.TestContext
+		if err := json.Unmarshal(content, &testContexts); err != nil {
+			return nil, fmt.Errorf("failed to decode test contexts %s: %w", filename, err)
+		}
+		for _, testContext := range testContexts {
+			if testContext != nil && testContext.IsTestRun() {
+				state.InFlight = append(state.InFlight, data.NewRunRecord(testContext, time.Time{}))
+			}
+		}
+		state.Saved = info.ModTime()
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to stat file %s: %w", filename, err)
+	}
+
+	if len(metricsFile) > 0 {
+		if state.Counters, err = loadCounters(metricsFile); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// loadCounters reads the pass and fail counters of a metrics snapshot.
+func loadCounters(filename string) ([]Counter, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+	}
+
+	series := make(map[string]*Counter)
+	var keys []string
+	add := func(labels map[string]string, value float64, failed bool) {
+		run := data.RunRecord{}
+		for label, dimension := range labelDimensions {
+			setDimension(&run, dimension, labels[label])
+		}
+		key := fmt.Sprint(run.TestName, "\x00", run.Variant, "\x00", run.JobType, "\x00", run.Pool, "\x00", run.NetworkType, "\x00", run.Portgroup)
+		counter, exists := series[key]
+		if !exists {
+			counter = &Counter{Run: run}
+			series[key] = counter
+			keys = append(keys, key)
+		}
+		if failed {
+			counter.Fails += int(math.Round(value))
+		} else {
+			counter.Passes += int(math.Round(value))
+		}
+	}
+
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '{' {
+		var snapshot testcontext.MetricsSnapshot
+		if err := json.Unmarshal(content, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to decode metrics snapshot %s: %w", filename, err)
+		}
+		// the keys of the snapshot join the label values in the order of the sorted label names
+		labelNames := append([]string(nil), monitor.RunPasses.Labels...)
+		sort.Strings(labelNames)
+		for _, counters := range []struct {
+			values map[string]float64
+			failed bool
+		}{{snapshot.PassCounters, false}, {snapshot.FailCounters, true}} {
+			for key, value := range counters.values {
+				values := strings.Split(key, ",")
+				if len(values) != len(labelNames) {
+					return nil, fmt.Errorf("invalid series %q in metrics snapshot %s", key, filename)
+				}
+				labels := make(map[string]string, len(labelNames))
+				for i, name := range labelNames {
+					labels[name] = values[i]
+				}
+				add(labels, value, counters.failed)
+			}
+		}
+	} else {
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse metrics %s: %w", filename, err)
+		}
+		for name, failed := range map[string]bool{monitor.RunPasses.Name: false, monitor.RunFails.Name: true} {
+			family, exists := families[name]
+			if !exists {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				add(metricLabels(metric), counterValue(family, metric), failed)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	counters := make([]Counter, 0, len(keys))
+	for _, key := range keys {
+		counters = append(counters, *series[key])
+	}
+	return counters, nil
+}
+
+func metricLabels(metric *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(metric.GetLabel()))
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
+
+// counterValue returns the value of a series, which the text format types
+// as untyped unless a TYPE line declares it a counter.
+func counterValue(family *dto.MetricFamily, metric *dto.Metric) float64 {
+	if family.GetType() == dto.MetricType_COUNTER {
+		return metric.GetCounter().GetValue()
+	}
+	return metric.GetUntyped().GetValue()
+}
+
+func setDimension(run *data.RunRecord, dimension string, value string) {
+	switch dimension {
+	case ledger.DimensionTestName:
+		run.TestName = value
+	case ledger.DimensionVariant:
+		run.Variant = value
+	case ledger.DimensionJobType:
+		run.JobType = value
+	case ledger.DimensionPool:
+		run.Pool = value
+	case ledger.DimensionNetworkType:
+		run.NetworkType = value
+	case ledger.DimensionPortgroup:
+		run.Portgroup = value
+	}
+}
+
+// Build totals the runs of the state into a table per set of dimensions.
+func (s *State) Build(options Options, now time.Time) (*Report, error) {
+	report := &Report{Generated: now, Source: options.Source, Saved: timeOrNil(s.Saved)}
+
+	// runs in flight are selected by everything but their completion and result
+	inFlightFilter := options.Filter
+	inFlightFilter.Since, inFlightFilter.Until, inFlightFilter.Result = time.Time{}, time.Time{}, ""
+
+	var tallies []tally
+	switch options.Source {
+	case SourceLedger:
+		report.Since, report.Until = timeOrNil(options.Filter.Since), timeOrNil(options.Filter.Until)
+		for i := range s.Runs {
+			run := &s.Runs[i]
+			if !options.Filter.Matches(run) {
+				continue
+			}
+			if run.Failed {
+				tallies = append(tallies, tally{run: run, fails: 1})
+			} else {
+				tallies = append(tallies, tally{run: run, passes: 1})
+			}
+		}
+	case SourceMetrics:
+		if s.Counters == nil {
+			return nil, fmt.Errorf("the metrics source needs a metrics snapshot")
+		}
+		if !options.Filter.Since.IsZero() || !options.Filter.Until.IsZero() || len(options.Filter.Result) > 0 {
+			return nil, fmt.Errorf("the totals of a metrics snapshot cannot be filtered by time or result")
+		}
+		for i := range s.Counters {
+			counter := &s.Counters[i]
+			if inFlightFilter.Matches(&counter.Run) {
+				tallies = append(tallies, tally{run: &counter.Run, passes: counter.Passes, fails: counter.Fails})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown source %q, must be %s or %s", options.Source, SourceLedger, SourceMetrics)
+	}
+	for i := range s.InFlight {
+		run := &s.InFlight[i]
+		if !inFlightFilter.Matches(run) {
+			continue
+		}
+		if run.Failed {
+			tallies = append(tallies, tally{run: run, inFlight: 1, failedInFlight: 1})
+		} else {
+			tallies = append(tallies, tally{run: run, inFlight: 1})
+		}
+	}
+
+	for _, dimensions := range options.Tables {
+		table, err := buildTable(tallies, dimensions, options)
+		if err != nil {
+			return nil, err
+		}
+		report.Tables = append(report.Tables, table)
+	}
+	return report, nil
+}
+
+// tally is what a run or series adds to the row of its dimension values.
+type tally struct {
+	run                                     *data.RunRecord
+	passes, fails, inFlight, failedInFlight int
+}
+
+func buildTable(tallies []tally, dimensions []string, options Options) (Table, error) {
+	if options.SortBy != SortName && options.SortBy != SortRuns && options.SortBy != SortPasses && options.SortBy != SortFails &&
+		options.SortBy != SortPassRate && options.SortBy != SortInFlight && !contains(dimensions, options.SortBy) {
+		return Table{}, fmt.Errorf("cannot sort the %s table by %q", strings.Join(dimensions, ", "), options.SortBy)
+	}
+
+	rows := make(map[string]*Row)
+	for _, t := range tallies {
+		values := make([]string, len(dimensions))
+		for i, dimension := range dimensions {
+			value, err := ledger.DimensionValue(t.run, dimension)
+			if err != nil {
+				return Table{}, err
+			}
+			values[i] = value
+		}
+		key := strings.Join(values, "\x00")
+		row, exists := rows[key]
+		if !exists {
+			row = &Row{Summary: ledger.Summary{Labels: make(map[string]string, len(dimensions))}}
+			for i, dimension := range dimensions {
+				row.Labels[dimension] = values[i]
+			}
+			rows[key] = row
+		}
+		row.Passes += t.passes
+		row.Fails += t.fails
+		row.InFlight += t.inFlight
+		row.FailedInFlight += t.failedInFlight
+	}
+
+	table := Table{Dimensions: dimensions, Rows: []Row{}}
+	for _, row := range rows {
+		row.Runs = row.Total()
+		if row.Runs < options.MinRuns {
+			continue
+		}
+		if row.Runs > 0 {
+			row.PassRate = float64(row.Passes) / float64(row.Runs)
+		}
+		table.Rows = append(table.Rows, *row)
+	}
+
+	name := func(row *Row) string {
+		values := make([]string, len(dimensions))
+		for i, dimension := range dimensions {
+			values[i] = row.Labels[dimension]
+		}
+		return strings.Join(values, "\x00")
+	}
+	sort.SliceStable(table.Rows, func(i, j int) bool {
+		a, b := &table.Rows[i], &table.Rows[j]
+		var order int
+		switch options.SortBy {
+		case SortName:
+			order = cmp.Compare(name(a), name(b))
+		case SortRuns:
+			order = cmp.Compare(a.Runs, b.Runs)
+		case SortPasses:
+			order = cmp.Compare(a.Passes, b.Passes)
+		case SortFails:
+			order = cmp.Compare(a.Fails, b.Fails)
+		case SortPassRate:
+			order = cmp.Compare(a.PassRate, b.PassRate)
+		case SortInFlight:
+			order = cmp.Compare(a.InFlight, b.InFlight)
+		default:
+			order = cmp.Compare(a.Labels[options.SortBy], b.Labels[options.SortBy])
+		}
+		if order == 0 {
+			// rows of the same value stay in the order of their dimension values
+			return name(a) < name(b)
+		}
+		return (order < 0) != options.Descending
+	})
+	return table, nil
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats of the report.
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatCSV      = "csv"
+	FormatJSON     = "json"
+)
+
+// columns are the totals of every row, after the dimension values.
+var columns = []string{"runs", "passes", "fails", "pass_rate", "in_flight", "failed_in_flight"}
+
+// Write writes the report in the given format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return r.writeText(w)
+	case FormatMarkdown:
+		return r.writeMarkdown(w)
+	case FormatCSV:
+		return r.writeCSV(w)
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	return fmt.Errorf("unknown format %q, expected %s, %s, %s or %s", format, FormatText, FormatMarkdown, FormatCSV, FormatJSON)
+}
+
+// description says which runs the report totals.
+func (r *Report) description() string {
+	var description string
+	switch {
+	case r.Source == SourceMetrics:
+		description = "All-time totals of the metrics snapshot"
+	case r.Since != nil && r.Until != nil:
+		description = fmt.Sprintf("Runs completed from %s to %s", r.Since.Format(time.RFC3339), r.Until.Format(time.RFC3339))
+	case r.Since != nil:
+		description = fmt.Sprintf("Runs completed since %s", r.Since.Format(time.RFC3339))
+	case r.Until != nil:
+		description = fmt.Sprintf("Runs completed until %s", r.Until.Format(time.RFC3339))
+	default:
+		description = "All runs of the run ledger"
+	}
+	if r.Saved != nil {
+		description += fmt.Sprintf(", runs in flight as of %s", r.Saved.Format(time.RFC3339))
+	}
+	return description
+}
+
+func (t *Table) title() string {
+	return "By " + strings.ReplaceAll(strings.Join(t.Dimensions, ", "), "_", " ")
+}
+
+// values returns the dimension values and totals of a row.
+func (t *Table) values(row *Row) []string {
+	values := make([]string, 0, len(t.Dimensions)+len(columns))
+	for _, dimension := range t.Dimensions {
+		values = append(values, row.Labels[dimension])
+	}
+	return append(values,
+		strconv.Itoa(row.Runs),
+		strconv.Itoa(row.Passes),
+		strconv.Itoa(row.Fails),
+		formatPassRate(row),
+		strconv.Itoa(row.InFlight),
+		strconv.Itoa(row.FailedInFlight),
+	)
+}
+
+func formatPassRate(row *Row) string {
+	if row.Runs == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*row.PassRate)
+}
+
+func (r *Report) writeText(w io.Writer) error {
+	fmt.Fprintln(w, r.description())
+	for i := range r.Tables {
+		table := &r.Tables[i]
+		fmt.Fprintf(w, "\n%s\n", table.title())
+		writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		header := append(append([]string(nil), table.Dimensions...), columns...)
+		fmt.Fprintln(writer, strings.ToUpper(strings.Join(header, "\t")))
+		for j := range table.Rows {
+			fmt.Fprintln(writer, strings.Join(table.values(&table.Rows[j]), "\t"))
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Report) writeMarkdown(w io.Writer) error {
+	fmt.Fprintf(w, "%s.\n", r.description())
+	for i := range r.Tables {
+		table := &r.Tables[i]
+		fmt.Fprintf(w, "\n### %s\n\n", table.title())
+		header := append(append([]string(nil), table.Dimensions...), columns...)
+		fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+		fmt.Fprintf(w, "|%s\n", strings.Repeat("---|", len(header)))
+		for j := range table.Rows {
+			values := table.values(&table.Rows[j])
+			for k, value := range values {
+				values[k] = strings.ReplaceAll(value, "|", "\\|")
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(values, " | "))
+		}
+	}
+	return nil
+}
+
+// writeCSV writes the rows of all tables with a column per dimension of any
+// table, left empty for the dimensions a table is not grouped by. The pass
+// rate is a fraction rather than a percentage.
+func (r *Report) writeCSV(w io.Writer) error {
+	var dimensions []string
+	for _, table := range r.Tables {
+		for _, dimension := range table.Dimensions {
+			if !contains(dimensions, dimension) {
+				dimensions = append(dimensions, dimension)
+			}
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append(append([]string{"table"}, dimensions...), columns...)); err != nil {
+		return err
+	}
+	for _, table := range r.Tables {
+		name := strings.Join(table.Dimensions, "+")
+		for _, row := range table.Rows {
+			record := []string{name}
+			for _, dimension := range dimensions {
+				record = append(record, row.Labels[dimension])
+			}
+			record = append(record,
+				strconv.Itoa(row.Runs),
+				strconv.Itoa(row.Passes),
+				strconv.Itoa(row.Fails),
+				strconv.FormatFloat(row.PassRate, 'f', 4, 64),
+				strconv.Itoa(row.InFlight),
+				strconv.Itoa(row.FailedInFlight),
+			)
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
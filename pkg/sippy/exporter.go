@@ -0,0 +1,249 @@
+package sippy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	exportStateFilename = "sippy_export.json"
+
+	defaultInterval = time.Hour
+
+	// ndjsonContentType is the content type of newline delimited JSON, which
+	// BigQuery loads directly.
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// exportState is the persisted position of the periodic export in the run ledger.
+type exportState struct {
+	Revision uint64 `json:"revision"`
+}
+
+// Exporter exports completed runs as Sippy job runs. The API serves the job
+// runs of any time range, and if a directory is configured, the runs
+// recorded or updated since the previous export are written to a new file in
+// it every interval.
+type Exporter struct {
+	// Directory receives the periodic export files. Periodic export is disabled if empty.
+	Directory string
+	// Interval is how often newly completed runs are written to a file.
+	Interval time.Duration
+	// ProwURL is the base URL job run links are built from. No links are built if empty.
+	ProwURL string
+
+	// revision is the revision of the run ledger exported last. Runs reach the
+	// ledger out of order of completion and their outcome may be corrected
+	// later, so the ledger is followed by revision rather than completion.
+	revision uint64
+	// stateFilename is where the exported revision is saved.
+	stateFilename string
+
+	exportedCounter prometheus.Counter
+
+	testContext *testcontext.TestContextService
+	mutex       sync.Mutex
+
+	log logr.Logger
+}
+
+func (e *Exporter) SetupWithManager(mgr ctrl.Manager,
+	testContext *testcontext.TestContextService) error {
+	e.testContext = testContext
+	e.log = mgr.GetLogger().WithName("sippy")
+	if e.Interval <= 0 {
+		e.Interval = defaultInterval
+	}
+
+	if len(e.Directory) == 0 {
+		return nil
+	}
+
+	e.exportedCounter = monitor.SippyJobRunsExported.NewCounter()
+	if err := monitor.SippyJobRunsExported.Register(e.exportedCounter); err != nil {
+		return fmt.Errorf("error registering sippy export metric: %w", err)
+	}
+
+	e.stateFilename = filepath.Join(testContext.Directory, exportStateFilename)
+	if err := e.Restore(e.stateFilename); err != nil {
+		e.log.Error(err, "error restoring sippy export state")
+	}
+
+	if err := mgr.Add(e); err != nil {
+		return fmt.Errorf("error adding sippy exporter to manager: %w", err)
+	}
+	return nil
+}
+
+// SetupWithServer serves the job runs through the API.
+func (e *Exporter) SetupWithServer(server *api.Server) {
+	server.Handle("GET /api/v1/sippy/job-runs", http.HandlerFunc(e.listJobRuns))
+}
+
+// Start writes newly completed runs to a file every interval until the context is cancelled.
+func (e *Exporter) Start(ctx context.Context) error {
+	if err := os.MkdirAll(e.Directory, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", e.Directory, err)
+	}
+	wait.UntilWithContext(ctx, e.export, e.Interval)
+	return nil
+}
+
+// export writes the runs recorded or updated since the previous export. A
+// run whose outcome was corrected after it was exported is written again, and
+// its later job run supersedes the earlier one.
+func (e *Exporter) export(ctx context.Context) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	runs, revision := e.testContext.RunChanges(e.revision)
+	if revision < e.revision {
+		// the run ledger was reset, follow it from its start
+		e.log.Info("Run ledger is behind the export, exporting it from its start", "revision", revision, "exported", e.revision)
+		runs, revision = e.testContext.RunChanges(0)
+	}
+	if revision == e.revision {
+		return
+	}
+
+	jobRuns := NewJobRuns(runs, e.ProwURL)
+	if len(jobRuns) > 0 {
+		filename := filepath.Join(e.Directory, fmt.Sprintf("job-runs-%s.json", time.Now().UTC().Format("20060102T150405Z")))
+		if err := writeFile(filename, jobRuns); err != nil {
+			e.log.Error(err, "error exporting job runs")
+			return
+		}
+		e.exportedCounter.Add(float64(len(jobRuns)))
+		e.log.Info("Exported job runs", "filename", filename, "count", len(jobRuns))
+	}
+
+	e.revision = revision
+	if err := e.save(e.stateFilename); err != nil {
+		e.log.Error(err, "error saving sippy export state")
+	}
+}
+
+// writeFile writes the job runs as newline delimited JSON. The file is
+// written under a temporary name first so it is never picked up half written.
+func writeFile(filename string, jobRuns []JobRun) error {
+	temporary := filename + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", temporary, err)
+	}
+	if err := encode(file, jobRuns); err != nil {
+		file.Close()
+		os.Remove(temporary)
+		return fmt.Errorf("failed to write file %s: %w", temporary, err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(temporary)
+		return fmt.Errorf("failed to close file %s: %w", temporary, err)
+	}
+	if err := os.Rename(temporary, filename); err != nil {
+		return fmt.Errorf("failed to rename file %s: %w", temporary, err)
+	}
+	return nil
+}
+
+// encode writes one job run per line.
+func encode(w io.Writer, jobRuns []JobRun) error {
+	encoder := json.NewEncoder(w)
+	for _, jobRun := range jobRuns {
+		if err := encoder.Encode(jobRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save saves the position of the periodic export to a file
+func (e *Exporter) save(filename string) error {
+	state := exportState{Revision: e.revision}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(state); err != nil {
+		return fmt.Errorf("failed to encode sippy export state: %w", err)
+	}
+	return nil
+}
+
+// Restore restores the position of the periodic export from a file
+func (e *Exporter) Restore(filename string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	var state exportState
+	if err := json.NewDecoder(file).Decode(&state); err != nil {
+		return fmt.Errorf("failed to decode sippy export state: %w", err)
+	}
+	e.revision = state.Revision
+
+	e.log.Info("Successfully restored sippy export state", "filename", filename, "revision", e.revision)
+	return nil
+}
+
+// listJobRuns serves the job runs selected by the same filters as the runs
+// API, as a JSON array or as newline delimited JSON if format=ndjson.
+func (e *Exporter) listJobRuns(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := api.ParseFilter(query)
+	if err != nil {
+		e.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	jobRuns := NewJobRuns(e.testContext.QueryRuns(filter), e.ProwURL)
+
+	switch format := query.Get("format"); format {
+	case "", "json":
+		err = api.WriteJSON(w, http.StatusOK, jobRuns)
+	case "ndjson":
+		w.Header().Set("Content-Type", ndjsonContentType)
+		err = encode(w, jobRuns)
+	default:
+		e.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid format %q, must be json or ndjson", format))
+		return
+	}
+	if err != nil {
+		e.log.Error(err, "error encoding response")
+	}
+}
+
+// writeError responds with the JSON error of the API.
+func (e *Exporter) writeError(w http.ResponseWriter, status int, err error) {
+	if err := api.WriteError(w, status, err); err != nil {
+		e.log.Error(err, "error encoding response")
+	}
+}
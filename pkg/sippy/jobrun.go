@@ -0,0 +1,106 @@
+package sippy
+
+import (
+	"time"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+)
+
+const (
+	// DefaultProwURL is where the artifacts of OpenShift CI job runs are viewed.
+	DefaultProwURL = "https://prow.ci.openshift.org/view/gs/test-platform-results"
+
+	stateSuccess = data.ProwJobSuccess
+	stateFailure = data.ProwJobFailure
+)
+
+// Variant names describing the vSphere infrastructure a job run used.
+const (
+	VariantPlatform       = "Platform"
+	VariantCI             = "CIVariant"
+	VariantPool           = "VSpherePool"
+	VariantPortgroup      = "VSpherePortgroup"
+	VariantNetworkType    = "VSphereNetworkType"
+	VariantVCenter        = "VSphereVCenter"
+	VariantComputeCluster = "VSphereComputeCluster"
+)
+
+// JobRun is a completed job run in the shape of the prow job rows Sippy
+// imports, with the vSphere infrastructure added as variants.
+type JobRun struct {
+	BuildID    string    `json:"prowjob_build_id"`
+	JobName    string    `json:"prowjob_job_name"`
+	URL        string    `json:"prowjob_url,omitempty"`
+	State      string    `json:"prowjob_state"`
+	Start      time.Time `json:"prowjob_start"`
+	Completion time.Time `json:"prowjob_completion"`
+	Org        string    `json:"org,omitempty"`
+	Repo       string    `json:"repo,omitempty"`
+	Branch     string    `json:"branch,omitempty"`
+	PRNumber   int       `json:"pr_number,omitempty"`
+	PRSha      string    `json:"pr_sha,omitempty"`
+	TestName   string    `json:"test_name,omitempty"`
+	// Variants are the variants of the job run as name:value pairs, e.g. VSpherePool:vcs8e-vc.
+	Variants []string `json:"variants"`
+}
+
+// NewJobRun converts a completed run into a Sippy job run. ok is false if the
+// run does not identify its prow job.
+func NewJobRun(run data.RunRecord, prowURL string) (jobRun JobRun, ok bool) {
+	if len(run.Name) == 0 || len(run.BuildID) == 0 {
+		return JobRun{}, false
+	}
+
+	jobRun = JobRun{
+		BuildID:    run.BuildID,
+		JobName:    run.Name,
+		URL:        run.Job.URL(prowURL),
+		State:      stateSuccess,
+		Start:      run.Started,
+		Completion: run.Completed,
+		Org:        run.Org,
+		Repo:       run.Repo,
+		Branch:     run.Branch,
+		PRNumber:   run.Pull,
+		TestName:   run.TestName,
+	}
+	if run.Failed {
+		jobRun.State = stateFailure
+	}
+	// prow distinguishes aborted and errored jobs from failed ones
+	if run.ProwJob != nil {
+		jobRun.State = run.ProwJob.State
+		if len(run.ProwJob.URL) > 0 {
+			jobRun.URL = run.ProwJob.URL
+		}
+	}
+	if run.Pull > 0 {
+		jobRun.PRSha = run.Commit
+	}
+
+	jobRun.Variants = []string{VariantPlatform + ":vsphere"}
+	for _, variant := range []struct{ name, value string }{
+		{VariantCI, run.Variant},
+		{VariantPool, run.Pool},
+		{VariantPortgroup, run.Portgroup},
+		{VariantNetworkType, run.NetworkType},
+		{VariantVCenter, run.Topology.VCenter},
+		{VariantComputeCluster, run.Topology.ComputeCluster},
+	} {
+		if len(variant.value) > 0 {
+			jobRun.Variants = append(jobRun.Variants, variant.name+":"+variant.value)
+		}
+	}
+	return jobRun, true
+}
+
+// NewJobRuns converts the runs which identify their prow job.
+func NewJobRuns(runs []data.RunRecord, prowURL string) []JobRun {
+	jobRuns := []JobRun{}
+	for _, run := range runs {
+		if jobRun, ok := NewJobRun(run, prowURL); ok {
+			jobRuns = append(jobRuns, jobRun)
+		}
+	}
+	return jobRuns
+}
@@ -0,0 +1,187 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/openshift-splat-team/test-monitor/pkg/observer"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// ServiceName is the service.name resource attribute of the exported spans.
+	ServiceName = "test-monitor"
+
+	tracesPath = "/v1/traces"
+
+	defaultQueueSize = 1000
+	// maxBatch is the number of runs exported in a single request.
+	maxBatch = 50
+
+	requestTimeout = 30 * time.Second
+)
+
+// Exporter exports completed runs as traces to an OTLP/HTTP collector using
+// the JSON encoding.
+type Exporter struct {
+	observer.NopObserver
+
+	// Endpoint is the base URL of the collector, e.g. http://localhost:4318.
+	// Spans are posted to its /v1/traces path.
+	Endpoint string
+	// Headers are added to every request, e.g. for authorization.
+	Headers map[string]string
+	// Client is used to post the spans. A default client is used if nil.
+	Client *http.Client
+	// QueueSize is the number of runs which may wait for export.
+	QueueSize int
+
+	queue chan []Span
+
+	exportedCounter prometheus.Counter
+	droppedCounter  *prometheus.CounterVec
+
+	log logr.Logger
+}
+
+func (e *Exporter) SetupWithManager(mgr ctrl.Manager) error {
+	e.log = mgr.GetLogger().WithName("trace")
+	e.init()
+
+	if err := monitor.TraceRunsExported.Register(e.exportedCounter); err != nil {
+		return fmt.Errorf("error registering exported traces metric: %w", err)
+	}
+	if err := monitor.TraceRunsDropped.Register(e.droppedCounter); err != nil {
+		return fmt.Errorf("error registering dropped traces metric: %w", err)
+	}
+
+	if err := mgr.Add(e); err != nil {
+		return fmt.Errorf("error adding trace exporter to manager: %w", err)
+	}
+	return nil
+}
+
+// init applies the defaults and creates the queue and the metrics.
+func (e *Exporter) init() {
+	if e.Client == nil {
+		e.Client = &http.Client{Timeout: requestTimeout}
+	}
+	if e.QueueSize <= 0 {
+		e.QueueSize = defaultQueueSize
+	}
+	e.queue = make(chan []Span, e.QueueSize)
+
+	e.exportedCounter = monitor.TraceRunsExported.NewCounter()
+	e.droppedCounter = monitor.TraceRunsDropped.NewCounterVec()
+}
+
+// OnRunCompleted queues the trace of a completed run without blocking. The
+// run is dropped if the queue is full.
+func (e *Exporter) OnRunCompleted(testContext *data.TestContext, run data.RunRecord) {
+	select {
+	case e.queue <- Spans(testContext, run.Completed):
+	default:
+		e.droppedCounter.WithLabelValues("queue_full").Inc()
+	}
+}
+
+// Start exports queued runs until the context is cancelled.
+func (e *Exporter) Start(ctx context.Context) error {
+	for {
+		var batch [][]Span
+		select {
+		case <-ctx.Done():
+			return nil
+		case spans := <-e.queue:
+			batch = append(batch, spans)
+		}
+	drain:
+		for len(batch) < maxBatch {
+			select {
+			case spans := <-e.queue:
+				batch = append(batch, spans)
+			default:
+				break drain
+			}
+		}
+
+		if err := e.export(ctx, batch); err != nil {
+			e.log.Error(err, "error exporting traces", "runs", len(batch))
+			e.droppedCounter.WithLabelValues("export_failed").Add(float64(len(batch)))
+			continue
+		}
+		e.exportedCounter.Add(float64(len(batch)))
+	}
+}
+
+// NeedLeaderElection lets the exporter drain runs completed by any replica.
+func (e *Exporter) NeedLeaderElection() bool {
+	return false
+}
+
+// exportRequest is an OTLP ExportTraceServiceRequest in its JSON encoding.
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []Span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+func (e *Exporter) export(ctx context.Context, batch [][]Span) error {
+	var spans []Span
+	for _, run := range batch {
+		spans = append(spans, run...)
+	}
+	body, err := json.Marshal(exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []KeyValue{stringAttribute("service.name", ServiceName)}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: ServiceName}, Spans: spans}},
+	}}})
+	if err != nil {
+		return fmt.Errorf("error encoding spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.Endpoint, "/")+tracesPath, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting spans to %s: %w", e.Endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector responded with %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
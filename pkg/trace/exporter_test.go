@@ -0,0 +1,258 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The OTLP/HTTP JSON encoding of an ExportTraceServiceRequest, declared
+// independently of the exporter so that misnamed fields fail to decode.
+type otlpRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			Spans []otlpSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Status            *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string `json:"stringValue"`
+		IntValue    *string `json:"intValue"`
+		BoolValue   *bool   `json:"boolValue"`
+	} `json:"value"`
+}
+
+// receiver is a local OTLP/HTTP collector passing the decoded requests on.
+func receiver(t *testing.T, requests chan<- otlpRequest) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("content type %q, expected application/json", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("authorization %q, expected the configured header", got)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("error reading request: %v", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		var request otlpRequest
+		if err := decoder.Decode(&request); err != nil {
+			t.Errorf("error decoding ExportTraceServiceRequest: %v\n%s", err, body)
+		}
+		requests <- request
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func attributeMap(kvs []otlpKeyValue) map[string]string {
+	values := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		switch {
+		case kv.Value.StringValue != nil:
+			values[kv.Key] = *kv.Value.StringValue
+		case kv.Value.IntValue != nil:
+			values[kv.Key] = *kv.Value.IntValue
+		case kv.Value.BoolValue != nil:
+			values[kv.Key] = strconv.FormatBool(*kv.Value.BoolValue)
+		}
+	}
+	return values
+}
+
+func unixNanoTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	nanos, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		t.Fatalf("invalid unix nano time %q: %v", value, err)
+	}
+	return time.Unix(0, nanos)
+}
+
+func TestExporter(t *testing.T) {
+	created := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	leased := created.Add(10 * time.Minute)
+	failed := created.Add(40 * time.Minute)
+	completed := created.Add(time.Hour)
+	testContext := &data.TestContext{
+		Namespace: corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:              "ci-op-abc",
+			CreationTimestamp: metav1.NewTime(created),
+			Labels: map[string]string{
+				data.TargetLabel:  "e2e-vsphere-ovn",
+				data.VariantLabel: "nightly",
+				data.JobTypeLabel: "periodic",
+				data.PullLabel:    "42",
+			},
+		}},
+		Failed:       true,
+		Pool:         "pool-a",
+		NetworkType:  "single-tenant",
+		Portgroup:    "ci-vlan-1",
+		LeaseCreated: created.Add(time.Minute),
+		LeasedAt:     leased,
+		Steps: []data.Step{
+			{Name: "ipi-install", Phase: string(corev1.PodSucceeded), Started: leased, Finished: created.Add(30 * time.Minute)},
+			{Name: "e2e-test", Phase: string(corev1.PodFailed), Started: created.Add(30 * time.Minute), Finished: failed},
+		},
+		FailedPods: []data.PodFailure{{Name: "e2e-test", NodeName: "node-1", Reason: "test: Error (exit code 1)", Time: failed}},
+	}
+
+	requests := make(chan otlpRequest, 1)
+	server := receiver(t, requests)
+	exporter := &Exporter{Endpoint: server.URL + "/", Headers: map[string]string{"Authorization": "Bearer secret"}, log: logr.Discard()}
+	exporter.init()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exporter.Start(ctx)
+
+	exporter.OnRunCompleted(testContext, data.NewRunRecord(testContext, completed))
+	var request otlpRequest
+	select {
+	case request = <-requests:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the receiver got no spans")
+	}
+
+	if len(request.ResourceSpans) != 1 || len(request.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("expected a single resource and scope, got %+v", request)
+	}
+	if got := attributeMap(request.ResourceSpans[0].Resource.Attributes)["service.name"]; got != ServiceName {
+		t.Errorf("service.name %q, expected %q", got, ServiceName)
+	}
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	byName := make(map[string]otlpSpan, len(spans))
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	if len(spans) != 6 || len(byName) != 6 {
+		t.Fatalf("expected the root, two lease, two step and a failure span, got %+v", spans)
+	}
+
+	root := byName["e2e-vsphere-ovn"]
+	if _, err := hex.DecodeString(root.TraceID); err != nil || len(root.TraceID) != 32 {
+		t.Errorf("trace ID %q is not 16 hex encoded bytes", root.TraceID)
+	}
+	if root.ParentSpanID != "" {
+		t.Errorf("root span has parent %q", root.ParentSpanID)
+	}
+	if !unixNanoTime(t, root.StartTimeUnixNano).Equal(created) || !unixNanoTime(t, root.EndTimeUnixNano).Equal(completed) {
+		t.Errorf("root span covers %s to %s, expected the namespace lifetime", root.StartTimeUnixNano, root.EndTimeUnixNano)
+	}
+	if root.Status == nil || root.Status.Code != statusCodeError || root.Status.Message != "test: Error (exit code 1)" {
+		t.Errorf("root span status %+v, expected the first pod failure", root.Status)
+	}
+	attributes := attributeMap(root.Attributes)
+	for key, expected := range map[string]string{
+		"ci.test_name":         "e2e-vsphere-ovn",
+		"ci.variant":           "nightly",
+		"ci.job_type":          "periodic",
+		"ci.failed":            "true",
+		"ci.pull":              "42",
+		"vsphere.pool":         "pool-a",
+		"vsphere.network_type": "single-tenant",
+		"vsphere.portgroup":    "ci-vlan-1",
+		"k8s.namespace.name":   "ci-op-abc",
+	} {
+		if attributes[key] != expected {
+			t.Errorf("root attribute %s is %q, expected %q", key, attributes[key], expected)
+		}
+	}
+
+	spanIDs := make(map[string]bool)
+	for _, span := range spans {
+		if _, err := hex.DecodeString(span.SpanID); err != nil || len(span.SpanID) != 16 {
+			t.Errorf("span ID %q of %s is not 8 hex encoded bytes", span.SpanID, span.Name)
+		}
+		if spanIDs[span.SpanID] {
+			t.Errorf("span ID %s of %s is not unique", span.SpanID, span.Name)
+		}
+		spanIDs[span.SpanID] = true
+		if span.TraceID != root.TraceID {
+			t.Errorf("span %s is in trace %s, expected %s", span.Name, span.TraceID, root.TraceID)
+		}
+		if span.Name != root.Name && span.ParentSpanID != root.SpanID {
+			t.Errorf("span %s has parent %q, expected the root span %s", span.Name, span.ParentSpanID, root.SpanID)
+		}
+		if unixNanoTime(t, span.EndTimeUnixNano).Before(unixNanoTime(t, span.StartTimeUnixNano)) {
+			t.Errorf("span %s ends before it starts", span.Name)
+		}
+	}
+
+	for name, times := range map[string][2]time.Time{
+		"lease pending":   {testContext.LeaseCreated, leased},
+		"lease fulfilled": {leased, completed},
+		"e2e-test":        {created.Add(30 * time.Minute), failed},
+		"pod failed":      {failed, failed},
+	} {
+		span := byName[name]
+		if !unixNanoTime(t, span.StartTimeUnixNano).Equal(times[0]) || !unixNanoTime(t, span.EndTimeUnixNano).Equal(times[1]) {
+			t.Errorf("span %s covers %s to %s, expected %s to %s", name, span.StartTimeUnixNano, span.EndTimeUnixNano, times[0], times[1])
+		}
+	}
+	if got := attributeMap(byName["lease fulfilled"].Attributes); got["vsphere.pool"] != "pool-a" || got["vsphere.portgroup"] != "ci-vlan-1" {
+		t.Errorf("lease span attributes %v, expected the pool and portgroup", got)
+	}
+	if got := attributeMap(byName["pod failed"].Attributes); got["ci.failure.reason"] != "test: Error (exit code 1)" || got["k8s.node.name"] != "node-1" {
+		t.Errorf("failure span attributes %v, expected the failure reason and node", got)
+	}
+	if status := byName["e2e-test"].Status; status == nil || status.Code != statusCodeError {
+		t.Errorf("failed step status %+v, expected an error", status)
+	}
+	if status := byName["ipi-install"].Status; status == nil || status.Code != statusCodeOk {
+		t.Errorf("succeeded step status %+v, expected ok", status)
+	}
+}
+
+func TestSpansAreStable(t *testing.T) {
+	testContext := &data.TestContext{Namespace: corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:              "ci-op-abc",
+		CreationTimestamp: metav1.NewTime(time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)),
+	}}}
+	completed := time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC)
+	first, second := Spans(testContext, completed), Spans(testContext, completed)
+	if first[0].TraceID != second[0].TraceID || first[0].SpanID != second[0].SpanID {
+		t.Errorf("exporting a run twice yields different traces")
+	}
+}
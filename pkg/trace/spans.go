@@ -0,0 +1,204 @@
+package trace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Span kinds and status codes as defined by OTLP.
+const (
+	spanKindInternal = 1
+
+	statusCodeOk    = 1
+	statusCodeError = 2
+)
+
+// Span is an OTLP span in its JSON encoding.
+type Span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Status            *Status    `json:"status,omitempty"`
+}
+
+// Status is the outcome of a span.
+type Status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// KeyValue is an OTLP attribute.
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue holds the value of an attribute. Only one of its fields is set.
+type AnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func stringAttribute(key, value string) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int) KeyValue {
+	encoded := strconv.Itoa(value)
+	return KeyValue{Key: key, Value: AnyValue{IntValue: &encoded}}
+}
+
+func boolAttribute(key string, value bool) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{BoolValue: &value}}
+}
+
+// attributes returns the non-empty string attributes of the given key/value pairs.
+func attributes(pairs ...string) []KeyValue {
+	var kvs []KeyValue
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if len(pairs[i+1]) > 0 {
+			kvs = append(kvs, stringAttribute(pairs[i], pairs[i+1]))
+		}
+	}
+	return kvs
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// traceID derives the trace ID from the namespace so exporting a run twice
+// yields the same trace.
+func traceID(testContext *data.TestContext) string {
+	sum := sha256.Sum256([]byte(testContext.Namespace.Name + "/" + unixNano(testContext.Namespace.CreationTimestamp.Time)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// spanID derives the ID of a span from its trace and a name unique within the trace.
+func spanID(traceID, name string) string {
+	sum := sha256.Sum256([]byte(traceID + "/" + name))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Spans builds the spans of a completed test run. The namespace lifetime is
+// the root span, with child spans for the lease while pending and while
+// fulfilled, for every step pod and for every pod failure.
+func Spans(testContext *data.TestContext, completed time.Time) []Span {
+	trace := traceID(testContext)
+	job := data.NewJob(testContext.Namespace)
+
+	name := testContext.TestName()
+	if len(name) == 0 {
+		name = testContext.Namespace.Name
+	}
+	root := Span{
+		TraceID:           trace,
+		SpanID:            spanID(trace, "run"),
+		Name:              name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: unixNano(testContext.Namespace.CreationTimestamp.Time),
+		EndTimeUnixNano:   unixNano(completed),
+		Attributes: append(attributes(
+			"k8s.namespace.name", testContext.Namespace.Name,
+			"ci.test_name", testContext.TestName(),
+			"ci.variant", testContext.Variant(),
+			"ci.job_type", testContext.JobType(),
+			"ci.org", job.Org,
+			"ci.repo", job.Repo,
+			"ci.branch", job.Branch,
+			"ci.job_name", job.Name,
+			"ci.build_id", job.BuildID,
+			"ci.commit", job.Commit,
+			"vsphere.pool", testContext.Pool,
+			"vsphere.network_type", testContext.NetworkType,
+			"vsphere.portgroup", testContext.Portgroup,
+			"vsphere.vcenter", testContext.Topology.VCenter,
+			"vsphere.datacenter", testContext.Topology.Datacenter,
+			"vsphere.compute_cluster", testContext.Topology.ComputeCluster,
+			"vsphere.datastore", testContext.Topology.Datastore,
+		), boolAttribute("ci.failed", testContext.Failed)),
+		Status: &Status{Code: statusCodeOk},
+	}
+	if job.Pull > 0 {
+		root.Attributes = append(root.Attributes, intAttribute("ci.pull", job.Pull))
+	}
+	if testContext.Failed {
+		root.Status = &Status{Code: statusCodeError, Message: "test failed"}
+		if len(testContext.FailedPods) > 0 {
+			root.Status.Message = testContext.FailedPods[0].Reason
+		}
+	}
+	spans := []Span{root}
+
+	child := func(name, key string, start, end time.Time, attrs []KeyValue) Span {
+		if end.Before(start) {
+			end = start
+		}
+		return Span{
+			TraceID:           trace,
+			SpanID:            spanID(trace, key),
+			ParentSpanID:      root.SpanID,
+			Name:              name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: unixNano(start),
+			EndTimeUnixNano:   unixNano(end),
+			Attributes:        attrs,
+		}
+	}
+
+	leaseAttributes := attributes(
+		"vsphere.pool", testContext.Pool,
+		"vsphere.network_type", testContext.NetworkType,
+		"vsphere.portgroup", testContext.Portgroup,
+	)
+	if !testContext.LeaseCreated.IsZero() {
+		pendingUntil := testContext.LeasedAt
+		if pendingUntil.IsZero() {
+			pendingUntil = completed
+		}
+		spans = append(spans, child("lease pending", "lease-pending", testContext.LeaseCreated, pendingUntil, leaseAttributes))
+	}
+	if !testContext.LeasedAt.IsZero() {
+		spans = append(spans, child("lease fulfilled", "lease-fulfilled", testContext.LeasedAt, completed, leaseAttributes))
+	}
+
+	reasons := make(map[string]string, len(testContext.FailedPods))
+	for _, failure := range testContext.FailedPods {
+		reasons[failure.Name] = failure.Reason
+	}
+	for _, step := range testContext.Steps {
+		span := child(step.Name, "step/"+step.Name, step.Started, step.Finished, attributes(
+			"k8s.pod.name", step.Name,
+			"k8s.node.name", step.NodeName,
+			"ci.step.phase", step.Phase,
+		))
+		span.Status = &Status{Code: statusCodeOk}
+		if step.Phase == string(corev1.PodFailed) {
+			span.Status = &Status{Code: statusCodeError, Message: reasons[step.Name]}
+		}
+		spans = append(spans, span)
+	}
+
+	for _, failure := range testContext.FailedPods {
+		span := child("pod failed", "failure/"+failure.Name, failure.Time, failure.Time, attributes(
+			"k8s.pod.name", failure.Name,
+			"k8s.node.name", failure.NodeName,
+			"ci.failure.reason", failure.Reason,
+			"ci.failure.message", failure.Message,
+		))
+		span.Status = &Status{Code: statusCodeError, Message: failure.Reason}
+		spans = append(spans, span)
+	}
+	return spans
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/test-monitor/pkg/api"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the request body, in the
+	// form GitHub and prow's hook use: sha256=<hex digest>.
+	SignatureHeader = "X-Hub-Signature-256"
+
+	// maxPayloadSize bounds the size of a request body.
+	maxPayloadSize = 1 << 20
+)
+
+// Outcomes of receiving a payload.
+const (
+	outcomeApplied  = "applied"
+	outcomeIgnored  = "ignored"
+	outcomeRejected = "rejected"
+)
+
+// Payload is the notification of a finished prow job. It accepts the fields
+// of the messages of prow's crier pubsub reporter, so the reporter's messages
+// can be forwarded as they are.
+type Payload struct {
+	// ProwJobID is the name of the ProwJob resource.
+	ProwJobID string `json:"prowjobid,omitempty"`
+	JobName   string `json:"job_name"`
+	BuildID   string `json:"build_id,omitempty"`
+	// RunID is the build ID as sent by the pubsub reporter.
+	RunID string `json:"runid,omitempty"`
+	State string `json:"state,omitempty"`
+	// Status is the state as sent by the pubsub reporter.
+	Status    string     `json:"status,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	Completed *time.Time `json:"completed,omitempty"`
+}
+
+// ProwJob returns the state of the prow job the payload notifies about.
+func (p *Payload) ProwJob() (data.ProwJob, error) {
+	prowJob := data.ProwJob{
+		Name:    p.ProwJobID,
+		JobName: p.JobName,
+		BuildID: p.BuildID,
+		State:   p.State,
+		URL:     p.URL,
+	}
+	if len(prowJob.BuildID) == 0 {
+		prowJob.BuildID = p.RunID
+	}
+	if len(prowJob.State) == 0 {
+		prowJob.State = p.Status
+	}
+	if p.Completed != nil {
+		prowJob.Completed = *p.Completed
+	}
+
+	if len(prowJob.Name) == 0 && (len(prowJob.JobName) == 0 || len(prowJob.BuildID) == 0) {
+		return prowJob, fmt.Errorf("either prowjobid or job_name and build_id are required")
+	}
+	if len(prowJob.State) == 0 {
+		return prowJob, fmt.Errorf("state is required")
+	}
+	return prowJob, nil
+}
+
+// Receiver accepts notifications of finished prow jobs as an alternative to
+// watching ProwJobs, and applies them to the test contexts or run records of
+// the namespaces the prow jobs created. Requests must be signed with Secret.
+type Receiver struct {
+	Secret []byte
+
+	receivedCounter *prometheus.CounterVec
+
+	testContext *testcontext.TestContextService
+
+	log logr.Logger
+}
+
+func (r *Receiver) SetupWithServer(server *api.Server,
+	testContext *testcontext.TestContextService,
+	log logr.Logger) error {
+	if len(r.Secret) == 0 {
+		return fmt.Errorf("a webhook secret is required")
+	}
+	r.testContext = testContext
+	r.log = log.WithName("webhook")
+
+	r.receivedCounter = monitor.ProwWebhooksReceived.NewCounterVec()
+	if err := monitor.ProwWebhooksReceived.Register(r.receivedCounter); err != nil {
+		return fmt.Errorf("error registering prow webhook metric: %w", err)
+	}
+
+	server.Handle("POST /api/v1/hooks/prowjobs", r)
+	return nil
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxPayloadSize))
+	if err != nil {
+		r.reject(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if err := Verify(r.Secret, body, req.Header.Get(SignatureHeader)); err != nil {
+		r.reject(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		r.reject(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %w", err))
+		return
+	}
+	prowJob, err := payload.ProwJob()
+	if err != nil {
+		r.reject(w, http.StatusBadRequest, err)
+		return
+	}
+	if !prowJob.IsFinal() {
+		r.receivedCounter.WithLabelValues(outcomeIgnored).Inc()
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if prowJob.Completed.IsZero() {
+		prowJob.Completed = time.Now()
+	}
+
+	r.testContext.UpdateWithProwJob(prowJob)
+	r.receivedCounter.WithLabelValues(outcomeApplied).Inc()
+	r.log.V(1).Info("applied prow job", "prowjob", prowJob.Key(), "state", prowJob.State)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *Receiver) reject(w http.ResponseWriter, status int, err error) {
+	r.receivedCounter.WithLabelValues(outcomeRejected).Inc()
+	r.log.V(1).Info("rejected prow webhook", "reason", err.Error())
+	if err := api.WriteError(w, status, err); err != nil {
+		r.log.Error(err, "error encoding response")
+	}
+}
+
+// Sign returns the signature of a body to send in the SignatureHeader.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns an error unless signature is the signature of body.
+func Verify(secret, body []byte, signature string) error {
+	if len(signature) == 0 {
+		return errors.New("missing signature")
+	}
+	digest, found := strings.CutPrefix(signature, "sha256=")
+	if !found {
+		return errors.New("unsupported signature algorithm")
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	testcontext "github.com/openshift-splat-team/test-monitor/pkg/context"
+	"github.com/openshift-splat-team/test-monitor/pkg/data"
+	"github.com/openshift-splat-team/test-monitor/pkg/ledger"
+	"github.com/openshift-splat-team/test-monitor/pkg/monitor"
+	"github.com/openshift-splat-team/test-monitor/pkg/observer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var secret = []byte("secret")
+
+// testContext is shared by the tests, as its metrics can only be registered once.
+var testContext *testcontext.TestContextService
+
+func TestMain(m *testing.M) {
+	directory, err := os.MkdirTemp("", "webhook")
+	if err != nil {
+		panic(err)
+	}
+	observers := &observer.Registry{}
+	if err := observers.Initialize(logr.Discard()); err != nil {
+		panic(err)
+	}
+	testContext = &testcontext.TestContextService{Directory: directory, Observers: observers}
+	testContext.Initialize(logr.Discard())
+
+	code := m.Run()
+	os.RemoveAll(directory)
+	os.Exit(code)
+}
+
+// newServer serves a receiver on a local address.
+func newServer(t *testing.T) *httptest.Server {
+	receiver := &Receiver{
+		Secret:          secret,
+		receivedCounter: monitor.ProwWebhooksReceived.NewCounterVec(),
+		testContext:     testContext,
+		log:             logr.Discard(),
+	}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newNamespace(name, prowJobID, jobName, buildID string) corev1.Namespace {
+	spec, _ := json.Marshal(data.JobSpec{Type: "periodic", Job: jobName, BuildID: buildID, ProwJobID: prowJobID})
+	return corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:              name,
+		CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+		Labels:            map[string]string{data.TargetLabel: "e2e-vsphere-ovn"},
+		Annotations:       map[string]string{data.JobSpecAnnotation: string(spec)},
+	}}
+}
+
+func TestReceiverAppliesToContext(t *testing.T) {
+	server := newServer(t)
+	namespace := newNamespace("ci-op-context", "4f6a1c", "periodic-e2e-vsphere", "101")
+	testContext.UpdateWithNamespace(namespace)
+
+	client := &Client{URL: server.URL, Secret: secret}
+	if err := client.Send(context.Background(), Payload{ProwJobID: "4f6a1c", JobName: "periodic-e2e-vsphere", Status: data.ProwJobFailure, URL: "https://prow/4f6a1c"}); err != nil {
+		t.Fatalf("error sending a signed payload: %v", err)
+	}
+
+	merged, exists := testContext.GetTestContext(namespace.Name)
+	if !exists {
+		t.Fatalf("test context %s does not exist", namespace.Name)
+	}
+	if merged.ProwJob == nil || merged.ProwJob.State != data.ProwJobFailure || merged.ProwJob.URL != "https://prow/4f6a1c" {
+		t.Errorf("expected the prow job to be merged into the context, got %+v", merged.ProwJob)
+	}
+	if !merged.Failed {
+		t.Errorf("expected the context to be failed by its prow job")
+	}
+}
+
+func TestReceiverAppliesToRun(t *testing.T) {
+	server := newServer(t)
+	namespace := newNamespace("ci-op-run", "", "periodic-e2e-vsphere", "102")
+	testContext.UpdateWithNamespace(namespace)
+	testContext.CompleteRun(testContext.DestroyContext(namespace))
+	run := findRun(t, namespace.Name)
+	if run.Failed || run.ProwJob != nil {
+		t.Fatalf("expected a passed run without prow job, got %+v", run)
+	}
+
+	// the pubsub reporter sends the build ID as runid
+	client := &Client{URL: server.URL, Secret: secret}
+	if err := client.Send(context.Background(), Payload{JobName: "periodic-e2e-vsphere", RunID: "102", Status: data.ProwJobAborted}); err != nil {
+		t.Fatalf("error sending a signed payload: %v", err)
+	}
+
+	corrected := findRun(t, namespace.Name)
+	if !corrected.Failed || corrected.ProwJob == nil || corrected.ProwJob.State != data.ProwJobAborted {
+		t.Errorf("expected the prow job to correct the run, got %+v", corrected)
+	}
+	if corrected.Revision <= run.Revision {
+		t.Errorf("expected the corrected run to move to a later revision than %d, got %d", run.Revision, corrected.Revision)
+	}
+}
+
+func findRun(t *testing.T, namespace string) data.RunRecord {
+	t.Helper()
+	for _, run := range testContext.QueryRuns(ledger.Filter{}) {
+		if run.Namespace == namespace {
+			return run
+		}
+	}
+	t.Fatalf("run of %s is not in the run ledger", namespace)
+	return data.RunRecord{}
+}
+
+func TestReceiverResponses(t *testing.T) {
+	server := newServer(t)
+	payload, _ := json.Marshal(Payload{JobName: "periodic-e2e-vsphere", BuildID: "103", State: data.ProwJobSuccess})
+	pending, _ := json.Marshal(Payload{JobName: "periodic-e2e-vsphere", BuildID: "104", State: "pending"})
+	oversized, _ := json.Marshal(Payload{JobName: "periodic-e2e-vsphere", BuildID: "105", State: data.ProwJobSuccess,
+		URL: strings.Repeat("x", maxPayloadSize)})
+
+	for _, test := range []struct {
+		name      string
+		body      []byte
+		signature string
+		status    int
+	}{
+		{name: "valid signature", body: payload, signature: Sign(secret, payload), status: http.StatusOK},
+		{name: "unfinished job", body: pending, signature: Sign(secret, pending), status: http.StatusAccepted},
+		{name: "missing signature", body: payload, status: http.StatusUnauthorized},
+		{name: "wrong secret", body: payload, signature: Sign([]byte("other"), payload), status: http.StatusUnauthorized},
+		{name: "unsupported algorithm", body: payload, signature: "sha1=0123", status: http.StatusUnauthorized},
+		{name: "oversized body", body: oversized, signature: Sign(secret, oversized), status: http.StatusRequestEntityTooLarge},
+		{name: "invalid payload", body: []byte(`{"state":"success"}`), signature: Sign(secret, []byte(`{"state":"success"}`)), status: http.StatusBadRequest},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(test.signature) > 0 {
+				req.Header.Set(SignatureHeader, test.signature)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("error sending request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Fatalf("status %d, expected %d", resp.StatusCode, test.status)
+			}
+			if test.status/100 == 2 {
+				return
+			}
+			var response struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || len(response.Error) == 0 {
+				t.Errorf("expected a JSON error, got %+v: %v", response, err)
+			}
+		})
+	}
+}
+
+func TestClientReportsRejection(t *testing.T) {
+	server := newServer(t)
+	client := &Client{URL: server.URL, Secret: []byte("other")}
+	err := client.Send(context.Background(), Payload{JobName: "periodic-e2e-vsphere", BuildID: "106", State: data.ProwJobSuccess})
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("expected the client to report the rejected signature, got %v", err)
+	}
+}